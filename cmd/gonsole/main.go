@@ -8,7 +8,7 @@ import (
 )
 
 func main() {
-	p := tea.NewProgram(editor.New(), tea.WithAltScreen())
+	p := tea.NewProgram(editor.New(), tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
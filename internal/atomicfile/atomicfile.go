@@ -0,0 +1,161 @@
+// Package atomicfile replaces files so that a crash or a full disk never
+// leaves them half written.
+//
+// Write puts the new contents in a temporary file next to the target,
+// flushes it to disk and renames it over the target, which readers see
+// as a single change. The file keeps its mode and owner, and a symlink
+// is followed so that its target is replaced rather than the link.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// maxLinks bounds how many symlinks are followed, as the kernel does.
+const maxLinks = 40
+
+// DirError reports that no temporary file could be created in the
+// directory of the file being written. WriteInPlace may still work.
+type DirError struct {
+	Dir string
+	Err error
+}
+
+func (e *DirError) Error() string {
+	err := e.Err
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return fmt.Sprintf("cannot create files in %s: %v", e.Dir, err)
+}
+
+func (e *DirError) Unwrap() error { return e.Err }
+
+// Write replaces the contents of the file at path with data. A new file
+// is created with mode perm.
+//
+// When the file's owner cannot be kept, or it has other hard links that
+// a rename would split off, the file is rewritten in place instead.
+func Write(path string, data []byte, perm fs.FileMode) error {
+	target, err := Resolve(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		fi = nil
+	case err != nil:
+		return err
+	case !fi.Mode().IsRegular():
+		return fmt.Errorf("%s is not a regular file", target)
+	default:
+		perm = fi.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		// Renaming over a read-only file would succeed, so check first
+		// that it may be written at all.
+		f, err := os.OpenFile(target, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		if links(fi) > 1 {
+			return WriteInPlace(target, data)
+		}
+	}
+
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp*")
+	if err != nil {
+		return &DirError{Dir: dir, Err: err}
+	}
+	done := false
+	defer func() {
+		if !done {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if fi != nil {
+		if uid, gid, ok := owner(fi); ok {
+			if err := tmp.Chown(uid, gid); err != nil {
+				// Only root may give a file away: keep the owner by
+				// writing the file itself.
+				tmp.Close()
+				os.Remove(tmp.Name())
+				done = true
+				return WriteInPlace(target, data)
+			}
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	// Chmod after Chown, which clears the setuid and setgid bits.
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	done = true
+	syncDir(dir)
+	return nil
+}
+
+// WriteInPlace truncates the file at path and writes data into it. It is
+// not atomic, but needs no permission on the directory.
+func WriteInPlace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Resolve follows the symlinks at path, including one whose target does
+// not exist yet, and returns the file they lead to.
+func Resolve(path string) (string, error) {
+	for range maxLinks {
+		fi, err := os.Lstat(path)
+		if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+			return path, nil
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+}
+
+// syncDir flushes the directory entry of a renamed file. Not every
+// system can sync a directory, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
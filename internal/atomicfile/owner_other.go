@@ -0,0 +1,9 @@
+//go:build !unix
+
+package atomicfile
+
+import "io/fs"
+
+func owner(fs.FileInfo) (uid, gid int, ok bool) { return 0, 0, false }
+
+func links(fs.FileInfo) int { return 1 }
@@ -0,0 +1,36 @@
+// Package buffer holds the text of an open document.
+//
+// Offsets are byte offsets into the UTF-8 text and columns are byte
+// offsets within a line; callers that need grapheme or display columns
+// convert on top of this.
+package buffer
+
+// Buffer is an editable text store with line-aware addressing.
+type Buffer interface {
+	// Insert places text at offset. Offsets past the end are clamped.
+	Insert(offset int, text string)
+	// Delete removes length bytes starting at offset.
+	Delete(offset, length int)
+
+	// Len returns the size of the text in bytes.
+	Len() int
+	// LineCount returns the number of lines; an empty buffer has one.
+	LineCount() int
+	// Line returns line n without its trailing newline.
+	Line(n int) string
+	// LineStart returns the offset of the first byte of line n.
+	LineStart(n int) int
+
+	// Offset converts a (line, col) pair into a byte offset.
+	Offset(line, col int) int
+	// Position converts a byte offset into a (line, col) pair.
+	Position(offset int) (line, col int)
+
+	// Slice returns the text between two offsets.
+	Slice(start, end int) string
+	// String returns the whole text.
+	String() string
+
+	// Clone returns an independent copy that shares immutable storage.
+	Clone() Buffer
+}
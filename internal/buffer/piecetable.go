@@ -0,0 +1,312 @@
+package buffer
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// store is an append-only byte slice with an index of its newlines.
+type store struct {
+	data     []byte
+	newlines []int
+}
+
+// append adds text to the store and returns the piece spanning it.
+func (s *store) append(text string) piece {
+	start, first := len(s.data), len(s.newlines)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			s.newlines = append(s.newlines, start+i)
+		}
+	}
+	s.data = append(s.data, text...)
+	return s.span(start, len(s.data), first)
+}
+
+// span returns the piece for data[start:end], whose first newline, if
+// any, is newlines[first]. The piece's slices are capped, so appending to
+// the store never writes where a piece can see.
+func (s *store) span(start, end, first int) piece {
+	last := sort.SearchInts(s.newlines, end)
+	return piece{
+		src:      s,
+		start:    start,
+		text:     s.data[start:end:end],
+		newlines: s.newlines[first:last:last],
+	}
+}
+
+// piece is a span of one of the two stores.
+type piece struct {
+	src      *store
+	start    int    // offset of text in src
+	text     []byte // the bytes of the span
+	newlines []int  // offsets in src of the newlines in text
+}
+
+// cut splits p k bytes in.
+func (p piece) cut(k int) (piece, piece) {
+	i := sort.SearchInts(p.newlines, p.start+k)
+	return piece{src: p.src, start: p.start, text: p.text[:k:k], newlines: p.newlines[:i:i]},
+		piece{src: p.src, start: p.start + k, text: p.text[k:], newlines: p.newlines[i:]}
+}
+
+// node is a node of a treap of pieces ordered by position in the text,
+// caching the size and newline count of its subtree. Nodes are never
+// changed once made; an edit copies the nodes on the paths it touches, so
+// a clone shares the whole tree.
+type node struct {
+	p           piece
+	left, right *node
+	prio        uint32
+	size, lines int
+}
+
+func (n *node) bytes() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *node) newlines() int {
+	if n == nil {
+		return 0
+	}
+	return n.lines
+}
+
+func mk(p piece, prio uint32, left, right *node) *node {
+	return &node{
+		p: p, left: left, right: right, prio: prio,
+		size:  left.bytes() + len(p.text) + right.bytes(),
+		lines: left.newlines() + len(p.newlines) + right.newlines(),
+	}
+}
+
+func leaf(p piece) *node {
+	return mk(p, rand.Uint32(), nil, nil)
+}
+
+// merge joins two trees, every piece of a coming before every piece of b.
+func merge(a, b *node) *node {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.prio > b.prio:
+		return mk(a.p, a.prio, a.left, merge(a.right, b))
+	default:
+		return mk(b.p, b.prio, merge(a, b.left), b.right)
+	}
+}
+
+// split divides n into the text before offset and the text from it on,
+// cutting a piece in two when offset falls inside it.
+func split(n *node, offset int) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	ls := n.left.bytes()
+	switch {
+	case offset <= ls:
+		l, r := split(n.left, offset)
+		return l, mk(n.p, n.prio, r, n.right)
+	case offset >= ls+len(n.p.text):
+		l, r := split(n.right, offset-ls-len(n.p.text))
+		return mk(n.p, n.prio, n.left, l), r
+	default:
+		a, b := n.p.cut(offset - ls)
+		return merge(n.left, leaf(a)), merge(leaf(b), n.right)
+	}
+}
+
+// last returns the last piece of n, which must not be empty.
+func (n *node) last() piece {
+	for n.right != nil {
+		n = n.right
+	}
+	return n.p
+}
+
+// replaceLast returns n with its last piece replaced by p.
+func (n *node) replaceLast(p piece) *node {
+	if n.right == nil {
+		return mk(p, n.prio, n.left, nil)
+	}
+	return mk(n.p, n.prio, n.left, n.right.replaceLast(p))
+}
+
+// write appends the text of n between start and end, relative to n, to b.
+func (n *node) write(b *strings.Builder, start, end int) {
+	if n == nil || end <= 0 || start >= n.size {
+		return
+	}
+	ls := n.left.bytes()
+	n.left.write(b, start, end)
+	from, to := max(start-ls, 0), min(end-ls, len(n.p.text))
+	if from < to {
+		b.Write(n.p.text[from:to])
+	}
+	skip := ls + len(n.p.text)
+	n.right.write(b, start-skip, end-skip)
+}
+
+// PieceTable is a Buffer that never copies the original text. Edits are
+// recorded as spans over the original file and an append-only add store,
+// kept in a balanced tree, so edits and line lookups cost O(log pieces)
+// however large the file and however many edits were made.
+type PieceTable struct {
+	orig *store
+	add  *store
+	root *node
+}
+
+// New returns a PieceTable holding text.
+func New(text string) *PieceTable {
+	t := &PieceTable{orig: &store{}, add: &store{}}
+	if p := t.orig.append(text); len(p.text) > 0 {
+		t.root = leaf(p)
+	}
+	return t
+}
+
+func (t *PieceTable) clamp(offset int) int {
+	return max(0, min(offset, t.Len()))
+}
+
+func (t *PieceTable) Insert(offset int, text string) {
+	if text == "" {
+		return
+	}
+	offset = t.clamp(offset)
+	p := t.add.append(text)
+	l, r := split(t.root, offset)
+	// Typing usually continues right where the previous insert ended, so
+	// grow that piece instead of adding a new one per keystroke.
+	if l != nil {
+		if prev := l.last(); prev.src == t.add && prev.start+len(prev.text) == p.start {
+			first := len(t.add.newlines) - len(prev.newlines) - len(p.newlines)
+			t.root = merge(l.replaceLast(t.add.span(prev.start, p.start+len(p.text), first)), r)
+			return
+		}
+	}
+	t.root = merge(merge(l, leaf(p)), r)
+}
+
+func (t *PieceTable) Delete(offset, length int) {
+	offset = t.clamp(offset)
+	end := t.clamp(offset + length)
+	if end <= offset {
+		return
+	}
+	l, rest := split(t.root, offset)
+	_, r := split(rest, end-offset)
+	t.root = merge(l, r)
+}
+
+func (t *PieceTable) Len() int { return t.root.bytes() }
+
+func (t *PieceTable) LineCount() int { return t.root.newlines() + 1 }
+
+func (t *PieceTable) LineStart(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n > t.root.newlines() {
+		return t.Len()
+	}
+	// Find the n-th newline.
+	pos := 0
+	for x := t.root; x != nil; {
+		switch {
+		case n <= x.left.newlines():
+			x = x.left
+		case n <= x.left.newlines()+len(x.p.newlines):
+			n -= x.left.newlines()
+			return pos + x.left.bytes() + x.p.newlines[n-1] - x.p.start + 1
+		default:
+			n -= x.left.newlines() + len(x.p.newlines)
+			pos += x.left.bytes() + len(x.p.text)
+			x = x.right
+		}
+	}
+	return t.Len()
+}
+
+func (t *PieceTable) Line(n int) string {
+	if n < 0 || n > t.root.newlines() {
+		return ""
+	}
+	start := t.LineStart(n)
+	end := t.Len()
+	if n < t.root.newlines() {
+		end = t.LineStart(n+1) - 1
+	}
+	return t.Slice(start, end)
+}
+
+func (t *PieceTable) Offset(line, col int) int {
+	if line < 0 {
+		return 0
+	}
+	if line > t.root.newlines() {
+		return t.Len()
+	}
+	start := t.LineStart(line)
+	end := t.Len()
+	if line < t.root.newlines() {
+		end = t.LineStart(line+1) - 1
+	}
+	if col < 0 {
+		col = 0
+	}
+	if start+col > end {
+		return end
+	}
+	return start + col
+}
+
+func (t *PieceTable) Position(offset int) (line, col int) {
+	offset = t.clamp(offset)
+	// Count the newlines before offset.
+	for x, rest := t.root, offset; x != nil; {
+		ls := x.left.bytes()
+		switch {
+		case rest < ls:
+			x = x.left
+		case rest < ls+len(x.p.text):
+			line += x.left.newlines() + sort.SearchInts(x.p.newlines, x.p.start+rest-ls)
+			x = nil
+		default:
+			line += x.left.newlines() + len(x.p.newlines)
+			rest -= ls + len(x.p.text)
+			x = x.right
+		}
+	}
+	return line, offset - t.LineStart(line)
+}
+
+func (t *PieceTable) Slice(start, end int) string {
+	start, end = t.clamp(start), t.clamp(end)
+	if end <= start {
+		return ""
+	}
+	var b strings.Builder
+	b.Grow(end - start)
+	t.root.write(&b, start, end)
+	return b.String()
+}
+
+func (t *PieceTable) String() string {
+	return t.Slice(0, t.Len())
+}
+
+// Clone shares the tree, which edits never change in place, so the clone
+// can be read on another goroutine while the original is edited.
+func (t *PieceTable) Clone() Buffer {
+	c := *t
+	return &c
+}
@@ -0,0 +1,228 @@
+package buffer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+type edit struct {
+	insert bool
+	offset int
+	text   string // inserted text
+	length int    // deleted length
+}
+
+func ins(offset int, text string) edit { return edit{insert: true, offset: offset, text: text} }
+func del(offset, length int) edit      { return edit{offset: offset, length: length} }
+
+func apply(t *PieceTable, edits []edit) {
+	for _, e := range edits {
+		if e.insert {
+			t.Insert(e.offset, e.text)
+		} else {
+			t.Delete(e.offset, e.length)
+		}
+	}
+}
+
+func TestPieceTableEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		orig  string
+		edits []edit
+		want  string
+	}{
+		{"empty", "", nil, ""},
+		{"insert into empty", "", []edit{ins(0, "abc")}, "abc"},
+		{"insert at start", "world", []edit{ins(0, "hello ")}, "hello world"},
+		{"insert at end", "hello", []edit{ins(5, " world")}, "hello world"},
+		{"insert past end clamps", "ab", []edit{ins(10, "c")}, "abc"},
+		{"insert before start clamps", "bc", []edit{ins(-3, "a")}, "abc"},
+		{"insert in middle", "ac", []edit{ins(1, "b")}, "abc"},
+		{"typing coalesces", "", []edit{ins(0, "a"), ins(1, "b"), ins(2, "\n"), ins(3, "c")}, "ab\nc"},
+		{"typing after moving", "xy", []edit{ins(1, "a"), ins(0, "b"), ins(3, "c")}, "bxacy"},
+		{"delete within piece", "abcdef", []edit{del(1, 3)}, "aef"},
+		{"delete everything", "abc\ndef", []edit{del(0, 7)}, ""},
+		{"delete past end clamps", "abcdef", []edit{del(4, 10)}, "abcd"},
+		{"delete nothing", "abc", []edit{del(1, 0), del(5, 2)}, "abc"},
+		{"delete across pieces", "abcdef", []edit{ins(3, "XYZ"), ins(0, "12"), del(1, 6)}, "1Zdef"},
+		{"delete newline joining lines", "one\ntwo\nthree", []edit{del(3, 1), del(6, 1)}, "onetwothree"},
+		{"crlf", "a\r\nb", []edit{ins(3, "x\r\n"), del(1, 2)}, "ax\r\nb"},
+		{"multibyte", "héllo wörld", []edit{del(1, 2), ins(1, "€"), ins(len("h€llo "), "→")}, "h€llo →wörld"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := New(tt.orig)
+			apply(pt, tt.edits)
+			check(t, pt, tt.want)
+		})
+	}
+}
+
+func TestPieceTableLines(t *testing.T) {
+	pt := New("first\r\nsécond\n\nlast")
+	pt.Insert(pt.Offset(1, 0), "new\n")
+	tests := []struct {
+		line  int
+		text  string
+		start int
+	}{
+		{-1, "", 0},
+		{0, "first\r", 0},
+		{1, "new", 7},
+		{2, "sécond", 11},
+		{3, "", 19},
+		{4, "last", 20},
+		{5, "", 24},
+	}
+	for _, tt := range tests {
+		if got := pt.Line(tt.line); got != tt.text {
+			t.Errorf("Line(%d) = %q, want %q", tt.line, got, tt.text)
+		}
+		if got := pt.LineStart(tt.line); got != tt.start {
+			t.Errorf("LineStart(%d) = %d, want %d", tt.line, got, tt.start)
+		}
+	}
+	offsets := []struct {
+		line, col int
+		want      int
+	}{
+		{0, 0, 0},
+		{0, 6, 6},
+		{0, 99, 6},
+		{2, -1, 11},
+		{2, 2, 13},
+		{4, 4, 24},
+		{-1, 3, 0},
+		{9, 0, 24},
+	}
+	for _, tt := range offsets {
+		if got := pt.Offset(tt.line, tt.col); got != tt.want {
+			t.Errorf("Offset(%d, %d) = %d, want %d", tt.line, tt.col, got, tt.want)
+		}
+	}
+	positions := []struct {
+		offset, line, col int
+	}{
+		{-5, 0, 0},
+		{5, 0, 5},
+		{6, 0, 6},
+		{7, 1, 0},
+		{13, 2, 2},
+		{19, 3, 0},
+		{24, 4, 4},
+		{99, 4, 4},
+	}
+	for _, tt := range positions {
+		if line, col := pt.Position(tt.offset); line != tt.line || col != tt.col {
+			t.Errorf("Position(%d) = %d, %d, want %d, %d", tt.offset, line, col, tt.line, tt.col)
+		}
+	}
+}
+
+func TestPieceTableClone(t *testing.T) {
+	pt := New("abc\ndef")
+	pt.Insert(3, "123")
+	c := pt.Clone()
+	pt.Insert(4, "x")
+	pt.Delete(0, 2)
+	c.Insert(0, ">")
+	check(t, pt, "c1x23\ndef")
+	if got := c.String(); got != ">abc123\ndef" {
+		t.Errorf("clone = %q, want %q", got, ">abc123\ndef")
+	}
+}
+
+// TestPieceTableRandom compares random edits with the same edits made to
+// a string.
+func TestPieceTableRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	alphabet := []string{"a", "b", "\n", "\r\n", "é", "€", "😀", "xyz"}
+	for round := 0; round < 50; round++ {
+		want := "line one\nline two\r\nthird é\n"
+		pt := New(want)
+		typed := 0
+		for i := 0; i < 200; i++ {
+			offset := r.IntN(len(want) + 1)
+			if r.IntN(3) > 0 {
+				text := alphabet[r.IntN(len(alphabet))]
+				if r.IntN(2) == 0 {
+					// Keep typing where the last insert ended.
+					offset = min(typed, len(want))
+				}
+				pt.Insert(offset, text)
+				want = want[:offset] + text + want[offset:]
+				typed = offset + len(text)
+			} else {
+				length := r.IntN(8)
+				pt.Delete(offset, length)
+				want = want[:offset] + want[min(offset+length, len(want)):]
+			}
+		}
+		check(t, pt, want)
+		if t.Failed() {
+			t.Fatalf("round %d", round)
+		}
+	}
+}
+
+// check compares every accessor of pt with what a string holding want
+// would give.
+func check(t *testing.T, pt *PieceTable, want string) {
+	t.Helper()
+	if got := pt.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	if got := pt.Len(); got != len(want) {
+		t.Errorf("Len() = %d, want %d", got, len(want))
+	}
+	lines := strings.Split(want, "\n")
+	if got := pt.LineCount(); got != len(lines) {
+		t.Errorf("LineCount() = %d, want %d", got, len(lines))
+	}
+	start := 0
+	for n, line := range lines {
+		if got := pt.Line(n); got != line {
+			t.Errorf("Line(%d) = %q, want %q", n, got, line)
+		}
+		if got := pt.LineStart(n); got != start {
+			t.Errorf("LineStart(%d) = %d, want %d", n, got, start)
+		}
+		for col := 0; col <= len(line); col++ {
+			if got := pt.Offset(n, col); got != start+col {
+				t.Errorf("Offset(%d, %d) = %d, want %d", n, col, got, start+col)
+			}
+			if l, c := pt.Position(start + col); l != n || c != col {
+				t.Errorf("Position(%d) = %d, %d, want %d, %d", start+col, l, c, n, col)
+			}
+		}
+		start += len(line) + 1
+	}
+	for i := 0; i <= len(want); i += max(1, len(want)/7) {
+		for j := i; j <= len(want); j += max(1, len(want)/5) {
+			if got := pt.Slice(i, j); got != want[i:j] {
+				t.Errorf("Slice(%d, %d) = %q, want %q", i, j, got, want[i:j])
+			}
+		}
+	}
+}
+
+func BenchmarkPieceTableReplaceAll(b *testing.B) {
+	for _, n := range []int{10000, 40000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			text := strings.Repeat("the quick brown fox\n", n)
+			for i := 0; i < b.N; i++ {
+				pt := New(text)
+				// What :%s/quick/slow/ does: one edit per line, bottom up.
+				for line := n - 1; line >= 0; line-- {
+					off := pt.LineStart(line) + 4
+					pt.Delete(off, len("quick"))
+					pt.Insert(off, "slow")
+					pt.Position(off)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Package clipboard moves text between the editor, the terminal and the
+// desktop.
+//
+// Copies go to three places: the internal kill ring, the system clipboard
+// through whichever helper tool is installed, and the terminal through an
+// OSC 52 escape sequence. The last one is what makes copying work over SSH
+// and inside tmux, where no helper tool can reach the local desktop.
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// ringSize matches Emacs' default kill-ring-max.
+const ringSize = 60
+
+// toolTimeout bounds how long a helper tool may run.
+const toolTimeout = time.Second
+
+// Clipboard is the editor's copy/paste store.
+type Clipboard struct {
+	Ring      *Ring
+	registers map[rune]string
+
+	out   io.Writer // receives OSC 52 sequences; nil disables them
+	copy  []string  // system copy command, nil when none is installed
+	paste []string  // system paste command, nil when none is installed
+
+	mu     sync.Mutex // orders the copy tool's runs
+	copies int        // copies made
+	sent   int        // the newest copy sent to the tool
+}
+
+// New returns a clipboard that uses the first system clipboard tool found
+// on PATH and writes OSC 52 sequences to out.
+func New(out io.Writer) *Clipboard {
+	c := &Clipboard{
+		Ring:      NewRing(ringSize),
+		registers: make(map[rune]string),
+		out:       out,
+	}
+	c.copy, c.paste = detectTools()
+	return c
+}
+
+// detectTools picks copy and paste commands for the current desktop.
+func detectTools() (copyCmd, pasteCmd []string) {
+	type tool struct {
+		ok          bool
+		copy, paste []string
+	}
+	has := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+	tools := []tool{
+		{
+			ok:    runtime.GOOS == "darwin" && has("pbcopy"),
+			copy:  []string{"pbcopy"},
+			paste: []string{"pbpaste"},
+		},
+		{
+			ok:    os.Getenv("WAYLAND_DISPLAY") != "" && has("wl-copy"),
+			copy:  []string{"wl-copy"},
+			paste: []string{"wl-paste", "--no-newline"},
+		},
+		{
+			ok:    os.Getenv("DISPLAY") != "" && has("xclip"),
+			copy:  []string{"xclip", "-in", "-selection", "clipboard"},
+			paste: []string{"xclip", "-out", "-selection", "clipboard"},
+		},
+		{
+			ok:    os.Getenv("DISPLAY") != "" && has("xsel"),
+			copy:  []string{"xsel", "--input", "--clipboard"},
+			paste: []string{"xsel", "--output", "--clipboard"},
+		},
+		{
+			ok:    has("clip.exe"),
+			copy:  []string{"clip.exe"},
+			paste: []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"},
+		},
+	}
+	for _, t := range tools {
+		if t.ok {
+			return t.copy, t.paste
+		}
+	}
+	return nil, nil
+}
+
+// HasSystem reports whether a system clipboard tool was found.
+func (c *Clipboard) HasSystem() bool {
+	return c.copy != nil
+}
+
+// Copy stores text in the kill ring and sends it to the terminal. The
+// function it returns sends it to the system clipboard; it runs the helper
+// tool and may block for up to a second, so callers run it off the UI
+// goroutine. It is nil when no tool is installed, and its error reports a
+// failing tool; the text is still available to paste inside the editor.
+func (c *Clipboard) Copy(text string) func() error {
+	c.Ring.Push(text)
+	if c.out != nil {
+		seq := osc52.New(text)
+		switch term := os.Getenv("TERM"); {
+		case os.Getenv("TMUX") != "" || strings.HasPrefix(term, "tmux"):
+			seq = seq.Tmux()
+		case strings.HasPrefix(term, "screen"):
+			seq = seq.Screen()
+		}
+		_, _ = seq.WriteTo(c.out)
+	}
+	if c.copy == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.copies++
+	n := c.copies
+	c.mu.Unlock()
+	return func() error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// A newer copy that got to the tool first wins.
+		if n <= c.sent {
+			return nil
+		}
+		c.sent = n
+		ctx, cancel := context.WithTimeout(context.Background(), toolTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, c.copy[0], c.copy[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return errors.New(c.copy[0] + ": " + err.Error())
+		}
+		return nil
+	}
+}
+
+// ReadSystem returns a function that reads the system clipboard, or nil
+// when no tool can. Like the one Copy returns, it may block for up to a
+// second; it returns "" when the tool fails.
+func (c *Clipboard) ReadSystem() func() string {
+	if c.paste == nil {
+		return nil
+	}
+	paste := c.paste
+	return func() string {
+		ctx, cancel := context.WithTimeout(context.Background(), toolTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, paste[0], paste[1:]...).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.ReplaceAll(string(out), "\r\n", "\n")
+	}
+}
+
+// Paste returns the text to paste given what ReadSystem read: that text
+// when there is any, which also goes on the kill ring, or else the newest
+// kill.
+func (c *Clipboard) Paste(system string) string {
+	if system != "" {
+		if c.Ring.Current() != system {
+			c.Ring.Push(system)
+		}
+		return system
+	}
+	return c.Ring.Current()
+}
+
+// Set stores text in the named register.
+func (c *Clipboard) Set(reg rune, text string) {
+	c.registers[reg] = text
+}
+
+// Get returns the contents of the named register.
+func (c *Clipboard) Get(reg rune) string {
+	return c.registers[reg]
+}
@@ -0,0 +1,49 @@
+package clipboard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSystemTools(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "clip")
+	c := New(nil)
+	c.copy = []string{"sh", "-c", "cat > " + file}
+	c.paste = []string{"cat", file}
+
+	older := c.Copy("one")
+	newer := c.Copy("two")
+	if err := newer(); err != nil {
+		t.Fatal(err)
+	}
+	// The older copy finishing last must not win.
+	if err := older(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.ReadSystem()(); got != "two" {
+		t.Errorf("system clipboard holds %q, want %q", got, "two")
+	}
+
+	if err := os.WriteFile(file, []byte("from\r\nelsewhere"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Paste(c.ReadSystem()()); got != "from\nelsewhere" {
+		t.Errorf("Paste = %q", got)
+	}
+	if got := c.Ring.Current(); got != "from\nelsewhere" {
+		t.Errorf("kill ring holds %q, want the pasted text", got)
+	}
+
+	c.paste = []string{"false"}
+	if got := c.Paste(c.ReadSystem()()); got != "from\nelsewhere" {
+		t.Errorf("Paste with a failing tool = %q, want the newest kill", got)
+	}
+	c.copy, c.paste = nil, nil
+	if c.Copy("three") != nil || c.ReadSystem() != nil {
+		t.Errorf("functions returned without a tool")
+	}
+	if got := c.Paste(""); got != "three" {
+		t.Errorf("Paste without a tool = %q, want the newest kill", got)
+	}
+}
@@ -0,0 +1,73 @@
+package clipboard
+
+// Ring is a kill ring: the most recent kills, newest first. Yanking reads
+// the entry under the cursor and Rotate steps to older ones, wrapping
+// around, the way Emacs' M-y does.
+type Ring struct {
+	entries []string
+	size    int
+	pos     int
+}
+
+// NewRing returns a ring that keeps at most size entries.
+func NewRing(size int) *Ring {
+	return &Ring{size: size}
+}
+
+// Push adds text as the newest entry and resets the rotation.
+func (r *Ring) Push(text string) {
+	if text == "" {
+		return
+	}
+	if len(r.entries) > 0 && r.entries[0] == text {
+		r.pos = 0
+		return
+	}
+	r.entries = append([]string{text}, r.entries...)
+	if len(r.entries) > r.size {
+		r.entries = r.entries[:r.size]
+	}
+	r.pos = 0
+}
+
+// AppendToTop extends the newest entry, for consecutive kills that
+// should yank back as one piece.
+func (r *Ring) AppendToTop(text string) {
+	if len(r.entries) == 0 {
+		r.Push(text)
+		return
+	}
+	r.entries[0] += text
+	r.pos = 0
+}
+
+// PrependToTop extends the newest entry at the front, for consecutive
+// kills that run backwards.
+func (r *Ring) PrependToTop(text string) {
+	if len(r.entries) == 0 {
+		r.Push(text)
+		return
+	}
+	r.entries[0] = text + r.entries[0]
+	r.pos = 0
+}
+
+// Current returns the entry a yank inserts.
+func (r *Ring) Current() string {
+	if len(r.entries) == 0 {
+		return ""
+	}
+	return r.entries[r.pos]
+}
+
+// Rotate moves to the next older entry and returns it.
+func (r *Ring) Rotate() string {
+	if len(r.entries) == 0 {
+		return ""
+	}
+	r.pos = (r.pos + 1) % len(r.entries)
+	return r.entries[r.pos]
+}
+
+// Len returns the number of entries in the ring.
+func (r *Ring) Len() int { return len(r.entries) }
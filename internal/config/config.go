@@ -0,0 +1,297 @@
+// Package config loads the editor settings.
+//
+// Settings are JSON. The user file, $XDG_CONFIG_HOME/gonsole/config.json,
+// is read first and the project file, .gonsole/config.json in the nearest
+// directory above the project that has one, overrides it setting by
+// setting. GONSOLE_KEYS and GONSOLE_UNDO_LIMIT override both.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/ignore"
+	"github.com/alecthomas/chroma/styles"
+)
+
+// Config holds every setting.
+type Config struct {
+	// Theme is the chroma style used for syntax highlighting.
+	Theme string `json:"theme"`
+	// Shell runs in the built-in terminal.
+	Shell string `json:"shell"`
+	// TerminalHeight is the terminal panel height in rows; 0 gives it a
+	// quarter of the window.
+	TerminalHeight int `json:"terminalHeight"`
+	// UndoLimit is the number of undo steps kept per file.
+	UndoLimit int `json:"undoLimit"`
+	// KeyProfile is "default", "vim" or "emacs".
+	KeyProfile string `json:"keyProfile"`
+	// TabWidth and InsertSpaces set the indentation for every language
+	// without its own.
+	TabWidth     int  `json:"tabWidth"`
+	InsertSpaces bool `json:"insertSpaces"`
+	// FallbackEncoding decodes files that are not valid UTF-8 and carry no
+	// byte order mark.
+	FallbackEncoding string `json:"fallbackEncoding"`
+	// ShowHidden shows files whose names start with a dot in the sidebar,
+	// project search and the file finder.
+	ShowHidden bool `json:"showHidden"`
+	// Exclude lists patterns, in .gitignore syntax relative to the
+	// project, of files left out of the sidebar, project search and the
+	// file finder whatever the ignore files say.
+	Exclude []string `json:"exclude"`
+	// Languages holds per-language overrides keyed by language name as
+	// shown in the status bar ("go", "python", ...).
+	Languages map[string]Language `json:"languages"`
+}
+
+// Language overrides settings for one language. Zero values leave the
+// general setting in place.
+type Language struct {
+	TabWidth     int    `json:"tabWidth,omitempty"`
+	InsertSpaces *bool  `json:"insertSpaces,omitempty"`
+	Formatter    string `json:"formatter,omitempty"` // reads the file on stdin, writes it formatted
+	LSP          string `json:"lsp,omitempty"`       // language server command line
+}
+
+// LanguageSettings are the settings in effect for one language.
+type LanguageSettings struct {
+	TabWidth     int
+	InsertSpaces bool
+	Formatter    string
+	LSP          string
+}
+
+// KeyProfiles lists the accepted values of KeyProfile.
+var KeyProfiles = []string{"default", "vim", "emacs"}
+
+// Encodings lists the accepted values of FallbackEncoding.
+var Encodings = []string{"utf-8", "utf-16le", "utf-16be", "latin1", "windows-1256"}
+
+// Default returns the built-in settings.
+func Default() Config {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "bash"
+	}
+	return Config{
+		Theme:            "dracula",
+		Shell:            shell,
+		UndoLimit:        1000,
+		KeyProfile:       "default",
+		TabWidth:         4,
+		FallbackEncoding: "latin1",
+		Exclude:          []string{".git/", ".hg/", ".svn/", ".DS_Store"},
+		Languages: map[string]Language{
+			"go": {Formatter: "gofmt", LSP: "gopls"},
+		},
+	}
+}
+
+// For returns the settings for lang.
+func (c Config) For(lang string) LanguageSettings {
+	s := LanguageSettings{TabWidth: c.TabWidth, InsertSpaces: c.InsertSpaces}
+	l, ok := c.Languages[lang]
+	if !ok {
+		return s
+	}
+	if l.TabWidth > 0 {
+		s.TabWidth = l.TabWidth
+	}
+	if l.InsertSpaces != nil {
+		s.InsertSpaces = *l.InsertSpaces
+	}
+	s.Formatter, s.LSP = l.Formatter, l.LSP
+	return s
+}
+
+// UserPath returns the user settings file.
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gonsole", "config.json"), nil
+}
+
+// ProjectPath returns the settings file of the project containing dir, or
+// "" when no directory from dir upwards has a .gonsole directory.
+func ProjectPath(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, ".gonsole")); err == nil && fi.IsDir() {
+			return filepath.Join(dir, ".gonsole", "config.json")
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Files returns the settings files that apply to the project in dir, in
+// the order they are read. Files that do not exist are included so that
+// creating one can be noticed.
+func Files(dir string) []string {
+	var files []string
+	if p, err := UserPath(); err == nil {
+		files = append(files, p)
+	}
+	if p := ProjectPath(dir); p != "" {
+		files = append(files, p)
+	}
+	return files
+}
+
+// Stamp summarises the size and modification time of the settings files,
+// so that polling can tell when they change.
+func Stamp(dir string) string {
+	var b strings.Builder
+	for _, f := range Files(dir) {
+		fmt.Fprintf(&b, "%s:", f)
+		if fi, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&b, "%d:%d", fi.Size(), fi.ModTime().UnixNano())
+		}
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// Load reads the settings for the project in dir. A file that cannot be
+// parsed is skipped and an invalid setting keeps its default; every such
+// problem is returned.
+func Load(dir string) (Config, []error) {
+	c := Default()
+	var errs []error
+	for _, f := range Files(dir) {
+		if err := c.merge(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if v := os.Getenv("GONSOLE_KEYS"); v != "" {
+		c.KeyProfile = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("GONSOLE_UNDO_LIMIT")); err == nil && v > 0 {
+		c.UndoLimit = v
+	}
+	return c, append(errs, c.validate()...)
+}
+
+// merge applies the settings present in the file at path.
+func (c *Config) merge(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Decode into a copy so that a broken file changes nothing. The
+	// decoder would write into the slice's array, so it gets its own.
+	next := *c
+	next.Exclude = slices.Clone(c.Exclude)
+	next.Languages = nil
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	langs := make(map[string]Language, len(c.Languages))
+	for name, l := range c.Languages {
+		langs[name] = l
+	}
+	for name, l := range next.Languages {
+		cur := langs[name]
+		if l.TabWidth != 0 {
+			cur.TabWidth = l.TabWidth
+		}
+		if l.InsertSpaces != nil {
+			cur.InsertSpaces = l.InsertSpaces
+		}
+		if l.Formatter != "" {
+			cur.Formatter = l.Formatter
+		}
+		if l.LSP != "" {
+			cur.LSP = l.LSP
+		}
+		langs[name] = cur
+	}
+	next.Languages = langs
+	*c = next
+	return nil
+}
+
+// validate resets invalid settings to their defaults and reports them.
+func (c *Config) validate() []error {
+	def := Default()
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if _, ok := styles.Registry[c.Theme]; !ok {
+		bad("theme: unknown style %q", c.Theme)
+		c.Theme = def.Theme
+	}
+	if _, err := exec.LookPath(c.Shell); err != nil {
+		bad("shell: %v", err)
+		c.Shell = def.Shell
+	}
+	if c.TerminalHeight < 0 {
+		bad("terminalHeight: %d is negative", c.TerminalHeight)
+		c.TerminalHeight = def.TerminalHeight
+	}
+	if c.UndoLimit < 1 {
+		bad("undoLimit: must be at least 1, not %d", c.UndoLimit)
+		c.UndoLimit = def.UndoLimit
+	}
+	known := false
+	for _, p := range KeyProfiles {
+		known = known || p == c.KeyProfile
+	}
+	if !known {
+		bad("keyProfile: %q is not one of %s", c.KeyProfile, strings.Join(KeyProfiles, ", "))
+		c.KeyProfile = def.KeyProfile
+	}
+	if c.TabWidth < 1 || c.TabWidth > 16 {
+		bad("tabWidth: %d is outside 1-16", c.TabWidth)
+		c.TabWidth = def.TabWidth
+	}
+	known = false
+	for _, e := range Encodings {
+		known = known || e == c.FallbackEncoding
+	}
+	if !known {
+		bad("fallbackEncoding: %q is not one of %s", c.FallbackEncoding, strings.Join(Encodings, ", "))
+		c.FallbackEncoding = def.FallbackEncoding
+	}
+	var exclude []string
+	for _, e := range c.Exclude {
+		if err := ignore.Check(e); err != nil {
+			bad("exclude: %v", err)
+			continue
+		}
+		exclude = append(exclude, e)
+	}
+	c.Exclude = exclude
+	for name, l := range c.Languages {
+		if l.TabWidth < 0 || l.TabWidth > 16 {
+			bad("languages.%s.tabWidth: %d is outside 1-16", name, l.TabWidth)
+			l.TabWidth = 0
+			c.Languages[name] = l
+		}
+	}
+	return errs
+}
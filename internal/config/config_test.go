@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		exclude []string
+		width   int
+		err     bool
+	}{
+		{"no file", "", []string{"a", "b"}, 4, false},
+		{"overrides", `{"exclude": ["x"], "tabWidth": 8}`, []string{"x"}, 8, false},
+		{"unknown field", `{"exclude": ["x", "y"], "bogus": 1}`, []string{"a", "b"}, 4, true},
+		{"broken", `{"exclude": ["x", "y"], "tabWidth": `, []string{"a", "b"}, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c := Config{TabWidth: 4, Exclude: []string{"a", "b"}}
+			err := c.merge(path)
+			if (err != nil) != tt.err {
+				t.Errorf("merge error = %v, want error %v", err, tt.err)
+			}
+			if !slices.Equal(c.Exclude, tt.exclude) || c.TabWidth != tt.width {
+				t.Errorf("exclude %q, tab width %d, want %q, %d", c.Exclude, c.TabWidth, tt.exclude, tt.width)
+			}
+		})
+	}
+}
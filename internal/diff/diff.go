@@ -0,0 +1,214 @@
+// Package diff compares texts line by line.
+//
+// Lines finds a shortest edit script with Myers' algorithm after setting
+// aside the lines the two texts start and end with, which for the usual
+// comparison of two versions of a file leaves little to search.
+package diff
+
+import "fmt"
+
+// Op says what happens to a line.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is one line of an edit script.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxEdits bounds the search. Texts further apart than this are reported
+// as every line of a deleted and every line of b inserted.
+const maxEdits = 4000
+
+// Lines returns an edit script that turns a into b with as few deleted
+// and inserted lines as possible.
+func Lines(a, b []string) []Line {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var out []Line
+	for _, s := range a[:pre] {
+		out = append(out, Line{Equal, s})
+	}
+	out = append(out, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, s := range a[len(a)-suf:] {
+		out = append(out, Line{Equal, s})
+	}
+	return out
+}
+
+// myers searches for the edit script one edit at a time. v[k] is the
+// furthest x reached on diagonal k = x-y; trace keeps v as it was before
+// each round so that the path can be walked back.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+	limit := min(n+m, maxEdits)
+	off := limit + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return replaceAll(a, b)
+}
+
+func backtrack(trace [][]int, a, b []string) []Line {
+	x, y := len(a), len(b)
+	var rev []Line
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d] // v[i] is diagonal i-d
+		k := x - y
+		prev := k - 1
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prev = k + 1
+		}
+		px := v[prev+d]
+		py := px - prev
+		for x > px && y > py {
+			rev = append(rev, Line{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if x == px {
+			rev = append(rev, Line{Insert, b[y-1]})
+		} else {
+			rev = append(rev, Line{Delete, a[x-1]})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		rev = append(rev, Line{Equal, a[x-1]})
+		x--
+		y--
+	}
+	out := make([]Line, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
+
+func replaceAll(a, b []string) []Line {
+	out := make([]Line, 0, len(a)+len(b))
+	for _, s := range a {
+		out = append(out, Line{Delete, s})
+	}
+	for _, s := range b {
+		out = append(out, Line{Insert, s})
+	}
+	return out
+}
+
+// Changed reports whether script deletes or inserts anything.
+func Changed(script []Line) bool {
+	for _, l := range script {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Unified formats script as the hunks of a unified diff, each change
+// surrounded by up to context unchanged lines.
+func Unified(script []Line, context int) []string {
+	var out []string
+	ai, bi := 0, 0 // line numbers in a and b at script[i]
+	for i := 0; i < len(script); {
+		if script[i].Op == Equal {
+			ai++
+			bi++
+			i++
+			continue
+		}
+		// A hunk starts context lines before the change and runs until
+		// more than twice that many unchanged lines separate two changes.
+		start := i
+		for start > 0 && i-start < context && script[start-1].Op == Equal {
+			start--
+		}
+		end, equal := i, 0
+		for end < len(script) && equal <= 2*context {
+			if script[end].Op == Equal {
+				equal++
+			} else {
+				equal = 0
+			}
+			end++
+		}
+		end -= max(0, equal-context)
+
+		aStart, bStart := ai-(i-start), bi-(i-start)
+		var body []string
+		aLen, bLen := 0, 0
+		for _, l := range script[start:end] {
+			switch l.Op {
+			case Equal:
+				body = append(body, " "+l.Text)
+				aLen++
+				bLen++
+			case Delete:
+				body = append(body, "-"+l.Text)
+				aLen++
+			case Insert:
+				body = append(body, "+"+l.Text)
+				bLen++
+			}
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@", hunkRange(aStart, aLen), hunkRange(bStart, bLen)))
+		out = append(out, body...)
+		for _, l := range script[i:end] {
+			if l.Op != Insert {
+				ai++
+			}
+			if l.Op != Delete {
+				bi++
+			}
+		}
+		i = end
+	}
+	return out
+}
+
+// hunkRange formats the 0-based start and length of a hunk's lines the
+// way diff(1) does.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
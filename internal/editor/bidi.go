@@ -0,0 +1,315 @@
+package editor
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Lines are stored in logical order. Lines that contain right-to-left text
+// are drawn in visual order using the Unicode Bidirectional Algorithm, and
+// the left/right keys walk that visual order rather than the logical one.
+
+// hasRTL reports whether s contains any character with strong or numeric
+// right-to-left directionality.
+func hasRTL(s string) bool {
+	for _, r := range s {
+		if r < 0x0590 {
+			continue
+		}
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.R, bidi.AL, bidi.AN:
+			return true
+		}
+	}
+	return false
+}
+
+// isRTLParagraph applies rules P2 and P3: the first strong character
+// decides the base direction, defaulting to left-to-right.
+func isRTLParagraph(s string) bool {
+	for _, r := range s {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// bidiLayout is the visual arrangement of one line.
+type bidiLayout struct {
+	bounds []int // grapheme cluster boundaries, see graphemeBounds
+	order  []int // cluster indexes from left to right
+	rtl    bool  // base direction; the end-of-line slot is on the left
+}
+
+// layoutLine returns the visual layout of line, or nil when it can be drawn
+// in logical order.
+func (m Model) layoutLine(line string) *bidiLayout {
+	if m.forceLTR || !hasRTL(line) {
+		return nil
+	}
+	var p bidi.Paragraph
+	if _, err := p.SetString(line); err != nil {
+		return nil
+	}
+	o, err := p.Order()
+	if err != nil || o.NumRuns() == 0 {
+		return nil
+	}
+
+	bounds := graphemeBounds(line)
+	n := len(bounds) - 1
+	rtl := isRTLParagraph(line)
+
+	// Map every rune to the cluster that contains it.
+	runeCluster := make([]int, 0, len(line))
+	for c := 0; c < n; c++ {
+		for range line[bounds[c]:bounds[c+1]] {
+			runeCluster = append(runeCluster, c)
+		}
+	}
+
+	// The package reports runs with their direction but not their embedding
+	// level. Without explicit embeddings only levels 0-2 occur: in a
+	// right-to-left paragraph every left-to-right run sits at level 2, and in
+	// a left-to-right paragraph numbers that follow right-to-left text do.
+	levels := make([]int, n)
+	for i := 0; i < o.NumRuns(); i++ {
+		run := o.Run(i)
+		start, end := run.Pos()
+		lvl := 0
+		switch {
+		case run.Direction() == bidi.RightToLeft:
+			lvl = 1
+		case rtl:
+			lvl = 2
+		}
+		for r := start; r <= end && r < len(runeCluster); r++ {
+			levels[runeCluster[r]] = lvl
+		}
+		if lvl == 0 && i > 0 {
+			prev := o.Run(i - 1)
+			if prev.Direction() == bidi.RightToLeft {
+				k := leadingNumber([]rune(run.String()))
+				for r := start; r < start+k && r < len(runeCluster); r++ {
+					levels[runeCluster[r]] = 2
+				}
+			}
+		}
+	}
+
+	// Rule L2: from the highest level down to the lowest odd level, reverse
+	// every contiguous sequence at that level or above.
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	highest, lowest := 0, 2
+	for _, l := range levels {
+		highest = max(highest, l)
+		lowest = min(lowest, l)
+	}
+	for lvl := highest; lvl >= lowest|1; lvl-- {
+		for i := 0; i < n; {
+			if levels[order[i]] < lvl {
+				i++
+				continue
+			}
+			j := i
+			for j < n && levels[order[j]] >= lvl {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = j
+		}
+	}
+	return &bidiLayout{bounds: bounds, order: order, rtl: rtl}
+}
+
+// leadingNumber returns how many runes at the start of runes form a number,
+// including separators between its digits.
+func leadingNumber(runes []rune) int {
+	n := 0
+	for i, r := range runes {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.EN, bidi.AN:
+			n = i + 1
+		case bidi.ES, bidi.CS, bidi.ET, bidi.NSM, bidi.BN:
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// slots lists the cursor stops of the line from left to right. A stop is a
+// cluster index, or the cluster count for the end-of-line position.
+func (l *bidiLayout) slots() []int {
+	n := len(l.order)
+	if l.rtl {
+		return append([]int{n}, l.order...)
+	}
+	return append(append([]int{}, l.order...), n)
+}
+
+// moveVisual returns the logical column reached by moving the cursor one
+// slot to the left (delta -1) or right (delta +1).
+func (l *bidiLayout) moveVisual(col, delta int) int {
+	slots := l.slots()
+	for i, c := range slots {
+		if c == col {
+			if j := i + delta; j >= 0 && j < len(slots) {
+				return slots[j]
+			}
+			return col
+		}
+	}
+	return col
+}
+
+// logicalLayout arranges line in logical order, for lines that need
+// per-cluster rendering without any reordering.
+func logicalLayout(line string) *bidiLayout {
+	bounds := graphemeBounds(line)
+	order := make([]int, len(bounds)-1)
+	for i := range order {
+		order[i] = i
+	}
+	return &bidiLayout{bounds: bounds, order: order}
+}
+
+// renderLayout draws line y cluster by cluster in the order given by l,
+// overlaying the cursor, the selected ranges and search matches. Syntax
+// colours come from tokenising the logical text so reordering never
+// confuses the lexer.
+func (m Model) renderLayout(line string, y int, l *bidiLayout, ranges [][2]int) string {
+	n := len(l.order)
+	cursors := m.caretCols(y)
+	cursorAtEnd := false
+	for c := range cursors {
+		cursorAtEnd = cursorAtEnd || c >= n
+	}
+	lineStart := m.buf.LineStart(y)
+	selected := func(off int) bool {
+		for _, r := range ranges {
+			if lineStart+off >= r[0] && lineStart+off < r[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	tokens := make([]chroma.TokenType, len(line))
+	iterator, err := m.lexerFor(line).Tokenise(nil, line)
+	if err == nil {
+		pos := 0
+		for tok := iterator(); tok != chroma.EOF; tok = iterator() {
+			for i := 0; i < len(tok.Value) && pos < len(tokens); i++ {
+				tokens[pos] = tok.Type
+				pos++
+			}
+		}
+	}
+
+	var matches [][2]int
+	if m.searchQuery != "" {
+		for idx := 0; ; {
+			from, to := indexFold(line[idx:], m.searchQuery)
+			if from == -1 {
+				break
+			}
+			matches = append(matches, [2]int{idx + from, idx + to})
+			idx += to
+		}
+	}
+	inMatch := func(off int) bool {
+		for _, r := range matches {
+			if off >= r[0] && off < r[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var b strings.Builder
+	if cursorAtEnd && l.rtl {
+		b.WriteString(cursorStyle.Render(" "))
+	}
+	for i := 0; i < n; {
+		c := l.order[i]
+		cluster := line[l.bounds[c]:l.bounds[c+1]]
+		switch {
+		case cursors[c]:
+			b.WriteString(cursorStyle.Render(cluster))
+			i++
+			continue
+		case selected(l.bounds[c]):
+			b.WriteString(selectionStyle.Render(cluster))
+			i++
+			continue
+		case inMatch(l.bounds[c]):
+			b.WriteString(highlightStyle.Render(cluster))
+			i++
+			continue
+		}
+		// Group neighbours that share a token type into one styled span.
+		tt := tokens[l.bounds[c]]
+		var span strings.Builder
+		for ; i < n; i++ {
+			c = l.order[i]
+			if cursors[c] || selected(l.bounds[c]) || inMatch(l.bounds[c]) || tokens[l.bounds[c]] != tt {
+				break
+			}
+			span.WriteString(line[l.bounds[c]:l.bounds[c+1]])
+		}
+		b.WriteString(m.highlightToken(chroma.Token{Type: tt, Value: span.String()}))
+	}
+	if cursorAtEnd && !l.rtl {
+		b.WriteString(cursorStyle.Render(" "))
+	} else if selected(len(line)) {
+		// Show the selected line break.
+		b.WriteString(selectionStyle.Render(" "))
+	}
+	return b.String()
+}
+
+// highlightToken renders a single token with the editor colour scheme.
+func (m Model) highlightToken(tok chroma.Token) string {
+	var buf bytes.Buffer
+	if err := formatters.TTY.Format(&buf, m.codeStyle(), chroma.Literator(tok)); err != nil {
+		return tok.Value
+	}
+	return buf.String()
+}
+
+// moveHorizontal moves the cursor one step left (-1) or right (+1) as seen
+// on screen.
+func (m *Model) moveHorizontal(delta int) {
+	line := m.buf.Line(m.cursorY)
+	n := graphemeCount(line)
+	m.cursorX = min(m.cursorX, n)
+	if l := m.layoutLine(line); l != nil {
+		m.cursorX = l.moveVisual(m.cursorX, delta)
+		return
+	}
+	m.cursorX = max(0, min(n, m.cursorX+delta))
+}
+
+func (m Model) bidiIndicator() string {
+	if m.forceLTR {
+		return " LTR"
+	}
+	return ""
+}
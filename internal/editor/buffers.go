@@ -0,0 +1,419 @@
+package editor
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/buffer"
+	"github.com/Mohammad-Alipour/Gonsole/internal/editorconfig"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	tabStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#2D2D2D")).
+			Foreground(lipgloss.Color("#969696")).
+			Padding(0, 1)
+
+	activeTabStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#1E1E1E")).
+			Foreground(lipgloss.Color("#FFFFFF")).
+			Bold(true).
+			Padding(0, 1)
+
+	tabBarStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#252526"))
+)
+
+// maxClosedTabs is how many closed tabs can be reopened.
+const maxClosedTabs = 20
+
+// document is an open file with everything that belongs to it: its text
+// and history, and where it was last viewed. The active document lives in
+// the Model's own fields, which the rest of the editor works on; the
+// others wait here until they are switched to.
+type document struct {
+	file          string
+	lang          string
+	buf           buffer.Buffer
+	history       history
+	diskHash      string
+	ec            editorconfig.Properties
+	format        fileFormat
+	formatChanged bool
+	swapPath      string
+	swapped       *undoNode
+	view          docView // where it was last viewed
+}
+
+// docView is where a document is viewed: its cursors and scroll position.
+type docView struct {
+	cursorX, cursorY int
+	scrollTop        int
+	sel              selection
+	extra            []caret
+}
+
+// closedTab is enough of a closed document to open it again where it was.
+type closedTab struct {
+	file string
+	view docView
+}
+
+func (d document) modified() bool {
+	return d.history.current != d.history.saved || d.formatChanged
+}
+
+// title is the name shown on the document's tab.
+func (d document) title() string {
+	if d.file == "" {
+		return "Untitled"
+	}
+	return filepath.Base(d.file)
+}
+
+// current returns the active document as it is now.
+func (m *Model) current() document {
+	return document{
+		file:          m.file,
+		lang:          m.lang,
+		buf:           m.buf,
+		history:       m.history,
+		diskHash:      m.diskHash,
+		ec:            m.ec,
+		format:        m.format,
+		formatChanged: m.formatChanged,
+		swapPath:      m.swapPath,
+		swapped:       m.swapped,
+		view:          m.currentView(),
+	}
+}
+
+// currentView returns the view of the focused pane as it is now.
+func (m *Model) currentView() docView {
+	return docView{cursorX: m.cursorX, cursorY: m.cursorY, scrollTop: m.scrollTop, sel: m.sel, extra: m.extra}
+}
+
+// setView moves the cursors and scroll position to v, clamped to the
+// text, which may have been edited in another pane since.
+func (m *Model) setView(v docView) {
+	last := m.buf.LineCount() - 1
+	clamp := func(p cursorPos) cursorPos {
+		p.y = max(0, min(p.y, last))
+		p.x = max(0, min(p.x, graphemeCount(m.buf.Line(p.y))))
+		return p
+	}
+	c := clamp(cursorPos{v.cursorX, v.cursorY})
+	m.cursorX, m.cursorY = c.x, c.y
+	m.scrollTop = max(0, min(v.scrollTop, last))
+	m.sel = v.sel
+	m.sel.anchor = clamp(m.sel.anchor)
+	m.extra = nil
+	for _, e := range v.extra {
+		e.pos = clamp(e.pos)
+		e.sel.anchor = clamp(e.sel.anchor)
+		m.extra = append(m.extra, e)
+	}
+}
+
+// stash stores the active document back in its slot and the view in the
+// focused pane.
+func (m *Model) stash() {
+	d := m.current()
+	*m.docs[m.active] = d
+	m.focus.pane.view = d.view
+}
+
+// use makes d the document the Model's fields hold.
+func (m *Model) use(d *document) {
+	m.file, m.lang, m.buf, m.history = d.file, d.lang, d.buf, d.history
+	m.diskHash, m.ec, m.format, m.formatChanged = d.diskHash, d.ec, d.format, d.formatChanged
+	m.swapPath, m.swapped = d.swapPath, d.swapped
+	m.setView(d.view)
+}
+
+// doc returns document i as it is now.
+func (m *Model) doc(i int) document {
+	if i == m.active {
+		return m.current()
+	}
+	return *m.docs[i]
+}
+
+// newDocument is an empty, untitled document.
+func (m *Model) newDocument() *document {
+	return &document{
+		lang:    "plaintext",
+		buf:     buffer.New(""),
+		history: newHistory(m.cfg.UndoLimit),
+		format:  fileFormat{encoding: "utf-8", eol: "\n"},
+	}
+}
+
+// switchTo makes document i the active one.
+func (m *Model) switchTo(i int) {
+	if i == m.active || i < 0 || i >= len(m.docs) {
+		return
+	}
+	m.stash()
+	m.active = i
+	m.use(m.docs[i])
+	m.focus.pane.doc = m.docs[i]
+	m.touch(m.docs[i])
+	m.history.seal()
+	if m.searchQuery != "" {
+		m.updateSearchResults()
+	}
+	m.ensureCursorVisible()
+}
+
+// touch moves d to the front of the recently used list.
+func (m *Model) touch(d *document) {
+	for i, x := range m.mru {
+		if x == d {
+			m.mru = append(m.mru[:i], m.mru[i+1:]...)
+			break
+		}
+	}
+	m.mru = append([]*document{d}, m.mru...)
+}
+
+func (m *Model) indexOf(d *document) int {
+	for i, x := range m.docs {
+		if x == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// findDocument returns the index of the document open on path, or -1.
+func (m *Model) findDocument(path string) int {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return -1
+	}
+	for i := range m.docs {
+		if f := m.doc(i).file; f != "" {
+			if other, err := filepath.Abs(f); err == nil && other == abs {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// openFile shows the file at path, switching to its tab when it is open
+// already and opening a new tab otherwise. An untouched untitled document
+// is replaced rather than kept beside it.
+func (m *Model) openFile(path string) {
+	if i := m.findDocument(path); i >= 0 {
+		m.switchTo(i)
+		return
+	}
+	if cur := m.current(); cur.file != "" || cur.modified() || cur.buf.Len() > 0 {
+		m.stash()
+		m.docs = append(m.docs, m.newDocument())
+		m.active = len(m.docs) - 1
+		m.use(m.docs[m.active])
+	} else {
+		m.use(m.newDocument())
+	}
+	m.clearSelection()
+	m.clearCarets()
+	m.file = path
+	m.detectLang(path)
+	m.loadFile(path)
+	m.checkRecovery()
+	m.focus.pane.doc = m.docs[m.active]
+	m.stash()
+	m.touch(m.docs[m.active])
+	if m.searchQuery != "" {
+		m.updateSearchResults()
+	}
+	m.syncWatches()
+}
+
+// closeTab closes document i, asking first when it has unsaved changes.
+func (m *Model) closeTab(i int) tea.Cmd {
+	if i < 0 || i >= len(m.docs) {
+		return nil
+	}
+	m.switchTo(i)
+	return m.confirmDiscard(dropTab)
+}
+
+// dropTab closes the active document, discarding unsaved changes.
+func dropTab(m *Model) tea.Cmd {
+	_ = m.saveUndoFile()
+	m.removeSwapFile()
+	d := m.docs[m.active]
+	if m.file != "" {
+		m.closed = append(m.closed, closedTab{file: m.file, view: m.currentView()})
+		if len(m.closed) > maxClosedTabs {
+			m.closed = m.closed[1:]
+		}
+	}
+	for j, x := range m.mru {
+		if x == d {
+			m.mru = append(m.mru[:j], m.mru[j+1:]...)
+			break
+		}
+	}
+	m.docs = append(m.docs[:m.active], m.docs[m.active+1:]...)
+	if len(m.docs) == 0 {
+		m.docs = []*document{m.newDocument()}
+		m.mru = []*document{m.docs[0]}
+	}
+	next := m.docs[min(m.active, len(m.docs)-1)]
+	if len(m.mru) > 0 {
+		next = m.mru[0]
+	}
+	m.active = m.indexOf(next)
+	m.use(next)
+	for _, l := range m.root.leaves() {
+		if l.pane.doc == d {
+			l.pane.doc, l.pane.view = next, next.view
+		}
+	}
+	m.ensureCursorVisible()
+	m.syncWatches()
+	return nil
+}
+
+// reopenClosedTab opens the most recently closed tab again.
+func (m *Model) reopenClosedTab() {
+	if len(m.closed) == 0 {
+		m.status = "No closed tabs"
+		return
+	}
+	t := m.closed[len(m.closed)-1]
+	m.closed = m.closed[:len(m.closed)-1]
+	m.openFile(t.file)
+	m.setView(t.view)
+	m.ensureCursorVisible()
+}
+
+// cycleTab moves delta tabs along the tab bar, wrapping around.
+func (m *Model) cycleTab(delta int) {
+	n := len(m.docs)
+	m.switchTo(((m.active+delta)%n + n) % n)
+}
+
+// switchToRecent goes back to the document used before the current one.
+func (m *Model) switchToRecent() {
+	if len(m.mru) < 2 {
+		return
+	}
+	m.switchTo(m.indexOf(m.mru[1]))
+}
+
+// openTabPalette lists the open documents, most recently used first.
+func (m *Model) openTabPalette() {
+	var items []paletteItem
+	for _, d := range m.mru {
+		i := m.indexOf(d)
+		doc := m.doc(i)
+		label := doc.title()
+		if doc.modified() {
+			label = "● " + label
+		}
+		detail := doc.file
+		if dir, err := filepath.Rel(m.dir, doc.file); err == nil && doc.file != "" {
+			detail = dir
+		}
+		items = append(items, paletteItem{label: label, detail: detail, run: func(m *Model) tea.Cmd {
+			m.switchTo(m.indexOf(d))
+			return nil
+		}})
+	}
+	m.showPalette("Open editors:", items)
+}
+
+// confirmQuit asks about every document with unsaved changes in turn,
+// starting at from, and quits once each was saved or discarded.
+func (m *Model) confirmQuit(from int) tea.Cmd {
+	for i := from; i < len(m.docs); i++ {
+		if d := m.doc(i); d.modified() {
+			m.switchTo(i)
+			return m.confirmDiscard(func(m *Model) tea.Cmd {
+				return m.confirmQuit(i + 1)
+			})
+		}
+	}
+	return quit(m)
+}
+
+// tabTitles returns the label of every tab. Documents with the same file
+// name are told apart by their directory.
+func (m Model) tabTitles() []string {
+	count := map[string]int{}
+	for i := range m.docs {
+		count[m.doc(i).title()]++
+	}
+	titles := make([]string, len(m.docs))
+	for i := range m.docs {
+		d := m.doc(i)
+		t := d.title()
+		if count[t] > 1 && d.file != "" {
+			t = filepath.Join(filepath.Base(filepath.Dir(d.file)), t)
+		}
+		if d.modified() {
+			t = "● " + t
+		}
+		titles[i] = t
+	}
+	return titles
+}
+
+// tabSpans returns the screen columns each tab covers and the index of the
+// first tab drawn; tabs to the left are scrolled away so that the active
+// one fits.
+func (m Model) tabSpans() (first int, spans [][2]int) {
+	titles := m.tabTitles()
+	widths := make([]int, len(titles))
+	for i, t := range titles {
+		widths[i] = displayWidth(t) + 2
+	}
+	total := 0
+	for _, w := range widths[:m.active+1] {
+		total += w
+	}
+	for total > m.width && first < m.active {
+		total -= widths[first]
+		first++
+	}
+	x := 0
+	for i := first; i < len(titles); i++ {
+		spans = append(spans, [2]int{x, x + widths[i]})
+		x += widths[i]
+	}
+	return first, spans
+}
+
+// renderTabs draws the tab bar.
+func (m Model) renderTabs() string {
+	titles := m.tabTitles()
+	first, _ := m.tabSpans()
+	var b strings.Builder
+	for i := first; i < len(titles); i++ {
+		style := tabStyle
+		if i == m.active {
+			style = activeTabStyle
+		}
+		b.WriteString(style.Render(titles[i]))
+	}
+	return tabBarStyle.Width(m.width).MaxHeight(1).MaxWidth(m.width).Render(b.String())
+}
+
+// tabAt returns the tab drawn at screen column x, or -1.
+func (m Model) tabAt(x int) int {
+	first, spans := m.tabSpans()
+	for i, s := range spans {
+		if x >= s[0] && x < s[1] {
+			return first + i
+		}
+	}
+	return -1
+}
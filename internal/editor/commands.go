@@ -0,0 +1,652 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/keymap"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// command is a named editor action. Keys reach commands through the
+// keymap, so every shortcut can be rebound by name.
+type command struct {
+	name  string
+	title string
+	// when reports whether the command applies right now. A key whose
+	// command does not apply falls back to its binding in the next scope.
+	when func(m *Model) bool
+	// perCaret commands run once for every cursor, as one undo step.
+	perCaret bool
+	// hidden commands only make sense on a key and stay out of the palette.
+	hidden bool
+	run    func(m *Model) tea.Cmd
+}
+
+var builtinCommands = []command{
+	{name: "app.quit", title: "Quit", run: func(m *Model) tea.Cmd {
+		return m.confirmQuit(0)
+	}},
+	{name: "file.save", title: "Save File", run: func(m *Model) tea.Cmd {
+		m.saveFile()
+		return nil
+	}},
+	{name: "terminal.toggle", title: "Toggle Terminal", run: func(m *Model) tea.Cmd {
+		m.showTerminal = !m.showTerminal
+		m.resize()
+		if m.showTerminal {
+			return m.readPtyOnce()
+		}
+		return nil
+	}},
+	{name: "search.open", title: "Find", run: func(m *Model) tea.Cmd {
+		m.openSearch()
+		return nil
+	}},
+	{name: "search.next", title: "Find Next", hidden: true, run: func(m *Model) tea.Cmd {
+		if len(m.searchResults) > 0 {
+			m.searchIndex = (m.searchIndex + 1) % len(m.searchResults)
+			m.cursorY = m.searchResults[m.searchIndex]
+		}
+		return nil
+	}},
+	{name: "search.close", title: "Close Search", hidden: true, run: func(m *Model) tea.Cmd {
+		m.searchActive = false
+		return nil
+	}},
+	{name: "edit.undo", title: "Undo", run: func(m *Model) tea.Cmd {
+		m.undo()
+		return nil
+	}},
+	{name: "edit.redo", title: "Redo", run: func(m *Model) tea.Cmd {
+		m.redo()
+		return nil
+	}},
+	{name: "undo.tree", title: "Show Undo Tree", run: func(m *Model) tea.Cmd {
+		*m = m.openUndoTree()
+		return nil
+	}},
+	{name: "extensions.open", title: "Open Extension Manager", run: func(m *Model) tea.Cmd {
+		m.showExtensions = true
+		return nil
+	}},
+	{name: "extensions.close", title: "Close Extension Manager", hidden: true, run: func(m *Model) tea.Cmd {
+		m.showExtensions = false
+		return nil
+	}},
+	{name: "view.toggleFocus", title: "Switch Between Sidebar and Editor", run: func(m *Model) tea.Cmd {
+		if m.mode == "editor" {
+			m.mode = "sidebar"
+		} else {
+			m.mode = "editor"
+		}
+		return nil
+	}},
+	{name: "view.focusEditor", title: "Focus Editor", run: func(m *Model) tea.Cmd {
+		m.mode = "editor"
+		return nil
+	}},
+	{name: "view.toggleLTR", title: "Toggle Forced Left-to-Right Display", run: func(m *Model) tea.Cmd {
+		m.forceLTR = !m.forceLTR
+		if m.forceLTR {
+			m.status = "Bidi: forced left-to-right"
+		} else {
+			m.status = "Bidi: automatic"
+		}
+		return nil
+	}},
+	{name: "palette.open", title: "Show All Commands", hidden: true, run: func(m *Model) tea.Cmd {
+		m.openPalette()
+		return nil
+	}},
+	{name: "language.change", title: "Change Language Mode", run: func(m *Model) tea.Cmd {
+		m.openLanguagePalette()
+		return nil
+	}},
+	{name: "tab.next", title: "Next Tab", run: func(m *Model) tea.Cmd {
+		m.cycleTab(1)
+		return nil
+	}},
+	{name: "tab.previous", title: "Previous Tab", run: func(m *Model) tea.Cmd {
+		m.cycleTab(-1)
+		return nil
+	}},
+	{name: "tab.switchRecent", title: "Switch to Previously Used Tab", run: func(m *Model) tea.Cmd {
+		m.switchToRecent()
+		return nil
+	}},
+	{name: "tab.list", title: "Show Open Editors", run: func(m *Model) tea.Cmd {
+		m.openTabPalette()
+		return nil
+	}},
+	{name: "tab.close", title: "Close Tab", run: func(m *Model) tea.Cmd {
+		return m.closeTab(m.active)
+	}},
+	{name: "tab.reopenClosed", title: "Reopen Closed Tab", run: func(m *Model) tea.Cmd {
+		m.reopenClosedTab()
+		return nil
+	}},
+	{name: "pane.splitRight", title: "Split Editor Right", run: func(m *Model) tea.Cmd {
+		m.splitPane(splitVertical)
+		return nil
+	}},
+	{name: "pane.splitDown", title: "Split Editor Down", run: func(m *Model) tea.Cmd {
+		m.splitPane(splitHorizontal)
+		return nil
+	}},
+	{name: "pane.focusLeft", title: "Focus Left Pane", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.focusDirection(-1, 0)
+		return nil
+	}},
+	{name: "pane.focusRight", title: "Focus Right Pane", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.focusDirection(1, 0)
+		return nil
+	}},
+	{name: "pane.focusUp", title: "Focus Pane Above", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.focusDirection(0, -1)
+		return nil
+	}},
+	{name: "pane.focusDown", title: "Focus Pane Below", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.focusDirection(0, 1)
+		return nil
+	}},
+	{name: "pane.focusNext", title: "Focus Next Pane", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.focusNextPane(1)
+		return nil
+	}},
+	{name: "pane.grow", title: "Grow Pane", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.resizePane(splitNone, paneResizeBy)
+		return nil
+	}},
+	{name: "pane.shrink", title: "Shrink Pane", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.resizePane(splitNone, -paneResizeBy)
+		return nil
+	}},
+	{name: "pane.equalize", title: "Make Panes Equal Size", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.equalizePanes()
+		return nil
+	}},
+	{name: "pane.close", title: "Close Pane", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.closePane()
+		return nil
+	}},
+	{name: "pane.only", title: "Close Other Panes", when: isSplit, run: func(m *Model) tea.Cmd {
+		m.onlyPane()
+		return nil
+	}},
+	{name: "file.changeLineEndings", title: "Change End of Line Sequence", run: func(m *Model) tea.Cmd {
+		m.openLineEndingPalette()
+		return nil
+	}},
+	{name: "file.changeEncoding", title: "Change File Encoding", run: func(m *Model) tea.Cmd {
+		m.openEncodingPalette(false)
+		return nil
+	}},
+	{name: "file.reopenWithEncoding", title: "Reopen with Encoding", when: func(m *Model) bool { return m.file != "" }, run: func(m *Model) tea.Cmd {
+		m.openEncodingPalette(true)
+		return nil
+	}},
+	{name: "editor.format", title: "Format Document", run: func(m *Model) tea.Cmd {
+		return m.formatDocument()
+	}},
+	{name: "keys.cycleProfile", title: "Switch Key Profile", run: func(m *Model) tea.Cmd {
+		for i, p := range keyProfiles {
+			if p == m.keyProfile {
+				m.setKeyProfile(keyProfiles[(i+1)%len(keyProfiles)])
+				break
+			}
+		}
+		m.status = "Keys: " + m.keyProfile
+		return nil
+	}},
+
+	{name: "sidebar.up", title: "Sidebar: Previous Entry", hidden: true, run: func(m *Model) tea.Cmd {
+		m.selectRow(m.selectedIdx - 1)
+		return nil
+	}},
+	{name: "sidebar.down", title: "Sidebar: Next Entry", hidden: true, run: func(m *Model) tea.Cmd {
+		m.selectRow(m.selectedIdx + 1)
+		return nil
+	}},
+	{name: "sidebar.first", title: "Sidebar: First Entry", hidden: true, run: func(m *Model) tea.Cmd {
+		m.selectRow(0)
+		return nil
+	}},
+	{name: "sidebar.last", title: "Sidebar: Last Entry", hidden: true, run: func(m *Model) tea.Cmd {
+		m.selectRow(len(m.sidebarRows()) - 1)
+		return nil
+	}},
+	{name: "sidebar.pageUp", title: "Sidebar: Page Up", hidden: true, run: func(m *Model) tea.Cmd {
+		m.selectRow(m.selectedIdx - m.sidebarHeight())
+		return nil
+	}},
+	{name: "sidebar.pageDown", title: "Sidebar: Page Down", hidden: true, run: func(m *Model) tea.Cmd {
+		m.selectRow(m.selectedIdx + m.sidebarHeight())
+		return nil
+	}},
+	{name: "sidebar.open", title: "Sidebar: Open Entry", hidden: true, run: func(m *Model) tea.Cmd {
+		return m.openSidebarEntry()
+	}},
+	{name: "sidebar.expand", title: "Sidebar: Expand Folder", hidden: true, run: func(m *Model) tea.Cmd {
+		m.expandSelected()
+		return nil
+	}},
+	{name: "sidebar.collapse", title: "Sidebar: Collapse Folder", hidden: true, run: func(m *Model) tea.Cmd {
+		m.collapseSelected()
+		return nil
+	}},
+	{name: "sidebar.parent", title: "Sidebar: Go to Parent Folder", run: func(m *Model) tea.Cmd {
+		m.sidebarParent()
+		return nil
+	}},
+	{name: "sidebar.refresh", title: "Sidebar: Refresh", run: func(m *Model) tea.Cmd {
+		m.refreshTree()
+		return nil
+	}},
+	{name: "sidebar.newFile", title: "Sidebar: New File", run: func(m *Model) tea.Cmd {
+		m.newEntry(false)
+		return nil
+	}},
+	{name: "sidebar.newFolder", title: "Sidebar: New Folder", run: func(m *Model) tea.Cmd {
+		m.newEntry(true)
+		return nil
+	}},
+	{name: "sidebar.rename", title: "Sidebar: Rename or Move", when: hasSidebarEntry, run: func(m *Model) tea.Cmd {
+		m.renameEntry()
+		return nil
+	}},
+	{name: "sidebar.duplicate", title: "Sidebar: Duplicate", when: hasSidebarEntry, run: func(m *Model) tea.Cmd {
+		m.duplicateEntry()
+		return nil
+	}},
+	{name: "sidebar.delete", title: "Sidebar: Move to Trash", when: hasSidebarEntry, run: func(m *Model) tea.Cmd {
+		m.deleteEntry()
+		return nil
+	}},
+	{name: "sidebar.undoDelete", title: "Sidebar: Undo Move to Trash", when: func(m *Model) bool { return len(m.trashed) > 0 }, run: func(m *Model) tea.Cmd {
+		m.undoDelete()
+		return nil
+	}},
+	{name: "sidebar.toggleHidden", title: "Toggle Hidden Files", run: func(m *Model) tea.Cmd {
+		m.toggleHidden()
+		return nil
+	}},
+	{name: "file.goTo", title: "Go to File", run: func(m *Model) tea.Cmd {
+		return m.openFileFinder()
+	}},
+	{name: "search.inFiles", title: "Find in Files", run: func(m *Model) tea.Cmd {
+		m.findInFiles()
+		return nil
+	}},
+	{name: "sidebar.reveal", title: "Reveal Active File in Sidebar", when: func(m *Model) bool { return m.file != "" }, run: func(m *Model) tea.Cmd {
+		m.revealFile()
+		return nil
+	}},
+
+	{name: "cursor.up", title: "Cursor Up", perCaret: true, hidden: true, run: motion(false, func(m *Model) { m.moveVertical(-1) })},
+	{name: "cursor.down", title: "Cursor Down", perCaret: true, hidden: true, run: motion(false, func(m *Model) { m.moveVertical(1) })},
+	{name: "cursor.left", title: "Cursor Left", perCaret: true, hidden: true, run: motion(false, func(m *Model) { m.moveHorizontal(-1) })},
+	{name: "cursor.right", title: "Cursor Right", perCaret: true, hidden: true, run: motion(false, func(m *Model) { m.moveHorizontal(1) })},
+	{name: "cursor.lineStart", title: "Cursor to Line Start", perCaret: true, hidden: true, run: motion(false, lineStart)},
+	{name: "cursor.lineEnd", title: "Cursor to Line End", perCaret: true, hidden: true, run: motion(false, lineEnd)},
+	{name: "select.up", title: "Select Up", perCaret: true, hidden: true, run: motion(true, func(m *Model) { m.moveVertical(-1) })},
+	{name: "select.down", title: "Select Down", perCaret: true, hidden: true, run: motion(true, func(m *Model) { m.moveVertical(1) })},
+	{name: "select.left", title: "Select Left", perCaret: true, hidden: true, run: motion(true, func(m *Model) { m.moveHorizontal(-1) })},
+	{name: "select.right", title: "Select Right", perCaret: true, hidden: true, run: motion(true, func(m *Model) { m.moveHorizontal(1) })},
+	{name: "select.lineStart", title: "Select to Line Start", perCaret: true, hidden: true, run: motion(true, lineStart)},
+	{name: "select.lineEnd", title: "Select to Line End", perCaret: true, hidden: true, run: motion(true, lineEnd)},
+	{name: "select.all", title: "Select All", run: func(m *Model) tea.Cmd {
+		m.clearCarets()
+		m.selectAll()
+		return nil
+	}},
+	{name: "select.clear", title: "Clear Selection and Extra Cursors", when: func(m *Model) bool {
+		return m.sel.active || len(m.extra) > 0
+	}, run: func(m *Model) tea.Cmd {
+		m.clearCarets()
+		m.clearSelection()
+		return nil
+	}},
+	{name: "cursor.addNextOccurrence", title: "Add Cursor at Next Occurrence", run: func(m *Model) tea.Cmd {
+		m.addNextOccurrence()
+		return nil
+	}},
+	{name: "cursor.addAbove", title: "Add Cursor Above", run: func(m *Model) tea.Cmd {
+		m.addCaretVertical(-1)
+		return nil
+	}},
+	{name: "cursor.addBelow", title: "Add Cursor Below", run: func(m *Model) tea.Cmd {
+		m.addCaretVertical(1)
+		return nil
+	}},
+
+	{name: "edit.newline", title: "Insert Line Break", perCaret: true, hidden: true, run: func(m *Model) tea.Cmd {
+		if !m.replaceSelection("\n") {
+			m.newline()
+		}
+		return nil
+	}},
+	{name: "edit.deleteLeft", title: "Delete Left", perCaret: true, hidden: true, run: func(m *Model) tea.Cmd {
+		if !m.replaceSelection("") {
+			m.backspace()
+		}
+		return nil
+	}},
+	{name: "edit.copy", title: "Copy", when: hasSelection, run: func(m *Model) tea.Cmd {
+		return m.copySelections("Copied")
+	}},
+	{name: "edit.cut", title: "Cut", when: hasSelection, run: func(m *Model) tea.Cmd {
+		cmd := m.copySelections("Cut")
+		m.forEachCaret(func(int) { m.replaceSelection("") })
+		return cmd
+	}},
+	{name: "edit.paste", title: "Paste", run: func(m *Model) tea.Cmd {
+		return m.readClipboard(func(m *Model, text string) {
+			if len(m.extra) > 0 {
+				m.pasteAll(text)
+			} else {
+				m.pasteText(text)
+			}
+		})
+	}},
+	{name: "edit.indent", title: "Indent", perCaret: true, run: func(m *Model) tea.Cmd {
+		if m.sel.active {
+			m.indentLines(false)
+		} else {
+			m.insertTab()
+		}
+		return nil
+	}},
+	{name: "edit.outdent", title: "Outdent", run: func(m *Model) tea.Cmd {
+		m.indentLines(true)
+		return nil
+	}},
+}
+
+// commands holds every registered command in registration order, which
+// is the order the palette lists them in.
+var (
+	commands     []command
+	commandIndex = map[string]int{}
+)
+
+func init() {
+	for _, c := range builtinCommands {
+		registerCommand(c)
+	}
+}
+
+// registerCommand adds c, replacing any command of the same name.
+func registerCommand(c command) {
+	if i, ok := commandIndex[c.name]; ok {
+		commands[i] = c
+		return
+	}
+	commandIndex[c.name] = len(commands)
+	commands = append(commands, c)
+}
+
+// lookupCommand returns the named command, or nil.
+func lookupCommand(name string) *command {
+	if i, ok := commandIndex[name]; ok {
+		return &commands[i]
+	}
+	return nil
+}
+
+// motion builds a cursor command that drops the selection, or extends it
+// when selecting is set, before moving.
+func motion(selecting bool, move func(m *Model)) func(m *Model) tea.Cmd {
+	return func(m *Model) tea.Cmd {
+		m.history.seal()
+		if selecting {
+			m.startSelection()
+		} else {
+			m.clearSelection()
+		}
+		move(m)
+		return nil
+	}
+}
+
+func lineStart(m *Model) { m.cursorX = 0 }
+
+func lineEnd(m *Model) { m.cursorX = graphemeCount(m.buf.Line(m.cursorY)) }
+
+func hasSelection(m *Model) bool { return len(m.selectionRanges()) > 0 }
+
+func isSplit(m *Model) bool { return m.root.pane == nil }
+
+func hasSidebarEntry(m *Model) bool { return m.selectedNode() != nil }
+
+// defaultBindings are the keys of the default profile. A user keybindings
+// file is applied on top of them.
+var defaultBindings = []keymap.Binding{
+	{Keys: "ctrl+q", Command: "app.quit"},
+	{Keys: "ctrl+c", Command: "app.quit"},
+	{Keys: "ctrl+s", Command: "file.save"},
+	{Keys: "ctrl+t", Command: "terminal.toggle"},
+	{Keys: "ctrl+f", Command: "search.open"},
+	{Keys: "ctrl+z", Command: "edit.undo"},
+	{Keys: "ctrl+y", Command: "edit.redo"},
+	{Keys: "ctrl+u", Command: "undo.tree"},
+	{Keys: "ctrl+e", Command: "extensions.open"},
+	{Keys: "tab", Command: "view.toggleFocus"},
+	{Keys: "ctrl+b", Command: "view.toggleFocus"},
+	{Keys: "ctrl+l", Command: "view.toggleLTR"},
+	{Keys: "f2", Command: "keys.cycleProfile"},
+	{Keys: "ctrl+p", Command: "palette.open"},
+	{Keys: "f1", Command: "palette.open"},
+	{Keys: "ctrl+pgdown", Command: "tab.next"},
+	{Keys: "ctrl+pgup", Command: "tab.previous"},
+	{Keys: "ctrl+tab", Command: "tab.switchRecent"},
+	{Keys: "ctrl+^", Command: "tab.switchRecent"},
+	{Keys: "ctrl+w", Command: "tab.close"},
+	{Keys: "ctrl+k t", Command: "tab.reopenClosed"},
+	{Keys: "ctrl+\\", Command: "pane.splitRight"},
+	{Keys: "ctrl+k ctrl+\\", Command: "pane.splitDown"},
+	{Keys: "alt+left", Command: "pane.focusLeft"},
+	{Keys: "alt+right", Command: "pane.focusRight"},
+	{Keys: "alt+up", Command: "pane.focusUp"},
+	{Keys: "alt+down", Command: "pane.focusDown"},
+	{Keys: "alt+=", Command: "pane.grow"},
+	{Keys: "alt+-", Command: "pane.shrink"},
+	{Keys: "ctrl+k w", Command: "pane.close"},
+	{Keys: "ctrl+k e", Command: "sidebar.reveal"},
+	{Keys: "ctrl+k p", Command: "file.goTo"},
+	{Keys: "ctrl+k f", Command: "search.inFiles"},
+	{Keys: "ctrl+k h", Command: "sidebar.toggleHidden"},
+
+	{Keys: "up", Command: "cursor.up", Scope: keymap.Editor},
+	{Keys: "down", Command: "cursor.down", Scope: keymap.Editor},
+	{Keys: "left", Command: "cursor.left", Scope: keymap.Editor},
+	{Keys: "right", Command: "cursor.right", Scope: keymap.Editor},
+	{Keys: "home", Command: "cursor.lineStart", Scope: keymap.Editor},
+	{Keys: "end", Command: "cursor.lineEnd", Scope: keymap.Editor},
+	{Keys: "shift+up", Command: "select.up", Scope: keymap.Editor},
+	{Keys: "shift+down", Command: "select.down", Scope: keymap.Editor},
+	{Keys: "shift+left", Command: "select.left", Scope: keymap.Editor},
+	{Keys: "shift+right", Command: "select.right", Scope: keymap.Editor},
+	{Keys: "shift+home", Command: "select.lineStart", Scope: keymap.Editor},
+	{Keys: "shift+end", Command: "select.lineEnd", Scope: keymap.Editor},
+	{Keys: "ctrl+a", Command: "select.all", Scope: keymap.Editor},
+	{Keys: "esc", Command: "select.clear", Scope: keymap.Editor},
+	{Keys: "ctrl+d", Command: "cursor.addNextOccurrence", Scope: keymap.Editor},
+	{Keys: "alt+shift+up", Command: "cursor.addAbove", Scope: keymap.Editor},
+	{Keys: "alt+shift+down", Command: "cursor.addBelow", Scope: keymap.Editor},
+	{Keys: "enter", Command: "edit.newline", Scope: keymap.Editor},
+	{Keys: "backspace", Command: "edit.deleteLeft", Scope: keymap.Editor},
+	{Keys: "ctrl+c", Command: "edit.copy", Scope: keymap.Editor},
+	{Keys: "ctrl+x", Command: "edit.cut", Scope: keymap.Editor},
+	{Keys: "ctrl+v", Command: "edit.paste", Scope: keymap.Editor},
+	{Keys: "tab", Command: "edit.indent", Scope: keymap.Editor},
+	{Keys: "shift+tab", Command: "edit.outdent", Scope: keymap.Editor},
+
+	{Keys: "up", Command: "sidebar.up", Scope: keymap.Sidebar},
+	{Keys: "down", Command: "sidebar.down", Scope: keymap.Sidebar},
+	{Keys: "enter", Command: "sidebar.open", Scope: keymap.Sidebar},
+	{Keys: "right", Command: "sidebar.expand", Scope: keymap.Sidebar},
+	{Keys: "left", Command: "sidebar.collapse", Scope: keymap.Sidebar},
+	{Keys: "backspace", Command: "sidebar.parent", Scope: keymap.Sidebar},
+	{Keys: "home", Command: "sidebar.first", Scope: keymap.Sidebar},
+	{Keys: "end", Command: "sidebar.last", Scope: keymap.Sidebar},
+	{Keys: "pgup", Command: "sidebar.pageUp", Scope: keymap.Sidebar},
+	{Keys: "pgdown", Command: "sidebar.pageDown", Scope: keymap.Sidebar},
+	{Keys: "a", Command: "sidebar.newFile", Scope: keymap.Sidebar},
+	{Keys: "A", Command: "sidebar.newFolder", Scope: keymap.Sidebar},
+	{Keys: "r", Command: "sidebar.rename", Scope: keymap.Sidebar},
+	{Keys: "f2", Command: "sidebar.rename", Scope: keymap.Sidebar},
+	{Keys: "c", Command: "sidebar.duplicate", Scope: keymap.Sidebar},
+	{Keys: "d", Command: "sidebar.delete", Scope: keymap.Sidebar},
+	{Keys: "delete", Command: "sidebar.delete", Scope: keymap.Sidebar},
+	{Keys: "u", Command: "sidebar.undoDelete", Scope: keymap.Sidebar},
+	{Keys: "ctrl+z", Command: "sidebar.undoDelete", Scope: keymap.Sidebar},
+	{Keys: "R", Command: "sidebar.refresh", Scope: keymap.Sidebar},
+	{Keys: "H", Command: "sidebar.toggleHidden", Scope: keymap.Sidebar},
+	{Keys: "esc", Command: "view.focusEditor", Scope: keymap.Sidebar},
+
+	{Keys: "ctrl+t", Command: "terminal.toggle", Scope: keymap.Terminal},
+	{Keys: "esc", Command: "terminal.toggle", Scope: keymap.Terminal},
+
+	{Keys: "enter", Command: "search.next", Scope: keymap.Search},
+	{Keys: "esc", Command: "search.close", Scope: keymap.Search},
+
+	{Keys: "esc", Command: "extensions.close", Scope: keymap.Extensions},
+}
+
+// loadKeymap builds the keymap from the defaults and the user file and
+// returns a status message describing anything wrong with the latter.
+func loadKeymap() (*keymap.Keymap, string) {
+	keys := keymap.New()
+	for _, b := range defaultBindings {
+		_ = keys.Bind(b.Scope, b.Keys, b.Command)
+	}
+	path, err := keymap.DefaultPath()
+	if err == nil {
+		err = keys.Load(path)
+	}
+	var problems []string
+	if err != nil {
+		problems = append(problems, strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	for _, b := range keys.Bindings() {
+		if lookupCommand(b.Command) == nil {
+			problems = append(problems, fmt.Sprintf("%s: unknown command %s", keymap.Format(b.Keys), b.Command))
+		}
+	}
+	for _, c := range keys.Conflicts() {
+		problems = append(problems, c.String())
+	}
+	if len(problems) == 0 {
+		return keys, ""
+	}
+	return keys, "keybindings: " + strings.Join(problems, "; ")
+}
+
+// dispatch feeds key to the keymap, looking it up in scopes, and runs the
+// first bound command that applies. It reports whether the key was used.
+func (m *Model) dispatch(msg tea.KeyMsg, scopes ...keymap.Scope) (bool, tea.Cmd) {
+	pending := m.keys.Pending()
+	names, res := m.keys.Feed(msg.String(), scopes...)
+	switch res {
+	case keymap.Pending:
+		return true, nil
+	case keymap.Broken:
+		m.status = fmt.Sprintf("%s %s is not bound", keymap.Format(pending), keymap.Format(msg.String()))
+		return true, nil
+	case keymap.None:
+		return false, nil
+	}
+	for _, name := range names {
+		if ok, cmd := m.runCommand(name); ok {
+			return true, cmd
+		}
+	}
+	return false, nil
+}
+
+// runCommand runs the named command. It reports false when the command
+// does not apply in the current state.
+func (m *Model) runCommand(name string) (bool, tea.Cmd) {
+	c := lookupCommand(name)
+	if c == nil {
+		m.status = "Unknown command: " + name
+		return true, nil
+	}
+	if c.when != nil && !c.when(m) {
+		return false, nil
+	}
+	var cmd tea.Cmd
+	if c.perCaret && len(m.extra) > 0 {
+		m.forEachCaret(func(int) { c.run(m) })
+	} else {
+		cmd = c.run(m)
+	}
+	m.ensureCursorVisible()
+	return true, cmd
+}
+
+// keyHint returns the first key bound to a command followed by label, for
+// the status bar, or "" when the command is unbound.
+func (m Model) keyHint(name, label string) string {
+	keys := m.keys.KeysFor(name)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keymap.Format(keys[0]) + " " + label
+}
+
+// chordIndicator shows the keys of a chord in progress.
+func (m Model) chordIndicator() string {
+	if p := m.keys.Pending(); p != "" {
+		return " | " + keymap.Format(p) + "-"
+	}
+	return ""
+}
+
+// copySelections copies the text of every selection, joined by newlines.
+func (m *Model) copySelections(verb string) tea.Cmd {
+	var parts []string
+	for _, c := range m.caretsInOrder() {
+		if k := m.toMark(c); k.cur != k.anchor {
+			parts = append(parts, m.buf.Slice(min(k.cur, k.anchor), max(k.cur, k.anchor)))
+		}
+	}
+	if len(parts) == 1 {
+		return m.copyText(parts[0], verb+" selection")
+	}
+	return m.copyText(strings.Join(parts, "\n"), fmt.Sprintf("%s %d selections", verb, len(parts)))
+}
+
+// quit saves the undo histories and ends the program. Unsaved changes
+// were either saved or discarded by now, so the swap files go.
+func quit(m *Model) tea.Cmd {
+	for i := range m.docs {
+		m.switchTo(i)
+		_ = m.saveUndoFile()
+		m.removeSwapFile()
+	}
+	m.saveTreeState()
+	_ = m.watcher.Close()
+	return tea.Quit
+}
+
+// openSidebarEntry opens the selected sidebar file, expands or collapses
+// the selected directory, or moves up from the parent entry.
+func (m *Model) openSidebarEntry() tea.Cmd {
+	if len(m.sidebarRows()) == 0 {
+		return nil
+	}
+	switch n := m.selectedNode(); {
+	case n == nil:
+		m.sidebarParent()
+	case n.Dir:
+		m.tree.Toggle(n)
+		m.saveTreeState()
+		m.syncWatches()
+	default:
+		m.openFile(n.Path)
+		m.mode = "editor"
+	}
+	return nil
+}
@@ -2,13 +2,26 @@ package editor
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"syscall"
 
+	"github.com/Mohammad-Alipour/Gonsole/internal/atomicfile"
+	"github.com/Mohammad-Alipour/Gonsole/internal/buffer"
+	"github.com/Mohammad-Alipour/Gonsole/internal/clipboard"
+	"github.com/Mohammad-Alipour/Gonsole/internal/config"
+	"github.com/Mohammad-Alipour/Gonsole/internal/editorconfig"
+	"github.com/Mohammad-Alipour/Gonsole/internal/filetree"
+	"github.com/Mohammad-Alipour/Gonsole/internal/ignore"
+	"github.com/Mohammad-Alipour/Gonsole/internal/keymap"
+	"github.com/Mohammad-Alipour/Gonsole/internal/trash"
+	"github.com/Mohammad-Alipour/Gonsole/internal/watch"
+	"github.com/alecthomas/chroma"
 	"github.com/alecthomas/chroma/formatters"
 	"github.com/alecthomas/chroma/lexers"
 	"github.com/alecthomas/chroma/styles"
@@ -68,32 +81,75 @@ var (
 			Foreground(lipgloss.Color("#ffffff"))
 )
 
-type TerminalOutputMsg string
+const (
+	sidebarWidth = 30
+	gutterWidth  = 5 // line number column
+)
 
-type snapshot struct {
-	lines    []string
-	cursorX  int
-	cursorY  int
-	filepath string
-}
+type TerminalOutputMsg string
 
 type Model struct {
 	cursorX, cursorY int
-	lines            []string
+	buf              buffer.Buffer
 	file             string
 	lang             string
 	status           string
-	files            []string
-	dir              string
-	selectedIdx      int
-	mode             string // "editor" or "sidebar"
+	tree             *filetree.Tree
+	dir              string          // root of the tree
+	ignore           *ignore.Matcher // what the tree, search and finder leave out
+	finding          int             // latest file listing or search; older results are dropped
+	selectedIdx      int             // sidebar row
+	sidebarTop       int             // first sidebar row shown
+	trashed          []trash.Item    // deletes that can be undone, most recent last
+	mode             string          // "editor" or "sidebar"
 	scrollTop        int
 	visibleRows      int
 	width, height    int
+	forceLTR         bool   // draw every line in logical order
+	diskHash         string // content hash of the file as last read or written
+	keyProfile       string // "default", "vim" or "emacs"
+	vim              vimState
+	emacs            emacsState
+	keys             *keymap.Keymap
+	cfg              config.Config
+	cfgStamp         string // state of the settings files when last read
+	ec               editorconfig.Properties
+	format           fileFormat // how the file is stored on disk
+	formatChanged    bool       // format was converted since the last save
+	palette          paletteState
+	prompt           promptState
+
+	// Open documents; the active one is in the fields above
+	docs   []*document
+	active int
+	mru    []*document // most recently used first
+	closed []closedTab // most recently closed last
+
+	// Panes; the focused one shows the active document
+	root      *layout
+	focus     *layout
+	viewWidth int // width of the focused pane
+
+	// Recovery
+	swapPath string    // swap file written by this session
+	swapped  *undoNode // state the swap file holds
+
+	// Watching the disk
+	watcher    *watch.Watcher
+	diskChecks map[*document]bool // documents whose files changed
 
 	// Undo / Redo
-	history     []snapshot
-	redoHistory []snapshot
+	sel        selection
+	extra      []caret   // cursors besides the primary one
+	dragOrigin cursorPos // where the current mouse drag started
+	editLog    *[]edit   // collects edits while every cursor is edited
+	clip       *clipboard.Clipboard
+
+	history             history
+	showUndoTree        bool
+	undoTreeIdx         int
+	undoTreeInput       string
+	undoTreeInputActive bool
 
 	// Terminal
 	showTerminal bool
@@ -114,45 +170,58 @@ type Model struct {
 }
 
 func New() Model {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = filepath.Dir(os.Args[1])
+	}
+	cfg, cfgErrs := config.Load(dir)
 	m := Model{
-		lines:       []string{""},
 		status:      "New file",
 		mode:        "editor",
 		scrollTop:   0,
 		visibleRows: 25,
+		viewWidth:   80,
+		cfg:         cfg,
+		cfgStamp:    config.Stamp(dir),
+		clip:        clipboard.New(os.Stderr),
 		extModel:    NewExtensionsModel(),
+		watcher:     watch.New(),
+		diskChecks:  map[*document]bool{},
 	}
-
+	m.setKeyProfile(cfg.KeyProfile)
+	keys, keysStatus := loadKeymap()
+	m.keys = keys
+
+	m.docs = []*document{m.newDocument()}
+	m.mru = m.docs[:1:1]
+	m.root = &layout{pane: &pane{doc: m.docs[0]}}
+	m.focus = m.root
+	m.use(m.docs[0])
 	if len(os.Args) > 1 {
-		file := os.Args[1]
-		m.file = file
-		m.detectLang(file)
-		m.loadFile(file)
-		m.loadDir(filepath.Dir(file))
-	} else {
-		m.lang = "plaintext"
-		m.loadDir(".")
+		m.openFile(os.Args[1])
 	}
+	m.loadDir(dir)
 
 	m.termViewport = viewport.New(10, 10)
 	m.termViewport.Style = terminalStyle
 
-	if f, cmd, err := startPty(); err == nil {
+	if f, cmd, err := startPty(cfg.Shell); err == nil {
 		m.ptyFile = f
 		m.ptyCmd = cmd
 	} else {
 		m.status = fmt.Sprintf("pty error: %v", err)
 	}
+	if keysStatus != "" {
+		m.status = keysStatus
+	}
+	if len(cfgErrs) > 0 {
+		m.applyConfig(cfg, cfgErrs)
+	}
 
-	m.saveSnapshot()
 	return m
 }
 
-func startPty() (*os.File, *exec.Cmd, error) {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "bash"
-	}
+func startPty(shell string) (*os.File, *exec.Cmd, error) {
 	cmd := exec.Command(shell)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
 	f, err := pty.Start(cmd)
@@ -176,95 +245,278 @@ func (m *Model) readPtyOnce() tea.Cmd {
 	}
 }
 
-func (m *Model) loadDir(path string) {
-	m.dir = path
-	items, err := os.ReadDir(path)
-	if err != nil {
-		m.files = []string{"<cannot read dir>"}
-		return
-	}
-	m.files = nil
-	for _, f := range items {
-		if f.IsDir() {
-			m.files = append(m.files, "📁 "+f.Name()+"/")
-		} else {
-			m.files = append(m.files, "📄 "+f.Name())
-		}
-	}
+func (m *Model) detectLang(path string) {
+	m.lang = languageFor(path)
 }
 
-func (m *Model) detectLang(path string) {
+// languageFor returns the language of the file at path by its extension.
+func languageFor(path string) string {
 	switch strings.ToLower(filepath.Ext(path)) {
 	case ".go":
-		m.lang = "go"
+		return "go"
 	case ".py":
-		m.lang = "python"
+		return "python"
 	case ".js":
-		m.lang = "javascript"
+		return "javascript"
 	case ".html":
-		m.lang = "html"
+		return "html"
 	default:
-		m.lang = "plaintext"
+		return "plaintext"
 	}
 }
 
 func (m *Model) loadFile(path string) {
+	m.loadFileAs(path, "")
+}
+
+// loadFileAs loads the file at path decoded as encoding, or as the
+// encoding detected when that is "".
+func (m *Model) loadFileAs(path, encoding string) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		m.status = fmt.Sprintf("cannot open %s: %v", path, err)
 		return
 	}
-	m.lines = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	ecErr := m.resolveEditorConfig()
+	text, err := m.decodeFile(data, encoding)
+	if err != nil {
+		m.status = fmt.Sprintf("cannot open %s: %v", path, err)
+		return
+	}
+	m.buf = buffer.New(text)
 	m.status = fmt.Sprintf("Opened %s [%s]", path, m.lang)
-	m.saveSnapshot()
+	if ecErr != nil {
+		m.status += fmt.Sprintf(" (%v)", ecErr)
+	}
+	m.diskHash = contentHash(data)
+	m.history = newHistory(m.cfg.UndoLimit)
+	m.formatChanged = false
+	if err := m.loadUndoFile(path, data); err != nil {
+		m.status += fmt.Sprintf(" (%v)", err)
+	}
 }
 
-func (m *Model) saveFile() {
+// saveFile writes the buffer to its file. When that fails the buffer
+// stays modified, the error is shown and, if another way to save may
+// work, the user is asked about it.
+func (m *Model) saveFile() error {
 	if m.file == "" {
 		m.file = "untitled.txt"
 	}
-	content := strings.Join(m.lines, "\n")
-	_ = os.WriteFile(m.file, []byte(content), 0644)
+	if err := m.resolveEditorConfig(); err != nil {
+		m.status = err.Error()
+	}
+	// The buffer takes the save rules only once the file is written.
+	text, _ := m.saveRules(m.buf.String())
+	content, err := m.encodeFile(text)
+	if err != nil {
+		m.status = fmt.Sprintf("cannot save %s: %v", m.file, err)
+		return err
+	}
+	if m.changedOnDisk() {
+		m.confirmOverwrite(content, false)
+		return errChangedOnDisk
+	}
+	if err := atomicfile.Write(m.file, content, 0o644); err != nil {
+		m.saveFailed(err, content)
+		return err
+	}
+	m.markSaved(content)
+	return nil
+}
+
+// markSaved records that content, the buffer encoded with the save rules
+// applied, is now on disk, and applies the rules to the buffer too.
+func (m *Model) markSaved(content []byte) {
+	m.applySaveRules()
 	m.status = fmt.Sprintf("Saved %s [%s]", m.file, m.lang)
+	m.diskHash = contentHash(content)
+	m.history.saved = m.history.current
+	m.formatChanged = false
+	m.removeSwapFile()
+	m.syncWatches()
+	if err := m.saveUndoFile(); err != nil {
+		m.status += fmt.Sprintf(" (undo history not kept: %v)", err)
+	}
 }
 
-func (m *Model) saveSnapshot() {
-	copyLines := append([]string{}, m.lines...)
-	m.history = append(m.history, snapshot{
-		lines:    copyLines,
-		cursorX:  m.cursorX,
-		cursorY:  m.cursorY,
-		filepath: m.file,
-	})
-	if len(m.history) > 200 {
-		m.history = m.history[len(m.history)-200:]
+// modified reports whether the buffer differs from the file on disk.
+// Undoing back to the saved state makes it unmodified again.
+func (m *Model) modified() bool {
+	d := m.current()
+	return d.modified()
+}
+
+// confirmDiscard runs then, first asking whether to save the changes when
+// the buffer is modified. Cancelling, or a save that fails, leaves
+// everything as it was.
+func (m *Model) confirmDiscard(then func(m *Model) tea.Cmd) tea.Cmd {
+	if !m.modified() {
+		return then(m)
 	}
-	m.redoHistory = nil
+	name := m.file
+	if name == "" {
+		name = "Untitled"
+	}
+	m.ask(fmt.Sprintf("%s has unsaved changes.", filepath.Base(name)),
+		promptChoice{key: "s", label: "Save", run: func(m *Model) tea.Cmd {
+			if m.saveFile() != nil {
+				return nil
+			}
+			return then(m)
+		}},
+		promptChoice{key: "d", label: "Discard", run: then},
+		promptChoice{key: "c", label: "Cancel", run: func(m *Model) tea.Cmd {
+			m.status = "Cancelled"
+			return nil
+		}})
+	return nil
 }
 
-func (m *Model) undo() {
-	if len(m.history) <= 1 {
-		return
+// saveFailed reports a failed save and offers the alternatives: writing
+// the file in place when its directory is read-only, or saving under
+// another name.
+func (m *Model) saveFailed(err error, content []byte) {
+	m.status = fmt.Sprintf("cannot save %s: %v (changes not saved)", m.file, err)
+	saveAs := promptChoice{key: "a", label: "Save as...", run: func(m *Model) tea.Cmd {
+		m.askText("Save as:", m.file, func(m *Model, path string) tea.Cmd {
+			if path == "" {
+				return nil
+			}
+			m.file = path
+			m.detectLang(path)
+			m.saveFile()
+			return nil
+		})
+		return nil
+	}}
+	var dirErr *atomicfile.DirError
+	switch {
+	case errors.As(err, &dirErr):
+		m.ask(fmt.Sprintf("Cannot create files in %s.", dirErr.Dir),
+			promptChoice{key: "o", label: "Overwrite in place", run: func(m *Model) tea.Cmd {
+				if err := atomicfile.WriteInPlace(m.file, content); err != nil {
+					m.status = fmt.Sprintf("cannot save %s: %v (changes not saved)", m.file, err)
+					return nil
+				}
+				m.markSaved(content)
+				return nil
+			}},
+			saveAs)
+	case errors.Is(err, fs.ErrPermission):
+		m.ask(fmt.Sprintf("%s is not writable.", m.file), saveAs)
 	}
-	current := m.history[len(m.history)-1]
-	m.redoHistory = append(m.redoHistory, current)
-	m.history = m.history[:len(m.history)-1]
-	last := m.history[len(m.history)-1]
-	m.lines = append([]string{}, last.lines...)
-	m.cursorX = last.cursorX
-	m.cursorY = last.cursorY
 }
 
-func (m *Model) redo() {
-	if len(m.redoHistory) == 0 {
+// cursorOffset returns the byte offset of the cursor, translating the
+// grapheme column in cursorX.
+func (m *Model) cursorOffset() int {
+	return m.buf.Offset(m.cursorY, byteCol(m.buf.Line(m.cursorY), m.cursorX))
+}
+
+// typeText inserts typed text at the cursor.
+func (m *Model) typeText(text string) {
+	off := m.cursorOffset()
+	m.replace(editType, off, off, text)
+}
+
+// insertText types text at every cursor, over the selection if any.
+func (m *Model) insertText(text string) {
+	if len(m.extra) > 0 {
+		m.forEachCaret(func(int) {
+			if !m.replaceSelection(text) {
+				m.typeText(text)
+			}
+		})
 		return
 	}
-	next := m.redoHistory[len(m.redoHistory)-1]
-	m.redoHistory = m.redoHistory[:len(m.redoHistory)-1]
-	m.history = append(m.history, next)
-	m.lines = append([]string{}, next.lines...)
-	m.cursorX = next.cursorX
-	m.cursorY = next.cursorY
+	if !m.replaceSelection(text) {
+		m.typeText(text)
+	}
+	m.ensureCursorVisible()
+}
+
+// newline splits the line at the cursor and indents the new line as far
+// as the current one, in the configured indentation style.
+func (m *Model) newline() {
+	line := m.buf.Line(m.cursorY)
+	before := line[:byteCol(line, m.cursorX)]
+	indent := ""
+	if lead := leadingSpace(before); lead != "" {
+		indent = m.makeIndent(expandedWidth(lead, m.langSettings().TabWidth))
+	}
+	off := m.cursorOffset()
+	m.replace(editOther, off, off, "\n"+indent)
+}
+
+// backspace deletes the grapheme cluster before the cursor, joining the
+// line with the previous one at column zero.
+func (m *Model) backspace() {
+	line := m.buf.Line(m.cursorY)
+	if n := graphemeCount(line); m.cursorX > n {
+		m.cursorX = n
+	}
+	if m.cursorX > 0 {
+		start := m.buf.LineStart(m.cursorY)
+		m.replace(editDelete, start+byteCol(line, m.cursorX-1), start+byteCol(line, m.cursorX), "")
+	} else if m.cursorY > 0 {
+		off := m.cursorOffset()
+		m.replace(editDelete, off-1, off, "")
+	}
+}
+
+// position converts a byte offset into a line and grapheme column.
+func (m *Model) position(off int) (int, int) {
+	line, col := m.buf.Position(off)
+	return line, graphemeCol(m.buf.Line(line), col)
+}
+
+// moveVertical moves the cursor delta lines, keeping it on screen.
+func (m *Model) moveVertical(delta int) {
+	m.history.seal()
+	m.cursorY = max(0, min(m.buf.LineCount()-1, m.cursorY+delta))
+	m.ensureCursorVisible()
+}
+
+// ensureCursorVisible scrolls so that the cursor line is on screen.
+func (m *Model) ensureCursorVisible() {
+	if m.cursorY < m.scrollTop {
+		m.scrollTop = m.cursorY
+	} else if m.cursorY >= m.scrollTop+m.visibleRows {
+		m.scrollTop = m.cursorY - m.visibleRows + 1
+	}
+}
+
+// keyProfiles lists the key bindings F2 cycles through.
+var keyProfiles = []string{"default", "vim", "emacs"}
+
+// setKeyProfile switches the editor keys to profile, falling back to the
+// default bindings for unknown names.
+func (m *Model) setKeyProfile(profile string) {
+	if m.vim.inserting {
+		m.history.end()
+	}
+	m.vim = vimState{}
+	m.emacs = emacsState{}
+	m.keyProfile = keyProfiles[0]
+	for _, p := range keyProfiles {
+		if p == profile {
+			m.keyProfile = p
+		}
+	}
+}
+
+func (m *Model) openSearch() {
+	m.searchActive = true
+	m.searchQuery = ""
+	m.searchResults = nil
+	m.searchIndex = 0
+}
+
+// searchBarShown reports whether the search bar takes a row above the
+// editor.
+func (m Model) searchBarShown() bool {
+	return m.searchActive || m.emacs.isearch
 }
 
 func (m *Model) updateSearchResults() {
@@ -272,15 +524,85 @@ func (m *Model) updateSearchResults() {
 	if m.searchQuery == "" {
 		return
 	}
-	for i, line := range m.lines {
-		if strings.Contains(strings.ToLower(line), strings.ToLower(m.searchQuery)) {
+	for i := 0; i < m.buf.LineCount(); i++ {
+		if start, _ := indexFold(m.buf.Line(i), m.searchQuery); start >= 0 {
 			m.searchResults = append(m.searchResults, i)
 		}
 	}
 	m.searchIndex = 0
 }
 
-func (m *Model) highlightCode(code string) string {
+// searchFrom returns the start of the next match of the search query
+// after off, or of the previous one before it, wrapping around the
+// document. Lines are searched outwards from off, so only the text up to
+// the match is read.
+func (m *Model) searchFrom(off int, backward bool) (int, bool) {
+	if m.searchQuery == "" {
+		return 0, false
+	}
+	count := m.buf.LineCount()
+	y, _ := m.buf.Position(off)
+	step := 1
+	if backward {
+		step = -1
+	}
+	// The line holding off comes up twice: first for the matches on its
+	// side of off, and last, after wrapping, for the rest.
+	for i := 0; i <= count; i++ {
+		ly := ((y+i*step)%count + count) % count
+		ls := m.buf.LineStart(ly)
+		found := -1
+		line := m.buf.Line(ly)
+		for p := 0; p < len(line); {
+			s, e := indexFold(line[p:], m.searchQuery)
+			if s < 0 {
+				break
+			}
+			at := ls + p + s
+			p += max(e, s+1)
+			if i == 0 && (backward && at >= off || !backward && at <= off) {
+				continue
+			}
+			found = at
+			if !backward {
+				break
+			}
+		}
+		if found >= 0 {
+			return found, true
+		}
+	}
+	m.status = fmt.Sprintf("Pattern not found: %s", m.searchQuery)
+	return 0, false
+}
+
+// scanLines runs scan over the lines around off, passing it their text
+// and off within it, and returns the span it finds as buffer offsets.
+// The window starts a few lines either side of off and doubles while
+// scan fails or its span reaches a line at an edge the buffer goes on
+// past, so a scan reads about as much text as it crosses.
+func (m *Model) scanLines(off int, scan func(text string, off int) (start, end int, ok bool)) (int, int, bool) {
+	count := m.buf.LineCount()
+	y, _ := m.buf.Position(off)
+	for n := 16; ; n *= 2 {
+		y0, y1 := max(0, y-n), min(count, y+n+1)
+		ws, we := m.buf.LineStart(y0), m.buf.Len()
+		lo, hi := 0, we+1
+		if y0 > 0 {
+			lo = m.buf.LineStart(y0 + 1)
+		}
+		if y1 < count {
+			we, hi = m.buf.LineStart(y1), m.buf.LineStart(y1-1)
+		}
+		start, end, ok := scan(m.buf.Slice(ws, we), off-ws)
+		start, end = start+ws, end+ws
+		if ok && start >= lo && end < hi || y0 == 0 && y1 == count {
+			return start, end, ok
+		}
+	}
+}
+
+func (m *Model) lexerFor(code string) chroma.Lexer {
 	lexer := lexers.Get(m.lang)
 	if lexer == nil {
 		lexer = lexers.Analyse(code)
@@ -288,14 +610,22 @@ func (m *Model) highlightCode(code string) string {
 	if lexer == nil {
 		lexer = lexers.Fallback
 	}
-	style := styles.Get("dracula")
+	return lexer
+}
+
+func (m Model) codeStyle() *chroma.Style {
+	style := styles.Get(m.cfg.Theme)
 	if style == nil {
 		style = styles.Fallback
 	}
+	return style
+}
+
+func (m *Model) highlightCode(code string) string {
 	formatter := formatters.TTY
-	iterator, _ := lexer.Tokenise(nil, code)
+	iterator, _ := m.lexerFor(code).Tokenise(nil, code)
 	var buf bytes.Buffer
-	if err := formatter.Format(&buf, style, iterator); err != nil {
+	if err := formatter.Format(&buf, m.codeStyle(), iterator); err != nil {
 		return code
 	}
 	return buf.String()
@@ -306,9 +636,61 @@ func (m Model) toggleExtensions() Model {
 	return m
 }
 
-func (m Model) Init() tea.Cmd { return nil }
+func (m Model) Init() tea.Cmd { return tea.Batch(watchConfig(), watchSwap(), m.waitForChanges()) }
 
+// Update handles msg and then deals with files that changed on disk once
+// no question is being asked.
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	updated, cmd := m.update(msg)
+	if m, ok := updated.(Model); ok {
+		m.checkDisk()
+		return m, cmd
+	}
+	return updated, cmd
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case RunCommandMsg:
+		_, cmd := m.runCommand(msg.Name)
+		return m, cmd
+	case configTickMsg:
+		m.reloadConfig()
+		return m, watchConfig()
+	case swapTickMsg:
+		return m, m.writeSwapFiles()
+	case swapWrittenMsg:
+		if err := m.swapFilesWritten(msg); err != nil {
+			m.status = fmt.Sprintf("swap file: %v", err)
+		}
+		return m, watchSwap()
+	case fsChangeMsg:
+		m.filesChanged(msg.paths)
+		m.syncWatches()
+		return m, m.waitForChanges()
+	case fileListMsg:
+		m.showFileList(msg)
+		return m, nil
+	case searchResultMsg:
+		m.showSearchResults(msg)
+		return m, nil
+	case formatDoneMsg:
+		m.formatted(msg)
+		return m, nil
+	case clipboardCopiedMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("system clipboard: %v", msg.err)
+		}
+		return m, nil
+	case clipboardReadMsg:
+		m.clipboardRead(msg)
+		return m, nil
+	}
+	if size, ok := msg.(tea.WindowSizeMsg); ok && m.showExtensions {
+		// Lay the editor out too, so it fits when the manager closes.
+		m.width, m.height = size.Width, size.Height
+		m.resize()
+	}
 	if m.showExtensions {
 		updated, cmd := m.extModel.Update(msg)
 		if nm, ok := updated.(ExtensionsModel); ok {
@@ -329,248 +711,186 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, m.readPtyOnce()
 
+	case tea.MouseMsg:
+		if !m.showTerminal && !m.showUndoTree && !m.palette.open && !m.prompt.open {
+			m.handleMouse(msg)
+		}
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		termH := 10
-		if m.showTerminal {
-			termH = max(6, m.height/4)
-		}
-		m.visibleRows = m.height - termH - 4
-		if m.visibleRows < 5 {
-			m.visibleRows = 5
-		}
-		m.termViewport.Width = m.width
-		m.termViewport.Height = termH
+		m.resize()
 		return m, nil
 
 	case tea.KeyMsg:
 		k := msg.String()
 
+		if m.prompt.open {
+			return m.updatePrompt(msg)
+		}
+		if m.showUndoTree {
+			return m.updateUndoTree(msg)
+		}
+		if m.palette.open {
+			return m.updatePalette(msg)
+		}
+
+		if msg.Paste {
+			switch {
+			case m.searchActive:
+				m.searchQuery += strings.SplitN(pastedText(msg), "\n", 2)[0]
+				m.updateSearchResults()
+			case m.showTerminal:
+				if m.ptyFile != nil {
+					_, _ = m.ptyFile.Write([]byte(string(msg.Runes)))
+				}
+			case m.keyProfile == "vim" && m.vim.mode == vimCmdline:
+				m.updateVimCmdline(msg)
+			case m.mode == "editor" && len(m.extra) > 0:
+				m.vimRecord(msg)
+				m.pasteAll(pastedText(msg))
+			case m.mode == "editor":
+				m.vimRecord(msg)
+				m.pasteText(pastedText(msg))
+			}
+			return m, nil
+		}
+
 		if m.searchActive {
+			if handled, cmd := m.dispatch(msg, keymap.Search); handled {
+				return m, cmd
+			}
 			switch k {
-			case "esc":
-				m.searchActive = false
-				return m, nil
-			case "enter":
-				if len(m.searchResults) > 0 {
-					m.searchIndex = (m.searchIndex + 1) % len(m.searchResults)
-					m.cursorY = m.searchResults[m.searchIndex]
-					if m.cursorY < m.scrollTop {
-						m.scrollTop = m.cursorY
-					} else if m.cursorY >= m.scrollTop+m.visibleRows {
-						m.scrollTop = m.cursorY - m.visibleRows + 1
-					}
-				}
-				return m, nil
 			case "backspace":
 				if len(m.searchQuery) > 0 {
-					m.searchQuery = m.searchQuery[:len(m.searchQuery)-1]
+					m.searchQuery = dropLastGrapheme(m.searchQuery)
 					m.updateSearchResults()
 				}
-				return m, nil
 			default:
-				if len(k) == 1 {
-					m.searchQuery += k
+				if text, ok := typedText(msg); ok {
+					m.searchQuery += text
 					m.updateSearchResults()
 				}
-				return m, nil
 			}
+			return m, nil
 		}
 
 		if m.showTerminal {
-			switch k {
-			case "ctrl+t", "esc":
-				m.showTerminal = false
+			if handled, cmd := m.dispatch(msg, keymap.Terminal); handled {
+				return m, cmd
+			}
+			if m.ptyFile == nil {
 				return m, nil
+			}
+			switch k {
 			case "enter":
-				if m.ptyFile != nil {
-					_, _ = m.ptyFile.Write([]byte{'\r'})
-				}
-				return m, nil
+				_, _ = m.ptyFile.Write([]byte{'\r'})
 			case "backspace":
-				if m.ptyFile != nil {
-					_, _ = m.ptyFile.Write([]byte{0x7f})
-				}
-				return m, nil
+				_, _ = m.ptyFile.Write([]byte{0x7f})
 			default:
-				if m.ptyFile != nil {
-					_, _ = m.ptyFile.Write([]byte(k))
-				}
-				return m, nil
+				_, _ = m.ptyFile.Write([]byte(k))
 			}
+			return m, nil
 		}
 
-		switch k {
-		case "ctrl+c", "esc":
-			return m, tea.Quit
-		case "ctrl+t":
-			m.showTerminal = !m.showTerminal
-			if m.showTerminal {
-				return m, m.readPtyOnce()
-			}
-			return m, nil
-		case "ctrl+s":
-			m.saveFile()
-			return m, nil
-		case "ctrl+f":
-			m.searchActive = true
-			m.searchQuery = ""
-			m.searchResults = nil
-			m.searchIndex = 0
-			return m, nil
-		case "ctrl+z":
-			m.undo()
-			return m, nil
-		case "ctrl+y":
-			m.redo()
-			return m, nil
-		case "ctrl+e":
-			m.showExtensions = true
-			return m, nil
-		case "tab":
-			if m.mode == "editor" {
-				m.mode = "sidebar"
-			} else {
-				m.mode = "editor"
-			}
-			return m, nil
-		case "up":
-			if m.mode == "editor" && m.cursorY > 0 {
-				m.cursorY--
-			}
-			if m.cursorY < m.scrollTop {
-				m.scrollTop = m.cursorY
-				if m.scrollTop < 0 {
-					m.scrollTop = 0
-				}
-			}
-			if m.mode == "sidebar" && m.selectedIdx > 0 {
-				m.selectedIdx--
-			}
-			return m, nil
-		case "down":
-			if m.mode == "editor" && m.cursorY < len(m.lines)-1 {
-				m.cursorY++
-			}
-			if m.cursorY >= m.scrollTop+m.visibleRows {
-				m.scrollTop++
-			}
-			if m.mode == "sidebar" && m.selectedIdx < len(m.files)-1 {
-				m.selectedIdx++
-			}
-			return m, nil
-		case "enter":
-			if m.mode == "editor" {
-				m.lines = append(m.lines[:m.cursorY+1],
-					append([]string{""}, m.lines[m.cursorY+1:]...)...)
-				m.cursorY++
-				m.cursorX = 0
-				m.saveSnapshot()
-			} else if m.mode == "sidebar" {
-				item := m.files[m.selectedIdx]
-				clean := strings.TrimPrefix(item, "📄 ")
-				clean = strings.TrimPrefix(clean, "📁 ")
-				if strings.HasSuffix(clean, "/") {
-					m.loadDir(filepath.Join(m.dir, strings.TrimSuffix(clean, "/")))
-					m.selectedIdx = 0
-				} else {
-					m.file = filepath.Join(m.dir, clean)
-					m.detectLang(m.file)
-					m.loadFile(m.file)
-					m.mode = "editor"
-				}
-			}
-			return m, nil
-		case "left":
-			if m.cursorX > 0 {
-				m.cursorX--
-			}
-			return m, nil
-		case "right":
-			if m.cursorX < len(m.lines[m.cursorY]) {
-				m.cursorX++
-			}
-			return m, nil
-		case "backspace":
-			if m.cursorX > 0 {
-				line := m.lines[m.cursorY]
-				m.lines[m.cursorY] = line[:m.cursorX-1] + line[m.cursorX:]
-				m.cursorX--
-			} else if m.cursorY > 0 {
-				prev := m.lines[m.cursorY-1]
-				curr := m.lines[m.cursorY]
-				m.lines = append(m.lines[:m.cursorY-1],
-					append([]string{prev + curr}, m.lines[m.cursorY+1:]...)...)
-				m.cursorY--
-				m.cursorX = len(prev)
+		if m.mode == "sidebar" {
+			_, cmd := m.dispatch(msg, keymap.Sidebar, keymap.Global)
+			return m, cmd
+		}
+
+		// A chord in progress takes the next key before the profiles see it.
+		if m.keys.Pending() == "" && m.keyProfile == "vim" {
+			if handled, cmd := m.handleVimKey(msg); handled {
+				return m, cmd
 			}
-			m.saveSnapshot()
-			return m, nil
-		default:
-			// printable insertion
-			if len(k) == 1 && m.mode == "editor" {
-				line := m.lines[m.cursorY]
-				m.lines[m.cursorY] = line[:m.cursorX] + k + line[m.cursorX:]
-				m.cursorX++
-				m.saveSnapshot()
+		}
+		if m.keys.Pending() == "" && m.keyProfile == "emacs" {
+			if handled, cmd := m.handleEmacsKey(msg); handled {
+				return m, cmd
 			}
-			return m, nil
 		}
+		if handled, cmd := m.dispatch(msg, keymap.Editor, keymap.Global); handled {
+			return m, cmd
+		}
+		if text, ok := typedText(msg); ok {
+			m.insertText(text)
+		}
+		return m, nil
 	}
 
 	return m, nil
 }
 
+// resize lays the panes and terminal out in the window.
+func (m *Model) resize() {
+	termH := 0
+	if m.showTerminal {
+		termH = max(6, m.height/4)
+		if m.cfg.TerminalHeight > 0 {
+			termH = m.cfg.TerminalHeight
+		}
+	}
+	// The header, tab bar and status bar take a row each.
+	m.layoutPanes(max(20, m.width-sidebarWidth), max(7, m.height-termH-3))
+	m.selectRow(m.selectedIdx)
+	m.termViewport.Width = m.width
+	m.termViewport.Height = termH
+}
+
 func (m Model) renderEditor() string {
 	start := m.scrollTop
 	end := m.scrollTop + m.visibleRows
-	if end > len(m.lines) {
-		end = len(m.lines)
+	if end > m.buf.LineCount() {
+		end = m.buf.LineCount()
 	}
+	ranges := m.selectionRanges()
 	var builder strings.Builder
 	for i := start; i < end; i++ {
 		lineNum := fmt.Sprintf("%4d ", i+1)
-		line := m.lines[i]
+		line := m.buf.Line(i)
 
 		if m.searchQuery != "" {
-			lower := strings.ToLower(line)
-			q := strings.ToLower(m.searchQuery)
-			if strings.Contains(lower, q) {
+			if first, _ := indexFold(line, m.searchQuery); first >= 0 {
 
 				var b strings.Builder
 				idx := 0
 				for {
-					pos := strings.Index(strings.ToLower(line[idx:]), q)
-					if pos == -1 {
+					from, to := indexFold(line[idx:], m.searchQuery)
+					if from == -1 {
 						b.WriteString(line[idx:])
 						break
 					}
-					b.WriteString(line[idx : idx+pos])
-					b.WriteString(highlightStyle.Render(line[idx+pos : idx+pos+len(q)]))
-					idx = idx + pos + len(q)
+					b.WriteString(line[idx : idx+from])
+					b.WriteString(highlightStyle.Render(line[idx+from : idx+to]))
+					idx += to
 				}
 				line = b.String()
 			}
 		}
 
+		layout := m.layoutLine(m.buf.Line(i))
+		if layout == nil && (m.lineSelected(i, ranges) || len(m.caretCols(i)) > 1 || (len(m.extra) > 0 && len(m.caretCols(i)) > 0)) {
+			layout = logicalLayout(m.buf.Line(i))
+		}
+		if layout != nil {
+			h := m.renderLayout(m.buf.Line(i), i, layout, ranges)
+			builder.WriteString(lineNumStyle.Render(lineNum) + h + "\n")
+			continue
+		}
+
 		h := m.highlightCode(line)
 
 		if i == m.cursorY {
-			orig := m.lines[i]
-			pos := m.cursorX
-			if pos > len(orig) {
-				pos = len(orig)
-			}
+			orig := m.buf.Line(i)
+			pos := byteCol(orig, m.cursorX)
 			left := orig[:pos]
 			right := ""
-			if pos < len(orig) {
-				right = orig[pos:]
-			}
 			leftH := m.highlightCode(left)
 			cursorChar := " "
 			if pos < len(orig) {
-				cursorChar = string(orig[pos])
+				cursorChar = graphemeAt(orig, pos)
+				right = orig[pos+len(cursorChar):]
 			}
 			rightH := m.highlightCode(right)
 			cursorRendered := cursorStyle.Render(cursorChar)
@@ -579,19 +899,14 @@ func (m Model) renderEditor() string {
 
 		builder.WriteString(lineNumStyle.Render(lineNum) + h + "\n")
 	}
-	return editorBgStyle.Width(max(20, m.width-30)).Render(builder.String())
-}
-
-func (m Model) renderSidebar() string {
-	var out string
-	for i, f := range m.files {
-		if i == m.selectedIdx && m.mode == "sidebar" {
-			out += activeFileStyle.Render("→ " + f + "\n")
-		} else {
-			out += sidebarStyle.Render("  " + f + "\n")
-		}
+	// Long lines are cut at the edge rather than wrapped, which would push
+	// the lines below out of the pane.
+	text := lipgloss.NewStyle().MaxWidth(max(1, m.viewWidth-4)).Render(strings.TrimSuffix(builder.String(), "\n"))
+	if m.root.pane == nil {
+		// In a split the pane's title row takes the place of the top padding.
+		return editorBgStyle.PaddingTop(0).Width(m.viewWidth).Height(m.visibleRows + 1).MaxHeight(m.visibleRows + 1).Render(text)
 	}
-	return sidebarStyle.Width(30).Height(m.height - 4).Render(out)
+	return editorBgStyle.Width(m.viewWidth).Height(m.visibleRows + 2).MaxHeight(m.visibleRows + 2).Render(text)
 }
 
 func (m Model) View() string {
@@ -600,26 +915,83 @@ func (m Model) View() string {
 	}
 
 	sidebar := m.renderSidebar()
+	if m.showUndoTree {
+		sidebar = m.renderUndoTree()
+	}
 	editorView := m.renderEditor()
+	if m.root.pane == nil {
+		editorView = m.renderPanes(m.root)
+	}
 	content := lipgloss.JoinHorizontal(lipgloss.Top, sidebar, editorView)
-	header := headerStyle.Width(m.width).Render(fmt.Sprintf(" Gonsole — %s ", filepath.Base(m.file)))
-	status := statusBarStyle.Width(m.width).Render(fmt.Sprintf(
-		"📁 %s | 🧩 Ctrl+E Extensions | 🧠 %s | Ln %d, Col %d | Ctrl+S Save | Ctrl+F Search | Ctrl+Z Undo | Ctrl+T Terminal",
-		filepath.Base(m.file), m.lang, m.cursorY+1, m.cursorX+1,
-	))
+	if m.prompt.open && len(m.prompt.preview) > 0 {
+		lines := strings.Split(content, "\n")
+		for i, row := range m.renderPreview(len(lines)) {
+			lines[i] = row
+		}
+		content = strings.Join(lines, "\n")
+	}
+	if m.palette.open {
+		lines := strings.Split(content, "\n")
+		for i, row := range m.renderPalette() {
+			if i < len(lines) {
+				lines[i] = row
+			}
+		}
+		content = strings.Join(lines, "\n")
+	}
+	title := filepath.Base(m.file)
+	if m.modified() {
+		title = "● " + title
+	}
+	header := headerStyle.Width(m.width).Render(fmt.Sprintf(" Gonsole — %s ", title))
+	tabs := m.renderTabs()
+	parts := []string{"📁 " + filepath.Base(m.file)}
+	if h := m.keyHint("extensions.open", "Extensions"); h != "" {
+		parts = append(parts, "🧩 "+h)
+	}
+	parts = append(parts, "🧠 "+m.lang, fmt.Sprintf("Ln %d, Col %d%s", m.cursorY+1, m.displayCol()+1,
+		m.bidiIndicator()+m.caretIndicator()+m.vimIndicator()+m.emacsIndicator()+m.chordIndicator()),
+		m.format.encodingLabel(), m.format.eolLabel())
+	if m.status != "" {
+		parts = append(parts, m.status)
+	}
+	for _, h := range []string{
+		m.keyHint("file.save", "Save"),
+		m.keyHint("search.open", "Search"),
+		m.keyHint("edit.undo", "Undo"),
+		m.keyHint("terminal.toggle", "Terminal"),
+	} {
+		if h != "" {
+			parts = append(parts, h)
+		}
+	}
+	status := statusBarStyle.Width(m.width).MaxHeight(1).Render(strings.Join(parts, " | "))
+	if m.keyProfile == "vim" && m.vim.mode == vimCmdline {
+		status = statusBarStyle.Width(m.width).Render(":" + m.vim.cmdline)
+	}
+	if m.prompt.open {
+		status = m.renderPrompt()
+	}
 
-	if m.searchActive {
+	if m.searchBarShown() {
+		label := "🔍 Find"
+		switch {
+		case m.emacs.isearch && m.emacs.backward:
+			label = "🔍 I-search backward"
+		case m.emacs.isearch:
+			label = "🔍 I-search"
+		}
 		searchBar := searchBarStyle.Width(m.width).
-			Render(fmt.Sprintf("🔍 Find: %s  (%d/%d)", m.searchQuery, m.searchIndex+1, len(m.searchResults)))
-		return lipgloss.JoinVertical(lipgloss.Left, header, searchBar, content, status)
+			Render(fmt.Sprintf("%s: %s  (%d/%d)", label, m.searchQuery, m.searchIndex+1, len(m.searchResults)))
+		return lipgloss.JoinVertical(lipgloss.Left, header, tabs, searchBar, content, status)
 	}
 
 	if m.showTerminal {
 		m.termViewport.SetContent(m.termBuffer)
 		m.termViewport.GotoBottom()
-		return lipgloss.JoinVertical(lipgloss.Left, header, content, status, m.termViewport.View())
+		return lipgloss.JoinVertical(lipgloss.Left, header, tabs, content, status, m.termViewport.View())
 	}
-	return lipgloss.JoinVertical(lipgloss.Left, header, content, status)
+	return lipgloss.JoinVertical(lipgloss.Left, header, tabs, content, status)
 }
 
 func max(a, b int) int {
@@ -0,0 +1,434 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Emacs key profile. The region is the ordinary selection with the mark
+// as its anchor, kills go through the shared kill ring and C-s/C-r search
+// incrementally with the search query, so the rendering, clipboard and
+// search code is the same as for the default keys.
+
+type emacsState struct {
+	prefix string // pending prefix key, "ctrl+x"
+
+	// Universal argument typed with C-u or M-digits.
+	arg       int
+	argSet    bool
+	argDigits bool
+
+	last string // "kill" or "yank" when the previous command was one
+	yank [2]int // range of the text the last yank inserted
+
+	isearch   bool
+	backward  bool
+	origin    cursorPos // where the search started, for C-g
+	match     int       // start of the current match
+	lastQuery string
+}
+
+// handleEmacsKey runs key as an Emacs command. Keys the profile does not
+// bind fall through to the default handling.
+func (m *Model) handleEmacsKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	e := &m.emacs
+	if e.isearch && m.updateIsearch(msg) {
+		return true, nil
+	}
+	k := msg.String()
+	if e.prefix == "ctrl+x" {
+		e.prefix = ""
+		return true, m.emacsCtrlX(k)
+	}
+
+	if k == "ctrl+u" {
+		switch {
+		case !e.argSet:
+			e.arg, e.argSet, e.argDigits = 4, true, false
+		case !e.argDigits:
+			e.arg *= 4
+		}
+		return true, nil
+	}
+	digit := strings.TrimPrefix(k, "alt+")
+	if len(digit) == 1 && digit[0] >= '0' && digit[0] <= '9' && (e.argSet || k != digit) {
+		if !e.argDigits {
+			e.arg, e.argSet, e.argDigits = 0, true, true
+		}
+		e.arg = e.arg*10 + int(digit[0]-'0')
+		return true, nil
+	}
+	n, explicit := 1, e.argSet
+	if explicit {
+		n = e.arg
+	}
+	e.arg, e.argSet, e.argDigits = 0, false, false
+	last := e.last
+	e.last = ""
+
+	var cmd tea.Cmd
+	switch k {
+	case "ctrl+a":
+		m.history.seal()
+		m.cursorX = 0
+	case "ctrl+e":
+		m.history.seal()
+		m.cursorX = graphemeCount(m.buf.Line(m.cursorY))
+	case "ctrl+f":
+		m.emacsForwardChar(n)
+	case "ctrl+b":
+		m.emacsForwardChar(-n)
+	case "ctrl+n":
+		m.moveVertical(n)
+	case "ctrl+p":
+		m.moveVertical(-n)
+	case "alt+f":
+		off := m.emacsWordMove(m.cursorOffset(), n)
+		m.history.seal()
+		m.cursorY, m.cursorX = m.position(off)
+	case "alt+b":
+		off := m.emacsWordMove(m.cursorOffset(), -n)
+		m.history.seal()
+		m.cursorY, m.cursorX = m.position(off)
+	case "alt+<":
+		m.history.seal()
+		m.cursorX, m.cursorY = 0, 0
+	case "alt+>":
+		m.history.seal()
+		m.cursorY, m.cursorX = m.position(m.buf.Len())
+	case "ctrl+v":
+		m.moveVertical(n * m.visibleRows)
+	case "alt+v":
+		m.moveVertical(-n * m.visibleRows)
+	case "ctrl+l":
+		m.scrollTop = max(0, m.cursorY-m.visibleRows/2)
+		return true, nil
+	case "ctrl+@":
+		m.sel = selection{active: true, anchor: cursorPos{m.cursorX, m.cursorY}}
+		m.status = "Mark set"
+	case "ctrl+g", "esc":
+		m.clearSelection()
+		m.clearCarets()
+		m.status = "Quit"
+	case "ctrl+d":
+		off := m.cursorOffset()
+		m.emacsForwardChar(n)
+		end := m.cursorOffset()
+		m.replace(editDelete, off, end, "")
+	case "ctrl+k":
+		off := m.cursorOffset()
+		y := m.cursorY
+		line := m.buf.Line(y)
+		end := m.buf.LineStart(y) + len(line)
+		switch {
+		case explicit:
+			end = m.buf.Len()
+			if y+n < m.buf.LineCount() {
+				end = m.buf.LineStart(y + n)
+			}
+		case strings.TrimSpace(m.buf.Slice(off, end)) == "" && end < m.buf.Len():
+			end++
+		}
+		cmd = m.emacsKill(off, end, false, last == "kill")
+	case "alt+d":
+		off := m.cursorOffset()
+		end := m.emacsWordMove(off, n)
+		cmd = m.emacsKill(off, end, false, last == "kill")
+	case "alt+backspace":
+		off := m.cursorOffset()
+		start := m.emacsWordMove(off, -n)
+		cmd = m.emacsKill(start, off, true, last == "kill")
+	case "ctrl+w":
+		if start, end, ok := m.selectionRange(); ok {
+			cmd = m.emacsKill(start, end, false, last == "kill")
+		}
+	case "alt+w":
+		if region := m.selectedText(); region != "" {
+			cmd = m.copyText(region, "Copied region")
+		}
+		m.clearSelection()
+	case "ctrl+y":
+		cmd = m.emacsYank()
+	case "alt+y":
+		if last != "yank" {
+			m.status = "Previous command was not a yank"
+			return true, nil
+		}
+		repl := m.clip.Ring.Rotate()
+		m.history.seal()
+		m.replace(editOther, e.yank[0], e.yank[1], repl)
+		e.yank[1] = e.yank[0] + len(repl)
+		e.last = "yank"
+	case "ctrl+x":
+		e.prefix = k
+	case "ctrl+_":
+		for i := 0; i < n; i++ {
+			m.undo()
+		}
+	case "alt+_":
+		for i := 0; i < n; i++ {
+			m.redo()
+		}
+	case "ctrl+s", "ctrl+r":
+		e.isearch = true
+		e.backward = k == "ctrl+r"
+		e.origin = cursorPos{m.cursorX, m.cursorY}
+		e.match = m.cursorOffset()
+		m.searchQuery = ""
+		m.searchResults = nil
+	case "enter":
+		m.clearSelection()
+		for i := 0; i < n; i++ {
+			m.newline()
+		}
+	default:
+		typed, ok := typedText(msg)
+		if !ok {
+			return false, nil
+		}
+		// Typing deactivates the mark rather than replacing the region.
+		m.clearSelection()
+		if len(m.extra) > 0 {
+			return false, nil
+		}
+		m.typeText(strings.Repeat(typed, max(0, n)))
+	}
+	m.ensureCursorVisible()
+	return true, cmd
+}
+
+// emacsCtrlX runs the second key of a C-x chord.
+func (m *Model) emacsCtrlX(k string) tea.Cmd {
+	switch k {
+	case "ctrl+s":
+		m.saveFile()
+	case "ctrl+c":
+		return m.confirmQuit(0)
+	case "b":
+		m.openTabPalette()
+	case "k":
+		return m.closeTab(m.active)
+	case "ctrl+x":
+		if m.sel.active {
+			a := m.sel.anchor
+			m.sel.anchor = cursorPos{m.cursorX, m.cursorY}
+			m.cursorX, m.cursorY = a.x, a.y
+			m.ensureCursorVisible()
+		}
+	case "h":
+		m.selectAll()
+	case "u":
+		*m = m.openUndoTree()
+	case "o":
+		if isSplit(m) {
+			m.focusNextPane(1)
+		} else {
+			m.mode = "sidebar"
+		}
+	case "2":
+		m.splitPane(splitHorizontal)
+	case "3":
+		m.splitPane(splitVertical)
+	case "0":
+		m.closePane()
+	case "1":
+		m.onlyPane()
+	case "^":
+		m.resizePane(splitHorizontal, paneResizeBy)
+	case "}":
+		m.resizePane(splitVertical, paneResizeBy)
+	case "{":
+		m.resizePane(splitVertical, -paneResizeBy)
+	case "ctrl+g":
+	default:
+		m.status = fmt.Sprintf("C-x %s is undefined", k)
+	}
+	return nil
+}
+
+// emacsForwardChar moves n characters forward, or backward when n is
+// negative, crossing line ends.
+func (m *Model) emacsForwardChar(n int) {
+	m.history.seal()
+	for ; n > 0; n-- {
+		if m.cursorX < graphemeCount(m.buf.Line(m.cursorY)) {
+			m.cursorX++
+		} else if m.cursorY+1 < m.buf.LineCount() {
+			m.cursorX, m.cursorY = 0, m.cursorY+1
+		}
+	}
+	for ; n < 0; n++ {
+		m.cursorX = min(m.cursorX, graphemeCount(m.buf.Line(m.cursorY)))
+		if m.cursorX > 0 {
+			m.cursorX--
+		} else if m.cursorY > 0 {
+			m.cursorY--
+			m.cursorX = graphemeCount(m.buf.Line(m.cursorY))
+		}
+	}
+}
+
+// emacsKill deletes start to end into the kill ring. Consecutive kills
+// build up one entry so that a single yank brings them all back.
+func (m *Model) emacsKill(start, end int, backward, appendKill bool) tea.Cmd {
+	text := m.buf.Slice(start, end)
+	if text == "" {
+		return nil
+	}
+	switch {
+	case appendKill && backward:
+		m.clip.Ring.PrependToTop(text)
+	case appendKill:
+		m.clip.Ring.AppendToTop(text)
+	default:
+		m.clip.Ring.Push(text)
+	}
+	cmd := m.copyToClipboard(m.clip.Ring.Current())
+	m.clearSelection()
+	m.history.seal()
+	m.replace(editOther, start, end, "")
+	m.emacs.last = "kill"
+	return cmd
+}
+
+// emacsYank inserts the newest kill and remembers where, for M-y.
+func (m *Model) emacsYank() tea.Cmd {
+	return m.readClipboard(func(m *Model, text string) {
+		if text == "" {
+			return
+		}
+		m.clearSelection()
+		m.history.seal()
+		off := m.cursorOffset()
+		m.replace(editOther, off, off, text)
+		m.history.seal()
+		m.emacs.yank = [2]int{off, off + len(text)}
+		m.emacs.last = "yank"
+		m.ensureCursorVisible()
+	})
+}
+
+// updateIsearch handles a key during incremental search. Keys that are not
+// part of the search end it and report false so they run as commands.
+func (m *Model) updateIsearch(msg tea.KeyMsg) bool {
+	e := &m.emacs
+	switch k := msg.String(); k {
+	case "ctrl+s", "ctrl+r":
+		e.backward = k == "ctrl+r"
+		if m.searchQuery == "" {
+			m.searchQuery = e.lastQuery
+			m.updateSearchResults()
+		}
+		m.isearchFind(true)
+	case "backspace":
+		m.searchQuery = dropLastGrapheme(m.searchQuery)
+		m.updateSearchResults()
+		m.isearchFind(false)
+	case "ctrl+g":
+		e.isearch = false
+		m.cursorX, m.cursorY = e.origin.x, e.origin.y
+		m.ensureCursorVisible()
+	case "enter", "esc":
+		e.isearch = false
+		e.lastQuery = m.searchQuery
+	default:
+		text, ok := typedText(msg)
+		if !ok {
+			if msg.Paste {
+				text = strings.SplitN(pastedText(msg), "\n", 2)[0]
+			} else {
+				e.isearch = false
+				e.lastQuery = m.searchQuery
+				return false
+			}
+		}
+		m.searchQuery += text
+		m.updateSearchResults()
+		m.isearchFind(false)
+	}
+	return true
+}
+
+// isearchFind moves to the match of the search query at the current one,
+// or past it when next is set.
+func (m *Model) isearchFind(next bool) {
+	e := &m.emacs
+	if m.searchQuery == "" {
+		return
+	}
+	// searchFrom looks strictly after or before its offset, which is what
+	// moving to the next match needs; widen it by one to keep the match
+	// under the cursor while the query grows.
+	from := e.match
+	if !next {
+		if e.backward {
+			from++
+		} else {
+			from--
+		}
+	}
+	off, ok := m.searchFrom(from, e.backward)
+	if !ok {
+		m.status = "Failing I-search: " + m.searchQuery
+		return
+	}
+	e.match = off
+	m.history.seal()
+	m.cursorY, m.cursorX = m.position(off)
+	m.ensureCursorVisible()
+}
+
+// emacsWordMove returns the offset n words after off, or -n words
+// before it when n is negative.
+func (m *Model) emacsWordMove(off, n int) int {
+	off, _, _ = m.scanLines(off, func(text string, off int) (int, int, bool) {
+		for i := 0; i < n; i++ {
+			off = emacsWordEnd(text, off)
+		}
+		for i := 0; i > n; i-- {
+			off = emacsWordStart(text, off)
+		}
+		return off, off, true
+	})
+	return off
+}
+
+// emacsWordEnd returns the end of the next word after off.
+func emacsWordEnd(text string, off int) int {
+	for off < len(text) && vimClass(runeAt(text, off), false) != 1 {
+		off += utf8.RuneLen(runeAt(text, off))
+	}
+	for off < len(text) && vimClass(runeAt(text, off), false) == 1 {
+		off += utf8.RuneLen(runeAt(text, off))
+	}
+	return off
+}
+
+// emacsWordStart returns the start of the word before off.
+func emacsWordStart(text string, off int) int {
+	for off > 0 && vimClass(lastRune(text[:off]), false) != 1 {
+		_, size := utf8.DecodeLastRuneInString(text[:off])
+		off -= size
+	}
+	for off > 0 && vimClass(lastRune(text[:off]), false) == 1 {
+		_, size := utf8.DecodeLastRuneInString(text[:off])
+		off -= size
+	}
+	return off
+}
+
+// emacsIndicator shows a pending prefix or argument in the status bar.
+func (m Model) emacsIndicator() string {
+	switch {
+	case m.keyProfile != "emacs":
+		return ""
+	case m.emacs.prefix != "":
+		return " | C-x-"
+	case m.emacs.argSet:
+		return fmt.Sprintf(" | C-u %d", m.emacs.arg)
+	}
+	return " | Emacs"
+}
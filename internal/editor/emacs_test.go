@@ -0,0 +1,48 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmacsWords(t *testing.T) {
+	far := strings.Repeat(" -\n", 100)
+	text := "one two\n" + far + "three\n"
+	tests := []struct {
+		keys []string
+		y, x int
+		want string // the text after, when it changes
+	}{
+		{[]string{"alt+f"}, 0, 3, ""},
+		{[]string{"alt+f", "alt+f"}, 0, 7, ""},
+		{[]string{"alt+f", "alt+f", "alt+f"}, 101, 5, ""},
+		{[]string{"alt+f", "alt+f", "alt+f", "alt+b"}, 101, 0, ""},
+		{[]string{"alt+f", "alt+f", "alt+f", "alt+b", "alt+b"}, 0, 4, ""},
+		{[]string{"alt+d"}, 0, 0, " two\n" + far + "three\n"},
+		{[]string{"alt+f", "alt+f", "alt+d"}, 0, 7, "one two\n"},
+		{[]string{"alt+f", "alt+f", "alt+f", "alt+backspace"}, 101, 0, "one two\n" + far + "\n"},
+		{[]string{"alt+f", "alt+f", "alt+f", "alt+backspace", "alt+backspace"}, 0, 4, "one \n"},
+		// I-search finds the query however far it is.
+		{[]string{"ctrl+s", "t", "h", "r", "enter"}, 101, 0, ""},
+		{[]string{"ctrl+s", "o", "ctrl+s", "ctrl+s", "enter"}, 0, 0, ""},
+		{[]string{"ctrl+r", "t", "enter"}, 101, 0, ""},
+		{[]string{"ctrl+r", "t", "ctrl+r", "enter"}, 0, 4, ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.keys, " "), func(t *testing.T) {
+			m, _ := newTestModel(t, text)
+			m.setKeyProfile("emacs")
+			press(m, tt.keys...)
+			if m.cursorY != tt.y || m.cursorX != tt.x {
+				t.Errorf("cursor at %d:%d, want %d:%d", m.cursorY, m.cursorX, tt.y, tt.x)
+			}
+			want := tt.want
+			if want == "" {
+				want = text
+			}
+			if got := m.buf.String(); got != want {
+				t.Errorf("text = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -179,7 +179,7 @@ func (m ExtensionsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			case "backspace":
 				if len(m.searchQuery) > 0 {
-					m.searchQuery = m.searchQuery[:len(m.searchQuery)-1]
+					m.searchQuery = dropLastGrapheme(m.searchQuery)
 					m.rebuildFilter()
 				}
 				return m, nil
@@ -191,8 +191,8 @@ func (m ExtensionsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			default:
-				if len(k) == 1 {
-					m.searchQuery += k
+				if text, ok := typedText(msg); ok {
+					m.searchQuery += text
 					m.rebuildFilter()
 				}
 				return m, nil
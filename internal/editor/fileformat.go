@@ -0,0 +1,435 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/editorconfig"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// The buffer always holds UTF-8 with "\n" line breaks. Files are decoded
+// into that form when loaded and encoded back when saved, in the format
+// they were found in unless .editorconfig or the user asks for another.
+
+// fileFormat is how a file is stored on disk.
+type fileFormat struct {
+	encoding string // one of config.Encodings
+	bom      bool
+	eol      string // line break written for new lines
+	// eols holds the break after each line of a file that mixes them, so
+	// that the lines nobody touched are written back as they were. It is
+	// nil when every line ends the same way.
+	eols []string
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// encodings are the file encodings the editor reads and writes.
+var encodings = []struct {
+	name  string
+	label string
+	enc   encoding.Encoding // nil for UTF-8
+	bom   []byte
+}{
+	{"utf-8", "UTF-8", nil, utf8BOM},
+	{"utf-16le", "UTF-16 LE", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), utf16LEBOM},
+	{"utf-16be", "UTF-16 BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), utf16BEBOM},
+	{"latin1", "Latin-1", charmap.ISO8859_1, nil},
+	{"windows-1256", "Windows-1256", charmap.Windows1256, nil},
+}
+
+func lookupEncoding(name string) (label string, enc encoding.Encoding, bom []byte) {
+	for _, e := range encodings {
+		if e.name == name {
+			return e.label, e.enc, e.bom
+		}
+	}
+	return name, nil, nil
+}
+
+// eolNames are the labels of the line break styles.
+var eolNames = map[string]string{"\n": "LF", "\r\n": "CRLF", "\r": "CR"}
+
+// resolveEditorConfig looks up the .editorconfig properties for the
+// current file.
+func (m *Model) resolveEditorConfig() error {
+	m.ec = nil
+	if m.file == "" {
+		return nil
+	}
+	props, err := editorconfig.Resolve(m.file)
+	if err != nil {
+		return err
+	}
+	m.ec = props
+	return nil
+}
+
+// detectEncoding picks the encoding of data: the one forced by the
+// caller or .editorconfig, else the one named by a byte order mark, else
+// UTF-8 when the data is valid UTF-8 and the fallback encoding otherwise.
+func (m *Model) detectEncoding(data []byte, forced string) (name string, bom bool) {
+	if forced == "" {
+		switch m.ec.Charset() {
+		case "utf-8-bom":
+			return "utf-8", true
+		case "utf-16le", "utf-16be":
+			// EditorConfig's UTF-16 charsets carry a byte order mark.
+			return m.ec.Charset(), true
+		default:
+			forced = m.ec.Charset()
+		}
+	}
+	if forced != "" {
+		_, _, mark := lookupEncoding(forced)
+		return forced, mark != nil && bytes.HasPrefix(data, mark)
+	}
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return "utf-8", true
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return "utf-16le", true
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return "utf-16be", true
+	case utf8.Valid(data):
+		return "utf-8", false
+	}
+	return m.cfg.FallbackEncoding, false
+}
+
+// decodeFile turns file contents into buffer text and records the format
+// they were in. forced names the encoding to use instead of detecting it.
+func (m *Model) decodeFile(data []byte, forced string) (string, error) {
+	name, bom := m.detectEncoding(data, forced)
+	label, enc, mark := lookupEncoding(name)
+	if bom {
+		data = bytes.TrimPrefix(data, mark)
+	}
+	if enc != nil {
+		out, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			return "", fmt.Errorf("decoding %s: %w", label, err)
+		}
+		data = out
+	}
+	text, eol, eols := splitLineEndings(string(data))
+	if eol == "" {
+		eol = "\n"
+	}
+	if ec := m.ec.EndOfLine(); ec != "" {
+		eol, eols = ec, nil
+	}
+	m.format = fileFormat{encoding: name, bom: bom, eol: eol, eols: eols}
+	return text, nil
+}
+
+// splitLineEndings converts every line break in s to "\n". It returns the
+// most common break, "" when there is none, and when more than one kind
+// is found, the break after each line.
+func splitLineEndings(s string) (text, eol string, eols []string) {
+	var b strings.Builder
+	var found []string
+	count := map[string]int{}
+	for i := 0; i < len(s); i++ {
+		brk := ""
+		switch {
+		case s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n':
+			brk = "\r\n"
+			i++
+		case s[i] == '\r':
+			brk = "\r"
+		case s[i] == '\n':
+			brk = "\n"
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteByte('\n')
+		found = append(found, brk)
+		count[brk]++
+	}
+	for _, k := range []string{"\n", "\r\n", "\r"} {
+		if count[k] > count[eol] {
+			eol = k
+		}
+	}
+	if len(count) > 1 {
+		eols = found
+	}
+	return b.String(), eol, eols
+}
+
+// encodeFile turns buffer text into file contents in the buffer's format.
+func (m *Model) encodeFile(text string) ([]byte, error) {
+	f := m.format
+	switch {
+	case f.eols != nil && len(f.eols) == strings.Count(text, "\n"):
+		lines := strings.Split(text, "\n")
+		var b strings.Builder
+		for i, line := range lines {
+			b.WriteString(line)
+			if i < len(f.eols) {
+				b.WriteString(f.eols[i])
+			}
+		}
+		text = b.String()
+	case f.eol != "\n":
+		text = strings.ReplaceAll(text, "\n", f.eol)
+	}
+	label, enc, mark := lookupEncoding(f.encoding)
+	out := []byte(text)
+	if enc != nil {
+		var err error
+		if out, err = enc.NewEncoder().Bytes(out); err != nil {
+			return nil, unencodable(text, label, enc, err)
+		}
+	}
+	if f.bom {
+		out = append(append([]byte{}, mark...), out...)
+	}
+	return out, nil
+}
+
+// unencodable explains err by finding the first character of text that
+// enc has no code for.
+func unencodable(text, label string, enc encoding.Encoding, err error) error {
+	e := enc.NewEncoder()
+	for n, line := range strings.Split(text, "\n") {
+		for _, r := range line {
+			if _, rerr := e.String(string(r)); rerr != nil {
+				return fmt.Errorf("line %d: %s has no %q", n+1, label, r)
+			}
+		}
+	}
+	return fmt.Errorf("encoding %s: %w", label, err)
+}
+
+// spliceEOLs keeps the per-line breaks of a mixed file in step with an
+// edit at line that removes and adds the given number of line breaks,
+// and returns the breaks removed and added. Added lines get the breaks in
+// want, such as those an undone edit removed, or the buffer's default
+// break past its end.
+func (f *fileFormat) spliceEOLs(line, removed, added int, want []string) (removedEOLs, addedEOLs []string) {
+	line = min(line, len(f.eols))
+	end := min(line+removed, len(f.eols))
+	removedEOLs = slices.Clone(f.eols[line:end])
+	addedEOLs = make([]string, added)
+	for i := range addedEOLs {
+		addedEOLs[i] = f.eol
+		if i < len(want) {
+			addedEOLs[i] = want[i]
+		}
+	}
+	eols := make([]string, 0, len(f.eols)-(end-line)+added)
+	eols = append(eols, f.eols[:line]...)
+	eols = append(eols, addedEOLs...)
+	f.eols = append(eols, f.eols[end:]...)
+	return removedEOLs, addedEOLs
+}
+
+// eolLabel describes the line breaks of the buffer for the status bar.
+func (f fileFormat) eolLabel() string {
+	if f.eols != nil {
+		return "Mixed"
+	}
+	return eolNames[f.eol]
+}
+
+// encodingLabel describes the encoding of the buffer for the status bar.
+func (f fileFormat) encodingLabel() string {
+	label, _, _ := lookupEncoding(f.encoding)
+	if f.bom && f.encoding == "utf-8" {
+		label += " BOM"
+	}
+	return label
+}
+
+// openLineEndingPalette offers the line break styles to convert the
+// buffer to.
+func (m *Model) openLineEndingPalette() {
+	var items []paletteItem
+	for _, eol := range []string{"\n", "\r\n"} {
+		detail := ""
+		if m.format.eols == nil && m.format.eol == eol {
+			detail = "current"
+		}
+		items = append(items, paletteItem{label: eolNames[eol], detail: detail, run: func(m *Model) tea.Cmd {
+			m.format.eol, m.format.eols = eol, nil
+			m.formatChanged = true
+			m.status = "Line endings: " + eolNames[eol] + " (applied on save)"
+			return nil
+		}})
+	}
+	m.showPalette("Line endings:", items)
+}
+
+// openEncodingPalette offers the encodings to save the buffer in or, when
+// reopen is set, to read the file on disk again with.
+func (m *Model) openEncodingPalette(reopen bool) {
+	var items []paletteItem
+	for _, e := range encodings {
+		name, label := e.name, e.label
+		// UTF-16 is written with a byte order mark, UTF-8 with one only
+		// when asked to.
+		bom := e.bom != nil && name != "utf-8"
+		choices := []string{label}
+		if name == "utf-8" && !reopen {
+			choices = append(choices, "UTF-8 with BOM")
+		}
+		for i, choice := range choices {
+			bom := bom || i == 1
+			detail := ""
+			if !reopen && m.format.encoding == name && m.format.bom == bom {
+				detail = "current"
+			}
+			items = append(items, paletteItem{label: choice, detail: detail, run: func(m *Model) tea.Cmd {
+				if reopen {
+					return m.confirmDiscard(func(m *Model) tea.Cmd {
+						m.reopenWithEncoding(name)
+						return nil
+					})
+				}
+				m.format.encoding, m.format.bom = name, bom
+				m.formatChanged = true
+				m.status = "Encoding: " + choice + " (applied on save)"
+				if _, err := m.encodeFile(m.buf.String()); err != nil {
+					m.status += fmt.Sprintf("; %v", err)
+				}
+				return nil
+			}})
+		}
+	}
+	prompt := "Save with encoding:"
+	if reopen {
+		prompt = "Reopen with encoding:"
+	}
+	m.showPalette(prompt, items)
+}
+
+// reopenWithEncoding reads the file again, decoding it as name.
+func (m *Model) reopenWithEncoding(name string) {
+	if m.file == "" {
+		m.status = "No file to reopen"
+		return
+	}
+	m.loadFileAs(m.file, name)
+	m.cursorY = min(m.cursorY, m.buf.LineCount()-1)
+	m.cursorX = min(m.cursorX, graphemeCount(m.buf.Line(m.cursorY)))
+}
+
+// saveRules returns text as it is saved: with trailing whitespace trimmed
+// and the final newline added or removed as .editorconfig asks. It also
+// returns the edits that make text so, in the order they apply.
+func (m *Model) saveRules(text string) (string, []edit) {
+	trim, _ := m.ec.Bool("trim_trailing_whitespace")
+	final, finalSet := m.ec.Bool("insert_final_newline")
+	var edits []edit
+	if trim {
+		// From the last line up, so that no edit moves the ones after it.
+		lines := strings.Split(text, "\n")
+		end := len(text)
+		for y := len(lines) - 1; y >= 0; y-- {
+			line := lines[y]
+			start := end - len(line)
+			if kept := strings.TrimRight(line, " \t"); len(kept) < len(line) {
+				edits = append(edits, edit{offset: start + len(kept), deleted: line[len(kept):]})
+				lines[y] = kept
+			}
+			end = start - 1
+		}
+		if len(edits) > 0 {
+			text = strings.Join(lines, "\n")
+		}
+	}
+	switch {
+	case finalSet && final && text != "" && !strings.HasSuffix(text, "\n"):
+		edits = append(edits, edit{offset: len(text), inserted: "\n"})
+		text += "\n"
+	case finalSet && !final && strings.HasSuffix(text, "\n"):
+		kept := strings.TrimRight(text, "\n")
+		edits = append(edits, edit{offset: len(kept), deleted: text[len(kept):]})
+		text = kept
+	}
+	return text, edits
+}
+
+// applySaveRules makes the edits saveRules asks for to the buffer as one
+// undo step, so that it matches what was written.
+func (m *Model) applySaveRules() {
+	_, edits := m.saveRules(m.buf.String())
+	if len(edits) == 0 {
+		return
+	}
+	cs := m.carets()
+	m.history.seal()
+	m.history.begin()
+	for _, e := range edits {
+		m.replace(editOther, e.offset, e.offset+len(e.deleted), e.inserted)
+	}
+	m.history.end()
+	// Edits only shorten lines or add one at the end, so clamping is enough
+	// to keep every cursor where it was.
+	for i, c := range cs {
+		c.pos.y = min(c.pos.y, m.buf.LineCount()-1)
+		c.pos.x = min(c.pos.x, graphemeCount(m.buf.Line(c.pos.y)))
+		if c.sel.active {
+			c.sel.anchor.y = min(c.sel.anchor.y, m.buf.LineCount()-1)
+			c.sel.anchor.x = min(c.sel.anchor.x, graphemeCount(m.buf.Line(c.sel.anchor.y)))
+		}
+		cs[i] = c
+	}
+	m.setCarets(cs)
+}
+
+// expandedWidth returns the display width of s with tabs expanded to
+// tabWidth stops.
+func expandedWidth(s string, tabWidth int) int {
+	w := 0
+	for _, r := range s {
+		if r == '\t' {
+			w += tabWidth - w%tabWidth
+		} else {
+			w += displayWidth(string(r))
+		}
+	}
+	return w
+}
+
+// leadingSpace returns the indentation at the start of line.
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// makeIndent returns whitespace of the given display width in the
+// current indentation style.
+func (m *Model) makeIndent(width int) string {
+	s := m.langSettings()
+	if s.InsertSpaces {
+		return strings.Repeat(" ", width)
+	}
+	return strings.Repeat("\t", width/s.TabWidth) + strings.Repeat(" ", width%s.TabWidth)
+}
+
+// insertTab inserts one level of indentation at the cursor: a tab, or
+// spaces up to the next indentation stop.
+func (m *Model) insertTab() {
+	s := m.langSettings()
+	if !s.InsertSpaces {
+		m.typeText("\t")
+		return
+	}
+	line := m.buf.Line(m.cursorY)
+	col := expandedWidth(line[:byteCol(line, m.cursorX)], s.TabWidth)
+	m.typeText(strings.Repeat(" ", s.TabWidth-col%s.TabWidth))
+}
@@ -0,0 +1,107 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string // saved to, relative to the opened file's directory
+		saved string // the file after, "" when the save fails
+	}{
+		{"saved", "file.txt", "a\n\nb\n"},
+		{"write fails", "missing/file.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, path := newTestModel(t, "a  \n\t\nb")
+			dir := filepath.Dir(path)
+			rules := "root = true\n[*]\ntrim_trailing_whitespace = true\ninsert_final_newline = true\n"
+			if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(rules), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			m.file = filepath.Join(dir, tt.file)
+			err := m.saveFile()
+			if tt.saved == "" {
+				if err == nil {
+					t.Fatal("saving succeeded")
+				}
+				if got := m.buf.String(); got != "a  \n\t\nb" {
+					t.Errorf("a failed save changed the text to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(m.file)
+			if string(data) != tt.saved || m.buf.String() != tt.saved {
+				t.Errorf("saved %q with the buffer holding %q, want %q", data, m.buf.String(), tt.saved)
+			}
+			if m.modified() {
+				t.Errorf("buffer modified after saving")
+			}
+			m.undo()
+			if got := m.buf.String(); got != "a  \n\t\nb" {
+				t.Errorf("undo brought back %q", got)
+			}
+		})
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		fallback string
+		text     string // the buffer text
+		format   string // encoding and line break label
+	}{
+		{"empty", "", "latin1", "", "utf-8 LF"},
+		{"utf-8", "héllo\nwörld\n", "latin1", "héllo\nwörld\n", "utf-8 LF"},
+		{"utf-8 with bom", "\xef\xbb\xbfa\nb", "latin1", "a\nb", "utf-8 LF"},
+		{"crlf", "a\r\nb\r\n", "latin1", "a\nb\n", "utf-8 CRLF"},
+		{"cr", "a\rb\r", "latin1", "a\nb\n", "utf-8 CR"},
+		{"mixed", "a\r\nb\nc\r\nd", "latin1", "a\nb\nc\nd", "utf-8 Mixed"},
+		{"utf-16le", "\xff\xfea\x00\r\x00\n\x00\xe9\x00", "latin1", "a\né", "utf-16le CRLF"},
+		{"utf-16be", "\xfe\xff\x00a\x00\n\x00\xe9", "latin1", "a\né", "utf-16be LF"},
+		{"latin-1 fallback", "caf\xe9\n", "latin1", "café\n", "latin1 LF"},
+		{"windows-1256 fallback", "\xc7\n", "windows-1256", "ا\n", "windows-1256 LF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Model
+			m.cfg.FallbackEncoding = tt.fallback
+			text, err := m.decodeFile([]byte(tt.data), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.text {
+				t.Errorf("decoded %q, want %q", text, tt.text)
+			}
+			if got := m.format.encoding + " " + m.format.eolLabel(); got != tt.format {
+				t.Errorf("format %q, want %q", got, tt.format)
+			}
+			out, err := m.encodeFile(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.data {
+				t.Errorf("encoded back as %q, want %q", out, tt.data)
+			}
+		})
+	}
+}
+
+func TestEncodeUnencodable(t *testing.T) {
+	var m Model
+	m.format = fileFormat{encoding: "latin1", eol: "\n"}
+	_, err := m.encodeFile("café\nprice: 5€\n")
+	if err == nil || !strings.Contains(err.Error(), `line 2: Latin-1 has no '€'`) {
+		t.Errorf("error = %v, want one naming line 2 and the euro sign", err)
+	}
+}
@@ -0,0 +1,330 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/trash"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// File operations on the sidebar tree. Paths are typed relative to the
+// root of the tree, so a rename can move an entry anywhere below it, and
+// directories in a new path are created as needed. Deleting moves to the
+// trash and can be undone.
+
+// maxTrashed is how many deletes can be undone.
+const maxTrashed = 20
+
+// treeRel returns path relative to the root of the tree, as prompts show
+// it.
+func (m *Model) treeRel(path string) string {
+	if rel, err := filepath.Rel(m.dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// treeAbs returns the path a prompt answer names.
+func (m *Model) treeAbs(value string) string {
+	if filepath.IsAbs(value) {
+		return filepath.Clean(value)
+	}
+	return filepath.Join(m.dir, value)
+}
+
+// targetDir returns the directory new entries go in: the selected one or
+// the one the selected file is in.
+func (m *Model) targetDir() string {
+	n := m.selectedNode()
+	switch {
+	case n == nil:
+		return m.dir
+	case n.Dir:
+		return n.Path
+	default:
+		return filepath.Dir(n.Path)
+	}
+}
+
+// afterFileOp refreshes the tree and selects path in it.
+func (m *Model) afterFileOp(path string) {
+	m.refreshTree()
+	if n := m.tree.Reveal(path); n != nil {
+		m.selectPath(n.Path)
+	}
+	m.saveTreeState()
+	m.syncWatches()
+}
+
+// newEntry asks for the path of a new file, or folder when folder is set
+// or the path ends in a slash, and creates it. A new file is opened.
+func (m *Model) newEntry(folder bool) {
+	prefix := ""
+	if rel := m.treeRel(m.targetDir()); rel != "." {
+		prefix = rel + string(filepath.Separator)
+	}
+	message := "New file (end with / for a folder):"
+	if folder {
+		message = "New folder:"
+	}
+	m.askText(message, prefix, func(m *Model, value string) tea.Cmd {
+		value = strings.TrimSpace(value)
+		if value == "" || value == prefix {
+			m.status = "Cancelled"
+			return nil
+		}
+		folder := folder || strings.HasSuffix(value, "/")
+		path := m.treeAbs(value)
+		if _, err := os.Lstat(path); err == nil {
+			m.status = fmt.Sprintf("%s already exists", m.treeRel(path))
+			return nil
+		}
+		var err error
+		if folder {
+			err = os.MkdirAll(path, 0o755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			var f *os.File
+			if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); err == nil {
+				err = f.Close()
+			}
+		}
+		if err != nil {
+			m.status = fmt.Sprintf("Cannot create %s: %v", m.treeRel(path), unwrapPathError(err))
+			return nil
+		}
+		m.afterFileOp(path)
+		m.status = "Created " + m.treeRel(path)
+		if !folder {
+			m.openFile(path)
+			m.mode = "editor"
+		}
+		return nil
+	})
+}
+
+// renameEntry asks for a new path for the selected entry and moves it
+// there. Open documents follow it.
+func (m *Model) renameEntry() {
+	n := m.selectedNode()
+	if n == nil {
+		return
+	}
+	from := n.Path
+	m.askText("Rename or move to:", m.treeRel(from), func(m *Model, value string) tea.Cmd {
+		value = strings.TrimSpace(value)
+		to := m.treeAbs(value)
+		if value == "" || to == from {
+			m.status = "Cancelled"
+			return nil
+		}
+		if strings.HasPrefix(to, from+string(filepath.Separator)) {
+			m.status = fmt.Sprintf("Cannot move %s into itself", m.treeRel(from))
+			return nil
+		}
+		if _, err := os.Lstat(to); err == nil {
+			m.status = fmt.Sprintf("%s already exists", m.treeRel(to))
+			return nil
+		}
+		err := os.MkdirAll(filepath.Dir(to), 0o755)
+		if err == nil {
+			err = os.Rename(from, to)
+		}
+		if err != nil {
+			m.status = fmt.Sprintf("Cannot move %s: %v", m.treeRel(from), unwrapPathError(err))
+			return nil
+		}
+		m.followRename(from, to)
+		m.tree.Rename(from, to)
+		m.afterFileOp(to)
+		m.status = fmt.Sprintf("Moved %s to %s", m.treeRel(from), m.treeRel(to))
+		return nil
+	})
+}
+
+// followRename points documents open on from, or on files under it, at
+// their new path under to.
+func (m *Model) followRename(from, to string) {
+	moved := func(path string) (string, bool) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", false
+		}
+		if abs == from {
+			return to, true
+		}
+		if strings.HasPrefix(abs, from+string(filepath.Separator)) {
+			return to + abs[len(from):], true
+		}
+		return "", false
+	}
+	m.stash()
+	for _, d := range m.docs {
+		path, ok := moved(d.file)
+		if !ok {
+			continue
+		}
+		if filepath.Ext(path) != filepath.Ext(d.file) {
+			d.lang = languageFor(path)
+		}
+		// The swap file is named after the old path; the next one is
+		// written under the new.
+		d.removeSwapFile()
+		d.file = path
+	}
+	for i := range m.closed {
+		if path, ok := moved(m.closed[i].file); ok {
+			m.closed[i].file = path
+		}
+	}
+	m.use(m.docs[m.active])
+}
+
+// duplicateEntry asks for a path and copies the selected entry there.
+func (m *Model) duplicateEntry() {
+	n := m.selectedNode()
+	if n == nil {
+		return
+	}
+	from := n.Path
+	ext := filepath.Ext(n.Name)
+	if n.Dir {
+		ext = ""
+	}
+	suggested := filepath.Join(filepath.Dir(from), strings.TrimSuffix(n.Name, ext)+" copy"+ext)
+	m.askText("Duplicate as:", m.treeRel(suggested), func(m *Model, value string) tea.Cmd {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			m.status = "Cancelled"
+			return nil
+		}
+		to := m.treeAbs(value)
+		if _, err := os.Lstat(to); err == nil {
+			m.status = fmt.Sprintf("%s already exists", m.treeRel(to))
+			return nil
+		}
+		if strings.HasPrefix(to, from+string(filepath.Separator)) {
+			m.status = fmt.Sprintf("Cannot copy %s into itself", m.treeRel(from))
+			return nil
+		}
+		err := os.MkdirAll(filepath.Dir(to), 0o755)
+		if err == nil {
+			err = copyPath(from, to)
+		}
+		if err != nil {
+			m.status = fmt.Sprintf("Cannot copy %s: %v", m.treeRel(from), unwrapPathError(err))
+		} else {
+			m.status = fmt.Sprintf("Copied %s to %s", m.treeRel(from), m.treeRel(to))
+		}
+		// A copy that failed halfway is shown as far as it got.
+		m.afterFileOp(to)
+		return nil
+	})
+}
+
+// deleteEntry asks before moving the selected entry to the trash.
+func (m *Model) deleteEntry() {
+	n := m.selectedNode()
+	if n == nil {
+		return
+	}
+	path, what := n.Path, "file"
+	if n.Dir {
+		what = "folder"
+	}
+	m.ask(fmt.Sprintf("Move the %s %s to the trash?", what, m.treeRel(path)),
+		promptChoice{key: "t", label: "Trash", run: func(m *Model) tea.Cmd {
+			it, err := trash.Put(path)
+			if err != nil {
+				m.status = fmt.Sprintf("Cannot move %s to the trash: %v", m.treeRel(path), unwrapPathError(err))
+				return nil
+			}
+			m.trashed = append(m.trashed, it)
+			if len(m.trashed) > maxTrashed {
+				m.trashed = m.trashed[1:]
+			}
+			m.refreshTree()
+			m.saveTreeState()
+			m.status = fmt.Sprintf("Moved %s to the trash", m.treeRel(path))
+			if h := m.keyHint("sidebar.undoDelete", "Undo"); h != "" {
+				m.status += " (" + h + ")"
+			}
+			return nil
+		}})
+}
+
+// undoDelete restores the entry most recently moved to the trash.
+func (m *Model) undoDelete() {
+	if len(m.trashed) == 0 {
+		m.status = "Nothing to restore"
+		return
+	}
+	it := m.trashed[len(m.trashed)-1]
+	if err := trash.Restore(it); err != nil {
+		m.status = fmt.Sprintf("Cannot restore %s: %v", m.treeRel(it.Path), unwrapPathError(err))
+		return
+	}
+	m.trashed = m.trashed[:len(m.trashed)-1]
+	m.afterFileOp(it.Path)
+	m.status = "Restored " + m.treeRel(it.Path)
+}
+
+// copyPath copies the file, symlink or directory tree at from to to,
+// keeping permissions.
+func copyPath(from, to string) error {
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, strings.TrimPrefix(path, from))
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, fi.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			return nil // sockets, devices and pipes are not copied
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+// unwrapPathError drops the operation and path from err, which the
+// messages name already.
+func unwrapPathError(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		return le.Err
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/buffer"
+	"github.com/Mohammad-Alipour/Gonsole/internal/ignore"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Go to File and Find in Files cover the files under the sidebar's root
+// and leave out what the sidebar does. Open documents are searched as
+// they are in the editor, saved or not; other files as they are on disk.
+// The tree is walked in a command, and the list shows once it is done.
+
+const (
+	maxFinderFiles    = 50000   // files Go to File lists
+	maxSearchMatches  = 1000    // lines Find in Files lists
+	maxSearchFileSize = 4 << 20 // bigger files are not searched
+)
+
+// fileListMsg delivers the files Go to File lists.
+type fileListMsg struct {
+	seq   int
+	paths []string
+	err   error
+}
+
+// searchResultMsg delivers the lines Find in Files found.
+type searchResultMsg struct {
+	seq     int
+	query   string
+	matches []searchMatch
+	files   int // files with a match
+}
+
+// searchMatch is a line containing the query.
+type searchMatch struct {
+	path      string
+	line, col int // col in graphemes
+	text      string
+}
+
+// openFileFinder lists the files in the tree to open one by name.
+func (m *Model) openFileFinder() tea.Cmd {
+	m.finding++
+	seq, matcher := m.finding, m.ignore.Clone()
+	m.status = "Listing files ..."
+	return func() tea.Msg {
+		var paths []string
+		err := matcher.Walk(func(path string) error {
+			if len(paths) == maxFinderFiles {
+				return fs.SkipAll
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		return fileListMsg{seq: seq, paths: paths, err: err}
+	}
+}
+
+// showFileList shows the files listed by openFileFinder.
+func (m *Model) showFileList(msg fileListMsg) {
+	if msg.seq != m.finding {
+		return
+	}
+	if msg.err != nil {
+		m.status = fmt.Sprintf("Cannot list %s: %v", m.dir, unwrapPathError(msg.err))
+		return
+	}
+	open := map[string]bool{}
+	for i := range m.docs {
+		if abs, err := filepath.Abs(m.doc(i).file); err == nil && m.doc(i).file != "" {
+			open[abs] = true
+		}
+	}
+	items := make([]paletteItem, 0, len(msg.paths))
+	for _, path := range msg.paths {
+		detail := ""
+		if open[path] {
+			detail = "open"
+		}
+		items = append(items, paletteItem{label: m.treeRel(path), detail: detail, run: func(m *Model) tea.Cmd {
+			m.openFile(path)
+			m.mode = "editor"
+			return nil
+		}})
+	}
+	m.status = ""
+	m.showPalette("Go to file:", items)
+}
+
+// findInFiles asks for text and lists the lines in the tree containing
+// it, ignoring case, to jump to one.
+func (m *Model) findInFiles() {
+	m.askText("Find in files:", m.searchQuery, func(m *Model, query string) tea.Cmd {
+		if query == "" {
+			m.status = "Cancelled"
+			return nil
+		}
+		m.finding++
+		seq, matcher := m.finding, m.ignore.Clone()
+		// Open documents are searched as they are now.
+		open := map[string]buffer.Buffer{}
+		for i := range m.docs {
+			d := m.doc(i)
+			if abs, err := filepath.Abs(d.file); err == nil && d.file != "" {
+				open[abs] = d.buf.Clone()
+			}
+		}
+		m.status = fmt.Sprintf("Searching for %q ...", query)
+		return func() tea.Msg {
+			return searchFiles(seq, query, matcher, open)
+		}
+	})
+}
+
+// searchFiles runs a Find in Files search over the files matcher does
+// not leave out, reading those in open from their buffers.
+func searchFiles(seq int, query string, matcher *ignore.Matcher, open map[string]buffer.Buffer) searchResultMsg {
+	res := searchResultMsg{seq: seq, query: query}
+	_ = matcher.Walk(func(path string) error {
+		if len(res.matches) >= maxSearchMatches {
+			return fs.SkipAll
+		}
+		text, ok := searchableText(path, open)
+		if !ok {
+			return nil
+		}
+		found := false
+		for i, line := range strings.Split(text, "\n") {
+			start, _ := indexFold(line, query)
+			if start < 0 {
+				continue
+			}
+			found = true
+			line = strings.TrimRight(line, "\r")
+			res.matches = append(res.matches, searchMatch{
+				path: path,
+				line: i,
+				col:  graphemeCount(line[:start]),
+				text: strings.TrimSpace(line),
+			})
+			if len(res.matches) == maxSearchMatches {
+				break
+			}
+		}
+		if found {
+			res.files++
+		}
+		return nil
+	})
+	return res
+}
+
+// showSearchResults lists what findInFiles found.
+func (m *Model) showSearchResults(msg searchResultMsg) {
+	if msg.seq != m.finding {
+		return
+	}
+	if len(msg.matches) == 0 {
+		m.status = fmt.Sprintf("No matches for %q", msg.query)
+		return
+	}
+	items := make([]paletteItem, 0, len(msg.matches))
+	for _, r := range msg.matches {
+		label := fmt.Sprintf("%s:%d: %s", m.treeRel(r.path), r.line+1, r.text)
+		items = append(items, paletteItem{label: label, run: func(m *Model) tea.Cmd {
+			m.openFile(r.path)
+			m.mode = "editor"
+			m.cursorY = min(r.line, m.buf.LineCount()-1)
+			m.cursorX = min(r.col, graphemeCount(m.buf.Line(m.cursorY)))
+			return nil
+		}})
+	}
+	m.status = fmt.Sprintf("%d matches in %d files", len(items), msg.files)
+	if len(items) == maxSearchMatches {
+		m.status = fmt.Sprintf("First %d matches shown", maxSearchMatches)
+	}
+	m.showPalette(fmt.Sprintf("%q:", msg.query), items)
+}
+
+// searchableText returns the text Find in Files searches in the file at
+// path, or false for files too big or binary to search. Files in open
+// are read from their buffers.
+func searchableText(path string, open map[string]buffer.Buffer) (string, bool) {
+	if buf, ok := open[path]; ok {
+		return buf.String(), true
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() > maxSearchFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	// A NUL byte near the start marks a binary file, as git decides.
+	if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,352 @@
+package editor
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/buffer"
+)
+
+// edit replaces deleted with inserted at offset. Recording both sides makes
+// every edit its own inverse once they are swapped. In a file that mixes
+// line breaks, the EOL fields hold the break after each line of each side.
+type edit struct {
+	offset       int
+	deleted      string
+	inserted     string
+	deletedEOLs  []string
+	insertedEOLs []string
+}
+
+func (e edit) inverse() edit {
+	return edit{offset: e.offset, deleted: e.inserted, inserted: e.deleted, deletedEOLs: e.insertedEOLs, insertedEOLs: e.deletedEOLs}
+}
+
+func (e edit) apply(b buffer.Buffer) {
+	if e.deleted != "" {
+		b.Delete(e.offset, len(e.deleted))
+	}
+	if e.inserted != "" {
+		b.Insert(e.offset, e.inserted)
+	}
+}
+
+// editKind classifies edits so that runs of the same kind can be undone
+// as one step.
+type editKind int
+
+const (
+	editOther editKind = iota
+	editType
+	editDelete
+)
+
+type cursorPos struct {
+	x, y int
+}
+
+// undoGroup is a single undo step.
+type undoGroup struct {
+	kind   editKind
+	edits  []edit
+	before cursorPos
+	after  cursorPos
+}
+
+// undoNode is a state in the undo tree. The root is the document as it
+// was loaded; every other node is reached from its parent by applying
+// group. Undoing and then editing adds a sibling instead of discarding the
+// branch that was undone.
+type undoNode struct {
+	seq      int
+	when     time.Time
+	group    undoGroup
+	parent   *undoNode
+	children []*undoNode
+	active   int // child that redo follows
+}
+
+// history is an undo tree of edit groups. Memory grows with the size of
+// the changes rather than the size of the document.
+type history struct {
+	root    *undoNode
+	current *undoNode
+	saved   *undoNode // state matching the file on disk
+	seq     int
+	count   int // states in the tree, the root included
+	limit   int
+	sealed  bool
+
+	// batch counts open begin calls; while it is positive every edit is
+	// collected into batchNode.
+	batch     int
+	batchNode *undoNode
+}
+
+// newHistory returns an empty history keeping at most limit undo steps.
+func newHistory(limit int) history {
+	root := &undoNode{when: time.Now()}
+	return history{root: root, current: root, saved: root, count: 1, limit: limit}
+}
+
+// seal ends the current group so the next edit starts a new undo step.
+func (h *history) seal() {
+	h.sealed = true
+}
+
+// begin groups every edit recorded until end into a single undo step.
+// Calls nest: only the outermost end closes the step.
+func (h *history) begin() {
+	if h.batch == 0 {
+		h.batchNode = nil
+	}
+	h.batch++
+}
+
+func (h *history) end() {
+	if h.batch == 0 {
+		return
+	}
+	h.batch--
+	if h.batch == 0 {
+		h.batchNode = nil
+		h.seal()
+	}
+}
+
+// record adds e to the tree, merging it into the current node when it
+// continues the same run of typing or deleting. The saved state is never
+// merged into: what is on disk must stay a state of its own, or the edits
+// after it would look saved.
+func (h *history) record(kind editKind, e edit, before, after cursorPos) {
+	cur := h.current
+	if h.batch > 0 && h.batchNode != nil && cur == h.batchNode {
+		cur.group.edits = append(cur.group.edits, e)
+		cur.group.after = after
+		cur.when = time.Now()
+		return
+	}
+	if cur != h.root && cur != h.saved && len(cur.children) == 0 && !h.sealed &&
+		kind != editOther && cur.group.kind == kind {
+		last := cur.group.edits[len(cur.group.edits)-1]
+		if continues(kind, last, e) {
+			cur.group.edits = append(cur.group.edits, e)
+			cur.group.after = after
+			cur.when = time.Now()
+			return
+		}
+	}
+	h.seq++
+	n := &undoNode{
+		seq:    h.seq,
+		when:   time.Now(),
+		parent: cur,
+		group: undoGroup{
+			kind:   kind,
+			edits:  []edit{e},
+			before: before,
+			after:  after,
+		},
+	}
+	cur.children = append(cur.children, n)
+	cur.active = len(cur.children) - 1
+	h.current = n
+	h.count++
+	if h.batch > 0 {
+		h.batchNode = n
+	}
+	h.sealed = kind == editOther
+	h.prune()
+}
+
+// prune drops the oldest states once the tree holds more than limit
+// steps. Branches that split off before the new root are discarded. Only
+// the states dropped are walked, to keep count up to date.
+func (h *history) prune() {
+	for h.count-1 > h.limit && len(h.root.children) > 0 {
+		oldest := h.root.children[0]
+		for _, c := range h.root.children[1:] {
+			if c.seq < oldest.seq {
+				oldest = c
+			}
+		}
+		if h.isAncestor(oldest, h.current) {
+			// The oldest step is part of the current state: it becomes the
+			// new baseline and its siblings go with the old root.
+			h.count--
+			for _, c := range h.root.children {
+				if c != oldest {
+					h.count -= h.size(c)
+				}
+			}
+			oldest.parent = nil
+			oldest.group = undoGroup{}
+			h.root = oldest
+			continue
+		}
+		h.count -= h.size(oldest)
+		h.root.removeChild(oldest)
+	}
+}
+
+func (h *history) size(n *undoNode) int {
+	total := 1
+	for _, c := range n.children {
+		total += h.size(c)
+	}
+	return total
+}
+
+// isAncestor reports whether a is n or one of its ancestors.
+func (h *history) isAncestor(a, n *undoNode) bool {
+	for ; n != nil; n = n.parent {
+		if n == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *undoNode) removeChild(c *undoNode) {
+	for i, x := range n.children {
+		if x == c {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			break
+		}
+	}
+	if n.active >= len(n.children) {
+		n.active = max(0, len(n.children)-1)
+	}
+}
+
+// nodes lists every state in the order it was created.
+func (h *history) nodes() []*undoNode {
+	var out []*undoNode
+	var walk func(n *undoNode)
+	walk = func(n *undoNode) {
+		out = append(out, n)
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(h.root)
+	sort.Slice(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	return out
+}
+
+// stateAt returns the newest state that existed at time t, or the root
+// when every change is newer.
+func (h *history) stateAt(t time.Time) *undoNode {
+	target := h.root
+	for _, n := range h.nodes() {
+		if !n.when.After(t) && n.seq > target.seq {
+			target = n
+		}
+	}
+	return target
+}
+
+// continues reports whether next picks up where last left off: typing
+// right after the previous insertion, or deleting just before the previous
+// deletion.
+func continues(kind editKind, last, next edit) bool {
+	switch kind {
+	case editType:
+		return next.deleted == "" && next.offset == last.offset+len(last.inserted)
+	case editDelete:
+		return next.inserted == "" && next.offset+len(next.deleted) == last.offset
+	}
+	return false
+}
+
+// replace swaps the text between start and end for text, records the edit
+// and leaves the cursor after the inserted text.
+func (m *Model) replace(kind editKind, start, end int, text string) {
+	e := edit{offset: start, deleted: m.buf.Slice(start, end), inserted: text}
+	if e.deleted == "" && e.inserted == "" {
+		return
+	}
+	before := cursorPos{m.cursorX, m.cursorY}
+	e = m.applyEdit(e)
+	if m.editLog != nil {
+		*m.editLog = append(*m.editLog, e)
+	}
+	m.cursorY, m.cursorX = m.position(start + len(text))
+	m.history.record(kind, e, before, cursorPos{m.cursorX, m.cursorY})
+}
+
+// applyEdit applies e to the buffer, keeping the line breaks of a file
+// that mixes them in step with its lines. It returns e with the breaks
+// it took out and put in, so that undoing it brings back the ones taken.
+func (m *Model) applyEdit(e edit) edit {
+	if m.format.eols != nil {
+		line, _ := m.buf.Position(e.offset)
+		e.deletedEOLs, e.insertedEOLs = m.format.spliceEOLs(line, strings.Count(e.deleted, "\n"), strings.Count(e.inserted, "\n"), e.insertedEOLs)
+	}
+	e.apply(m.buf)
+	return e
+}
+
+func (m *Model) undo() {
+	h := &m.history
+	cur := h.current
+	if cur.parent == nil {
+		return
+	}
+	for i := len(cur.group.edits) - 1; i >= 0; i-- {
+		m.applyEdit(cur.group.edits[i].inverse())
+	}
+	for i, c := range cur.parent.children {
+		if c == cur {
+			cur.parent.active = i
+		}
+	}
+	h.current = cur.parent
+	h.seal()
+	m.clearSelection()
+	m.clearCarets()
+	m.cursorX, m.cursorY = cur.group.before.x, cur.group.before.y
+}
+
+func (m *Model) redo() {
+	h := &m.history
+	cur := h.current
+	if len(cur.children) == 0 {
+		return
+	}
+	next := cur.children[cur.active]
+	for _, e := range next.group.edits {
+		m.applyEdit(e)
+	}
+	h.current = next
+	h.seal()
+	m.clearSelection()
+	m.clearCarets()
+	m.cursorX, m.cursorY = next.group.after.x, next.group.after.y
+}
+
+// jumpTo moves the document to the state of target by undoing up to the
+// closest common ancestor and redoing down the target's branch.
+func (m *Model) jumpTo(target *undoNode) {
+	h := &m.history
+	if !h.isAncestor(h.root, target) {
+		return
+	}
+	for !h.isAncestor(h.current, target) {
+		m.undo()
+	}
+	var path []*undoNode
+	for n := target; n != h.current; n = n.parent {
+		path = append(path, n)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		parent := path[i].parent
+		for j, c := range parent.children {
+			if c == path[i] {
+				parent.active = j
+			}
+		}
+		m.redo()
+	}
+}
@@ -0,0 +1,180 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func typed(offset int, text string) edit   { return edit{offset: offset, inserted: text} }
+func deleted(offset int, text string) edit { return edit{offset: offset, deleted: text} }
+
+// step is something done to a history: an edit recorded, a seal, a save
+// or an undo.
+type step struct {
+	kind editKind
+	e    edit
+	op   string // "", "seal", "save" or "undo"
+}
+
+func rec(kind editKind, e edit) step { return step{kind: kind, e: e} }
+
+var (
+	seal = step{op: "seal"}
+	save = step{op: "save"}
+	undo = step{op: "undo"}
+)
+
+func run(h *history, steps []step) {
+	for _, s := range steps {
+		switch s.op {
+		case "seal":
+			h.seal()
+		case "save":
+			h.saved = h.current
+		case "undo":
+			if h.current.parent != nil {
+				h.current = h.current.parent
+			}
+		default:
+			h.record(s.kind, s.e, cursorPos{}, cursorPos{})
+		}
+	}
+}
+
+func TestHistoryRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		steps    []step
+		groups   int  // steps from the root to the current state
+		modified bool // current != saved
+	}{
+		{"nothing", nil, 0, false},
+		{"typing coalesces", []step{rec(editType, typed(0, "a")), rec(editType, typed(1, "b"))}, 1, true},
+		{"typing elsewhere splits", []step{rec(editType, typed(0, "a")), rec(editType, typed(5, "b"))}, 2, true},
+		{"seal splits", []step{rec(editType, typed(0, "a")), seal, rec(editType, typed(1, "b"))}, 2, true},
+		{"kinds split", []step{rec(editType, typed(0, "ab")), rec(editDelete, deleted(1, "b"))}, 2, true},
+		{"deleting backwards coalesces", []step{rec(editDelete, deleted(3, "d")), rec(editDelete, deleted(2, "c"))}, 1, true},
+		{"other never coalesces", []step{rec(editOther, typed(0, "a")), rec(editOther, typed(1, "b"))}, 2, true},
+		{"saved", []step{rec(editType, typed(0, "a")), save}, 1, false},
+		{"typing after save is unsaved", []step{rec(editType, typed(0, "a")), save, rec(editType, typed(1, "b"))}, 2, true},
+		{"deleting after save is unsaved", []step{rec(editDelete, deleted(3, "d")), save, rec(editDelete, deleted(2, "c"))}, 2, true},
+		{"undo to saved", []step{rec(editType, typed(0, "a")), save, rec(editType, typed(1, "b")), undo}, 1, false},
+		{"undo past saved", []step{rec(editType, typed(0, "a")), save, undo}, 0, true},
+		{"typing after undo branches", []step{rec(editType, typed(0, "a")), undo, rec(editType, typed(0, "b"))}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(100)
+			run(&h, tt.steps)
+			groups := 0
+			for n := h.current; n.parent != nil; n = n.parent {
+				groups++
+			}
+			if groups != tt.groups {
+				t.Errorf("%d undo steps, want %d", groups, tt.groups)
+			}
+			if got := h.current != h.saved; got != tt.modified {
+				t.Errorf("modified = %v, want %v", got, tt.modified)
+			}
+			if got := h.size(h.root); got != h.count {
+				t.Errorf("count = %d, tree holds %d", h.count, got)
+			}
+		})
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		steps []step
+		count int
+	}{
+		{"under the limit", 5, []step{rec(editOther, typed(0, "a")), rec(editOther, typed(1, "b"))}, 3},
+		{"at the limit", 2, []step{rec(editOther, typed(0, "a")), rec(editOther, typed(1, "b"))}, 3},
+		{"over the limit", 2, []step{rec(editOther, typed(0, "a")), rec(editOther, typed(1, "b")), rec(editOther, typed(2, "c"))}, 3},
+		{"branches before the new root go", 2, []step{
+			rec(editOther, typed(0, "a")), undo, rec(editOther, typed(0, "b")),
+			rec(editOther, typed(1, "c")), rec(editOther, typed(2, "d")),
+		}, 3},
+		{"older branch goes first", 3, []step{
+			rec(editOther, typed(0, "a")), undo, rec(editOther, typed(0, "b")),
+			rec(editOther, typed(1, "c")), rec(editOther, typed(2, "d")),
+		}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(tt.limit)
+			run(&h, tt.steps)
+			if got := h.size(h.root); got != h.count {
+				t.Errorf("count = %d, tree holds %d", h.count, got)
+			}
+			if h.count != tt.count {
+				t.Errorf("count = %d, want %d", h.count, tt.count)
+			}
+			if h.root.parent != nil || !h.isAncestor(h.root, h.current) {
+				t.Errorf("current state is not under the root")
+			}
+		})
+	}
+}
+
+func TestUndoKeepsLineBreaks(t *testing.T) {
+	text := "a\r\nb\nc\r\nd\n"
+	tests := []struct {
+		name       string
+		start, end int // in the decoded text
+		insert     string
+	}{
+		{"delete everything", 0, 8, ""},
+		{"delete the middle lines", 2, 6, ""},
+		{"replace across lines", 1, 5, "x\ny\nz"},
+		{"join lines", 1, 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestModel(t, text)
+			m.replace(editOther, tt.start, tt.end, tt.insert)
+			edited, err := m.encodeFile(m.buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, step := range []string{"undo", "redo", "undo"} {
+				if step == "undo" {
+					m.undo()
+				} else {
+					m.redo()
+				}
+				got, err := m.encodeFile(m.buf.String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := text
+				if step == "redo" {
+					want = string(edited)
+				}
+				if string(got) != want {
+					t.Errorf("after %s the file is %q, want %q", step, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoLimitAppliesToEveryDocument(t *testing.T) {
+	m, path := newTestModel(t, "one\n")
+	other := filepath.Join(filepath.Dir(path), "other.txt")
+	if err := os.WriteFile(other, []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m.openFile(other)
+	cfg := m.cfg
+	cfg.UndoLimit = 3
+	m.applyConfig(cfg, nil)
+	for i := range m.docs {
+		if d := m.doc(i); d.history.limit != 3 {
+			t.Errorf("%s keeps an undo limit of %d", d.file, d.history.limit)
+		}
+	}
+}
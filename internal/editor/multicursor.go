@@ -0,0 +1,304 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// caret is one cursor with its own selection. The primary caret lives in
+// Model.cursorX, cursorY and sel so that single-cursor code keeps working;
+// any others are kept in Model.extra.
+type caret struct {
+	pos cursorPos
+	sel selection
+}
+
+// mark is a caret expressed in byte offsets. Offsets can be shifted past an
+// edit made elsewhere, which line and column pairs cannot.
+type mark struct {
+	cur, anchor int
+	selecting   bool
+}
+
+func (k mark) shift(e edit) mark {
+	move := func(o int) int {
+		switch {
+		case o <= e.offset:
+			return o
+		case o >= e.offset+len(e.deleted):
+			return o + len(e.inserted) - len(e.deleted)
+		default:
+			return e.offset
+		}
+	}
+	k.cur = move(k.cur)
+	k.anchor = move(k.anchor)
+	return k
+}
+
+// carets returns every cursor, primary first.
+func (m *Model) carets() []caret {
+	return append([]caret{{pos: cursorPos{m.cursorX, m.cursorY}, sel: m.sel}}, m.extra...)
+}
+
+// setCarets makes cs[0] the primary cursor and the rest extra ones,
+// dropping cursors that ended up in the same place.
+func (m *Model) setCarets(cs []caret) {
+	m.cursorX, m.cursorY = cs[0].pos.x, cs[0].pos.y
+	m.sel = cs[0].sel
+	m.extra = nil
+	seen := map[cursorPos]bool{cs[0].pos: true}
+	for _, c := range cs[1:] {
+		if !seen[c.pos] {
+			seen[c.pos] = true
+			m.extra = append(m.extra, c)
+		}
+	}
+}
+
+func (m *Model) toMark(c caret) mark {
+	off := func(p cursorPos) int {
+		return m.buf.Offset(p.y, byteCol(m.buf.Line(p.y), p.x))
+	}
+	k := mark{cur: off(c.pos), selecting: c.sel.active}
+	k.anchor = k.cur
+	if c.sel.active {
+		k.anchor = off(c.sel.anchor)
+	}
+	return k
+}
+
+func (m *Model) fromMark(k mark) caret {
+	y, x := m.position(k.cur)
+	c := caret{pos: cursorPos{x, y}}
+	if k.selecting {
+		ay, ax := m.position(k.anchor)
+		c.sel = selection{active: true, anchor: cursorPos{ax, ay}}
+	}
+	return c
+}
+
+// forEachCaret runs fn once per cursor with that cursor loaded as the
+// primary one. Cursors are visited from the end of the document backwards
+// and fn receives the cursor's rank in document order. Every edit made on
+// the way is shifted into the other cursors and the whole pass is a single
+// undo step.
+func (m *Model) forEachCaret(fn func(rank int)) {
+	cs := m.carets()
+	marks := make([]mark, len(cs))
+	for i, c := range cs {
+		marks[i] = m.toMark(c)
+	}
+	order := make([]int, len(cs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return marks[order[a]].cur > marks[order[b]].cur })
+
+	var log []edit
+	m.editLog = &log
+	m.history.seal()
+	m.history.begin()
+	for n, i := range order {
+		c := m.fromMark(marks[i])
+		m.cursorX, m.cursorY, m.sel = c.pos.x, c.pos.y, c.sel
+		log = log[:0]
+		fn(len(order) - 1 - n)
+		for _, e := range log {
+			for j := range marks {
+				if j != i {
+					marks[j] = marks[j].shift(e)
+				}
+			}
+		}
+		marks[i] = m.toMark(caret{pos: cursorPos{m.cursorX, m.cursorY}, sel: m.sel})
+	}
+	m.history.end()
+	m.editLog = nil
+
+	for i := range cs {
+		cs[i] = m.fromMark(marks[i])
+	}
+	m.setCarets(cs)
+	m.ensureCursorVisible()
+}
+
+// caretsInOrder returns every cursor sorted by position in the document.
+func (m *Model) caretsInOrder() []caret {
+	cs := m.carets()
+	sort.Slice(cs, func(a, b int) bool {
+		if cs[a].pos.y != cs[b].pos.y {
+			return cs[a].pos.y < cs[b].pos.y
+		}
+		return cs[a].pos.x < cs[b].pos.x
+	})
+	return cs
+}
+
+// clearCarets drops every cursor but the primary one.
+func (m *Model) clearCarets() {
+	m.extra = nil
+}
+
+// addCaret adds a cursor at p unless one is already there.
+func (m *Model) addCaret(c caret) {
+	m.setCarets(append(m.carets(), c))
+}
+
+// addCaretVertical adds a cursor on the line above the topmost cursor or
+// below the bottommost one, in the primary cursor's column.
+func (m *Model) addCaretVertical(delta int) {
+	cs := m.caretsInOrder()
+	y := cs[0].pos.y - 1
+	if delta > 0 {
+		y = cs[len(cs)-1].pos.y + 1
+	}
+	if y < 0 || y >= m.buf.LineCount() {
+		return
+	}
+	x := min(m.cursorX, graphemeCount(m.buf.Line(y)))
+	m.addCaret(caret{pos: cursorPos{x, y}})
+}
+
+// wordBounds returns the grapheme columns of the word around col.
+func wordBounds(line string, col int) (int, int, bool) {
+	bounds := graphemeBounds(line)
+	n := len(bounds) - 1
+	isWord := func(c int) bool {
+		if c < 0 || c >= n {
+			return false
+		}
+		for _, r := range line[bounds[c]:bounds[c+1]] {
+			return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+		}
+		return false
+	}
+	if !isWord(col) {
+		if !isWord(col - 1) {
+			return 0, 0, false
+		}
+		col--
+	}
+	start, end := col, col
+	for isWord(start - 1) {
+		start--
+	}
+	for isWord(end) {
+		end++
+	}
+	return start, end, true
+}
+
+// addNextOccurrence selects the word under the cursor, or, when there is
+// a selection already, adds a cursor selecting the next occurrence of it.
+func (m *Model) addNextOccurrence() {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		from, to, ok := wordBounds(m.buf.Line(m.cursorY), m.cursorX)
+		if !ok {
+			return
+		}
+		m.sel = selection{active: true, anchor: cursorPos{from, m.cursorY}}
+		m.cursorX = to
+		return
+	}
+	needle := m.buf.Slice(start, end)
+	after := end
+	for _, c := range m.extra {
+		k := m.toMark(c)
+		after = max(after, max(k.cur, k.anchor))
+	}
+	text := m.buf.String()
+	idx := strings.Index(text[after:], needle)
+	if idx >= 0 {
+		idx += after
+	} else {
+		idx = strings.Index(text, needle)
+	}
+	for _, c := range m.carets() {
+		if k := m.toMark(c); min(k.cur, k.anchor) == idx {
+			m.status = fmt.Sprintf("No more occurrences of %q", needle)
+			return
+		}
+	}
+	m.addCaret(m.fromMark(mark{cur: idx + len(needle), anchor: idx, selecting: true}))
+	m.ensureCursorVisible()
+}
+
+// blockSelect puts a cursor on every line between from and to, each
+// selecting the same column range, for column editing.
+func (m *Model) blockSelect(from, to cursorPos) {
+	step := 1
+	if to.y < from.y {
+		step = -1
+	}
+	left := min(from.x, to.x)
+	cs := []caret{}
+	for y := from.y; ; y += step {
+		n := graphemeCount(m.buf.Line(y))
+		if n >= left || y == from.y {
+			cs = append(cs, caret{
+				pos: cursorPos{min(to.x, n), y},
+				sel: selection{active: true, anchor: cursorPos{min(from.x, n), y}},
+			})
+		}
+		if y == to.y {
+			break
+		}
+	}
+	m.setCarets(cs)
+}
+
+// pasteAll pastes text at every cursor. When it has exactly one line per
+// cursor, each cursor receives its own line.
+func (m *Model) pasteAll(text string) {
+	if text == "" {
+		return
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	split := len(lines) == len(m.extra)+1
+	m.forEachCaret(func(rank int) {
+		t := text
+		if split {
+			t = lines[rank]
+		}
+		if !m.replaceSelection(t) {
+			off := m.cursorOffset()
+			m.replace(editOther, off, off, t)
+		}
+	})
+}
+
+// caretCols returns the grapheme columns of every cursor on line y.
+func (m Model) caretCols(y int) map[int]bool {
+	cols := map[int]bool{}
+	for _, c := range m.carets() {
+		if c.pos.y == y {
+			cols[c.pos.x] = true
+		}
+	}
+	return cols
+}
+
+// selectionRanges returns the byte ranges selected by every cursor.
+func (m Model) selectionRanges() [][2]int {
+	if r, ok := m.vimSelection(); ok {
+		return [][2]int{r}
+	}
+	var out [][2]int
+	for _, c := range m.carets() {
+		if k := m.toMark(c); k.selecting && k.cur != k.anchor {
+			out = append(out, [2]int{min(k.cur, k.anchor), max(k.cur, k.anchor)})
+		}
+	}
+	return out
+}
+
+func (m Model) caretIndicator() string {
+	if len(m.extra) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d cursors)", len(m.extra)+1)
+}
@@ -0,0 +1,209 @@
+package editor
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/keymap"
+	"github.com/alecthomas/chroma/lexers"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	paletteStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#252526")).
+			Foreground(lipgloss.Color("#CCCCCC")).
+			Padding(0, 1)
+
+	paletteSelectedStyle = lipgloss.NewStyle().
+				Background(lipgloss.Color("#04395E")).
+				Foreground(lipgloss.Color("#FFFFFF")).
+				Padding(0, 1)
+)
+
+// paletteRows is how many entries the palette shows at once.
+const paletteRows = 10
+
+// RunCommandMsg asks the editor to run a named command, so that anything
+// able to return a tea.Cmd, extensions included, can drive the editor.
+type RunCommandMsg struct {
+	Name string
+}
+
+// paletteItem is one entry of the command palette.
+type paletteItem struct {
+	label  string
+	detail string // keybinding or other hint shown on the right
+	run    func(m *Model) tea.Cmd
+}
+
+// paletteState is the command palette overlay. It lists commands, or
+// whatever a command put in it, such as the languages to choose from.
+type paletteState struct {
+	open   bool
+	prompt string
+	query  string
+	items  []paletteItem
+	shown  []int // indexes into items matching query, best first
+	idx    int
+}
+
+// openPalette lists every command that applies right now.
+func (m *Model) openPalette() {
+	var items []paletteItem
+	for i := range commands {
+		c := &commands[i]
+		if c.hidden || (c.when != nil && !c.when(m)) {
+			continue
+		}
+		detail := ""
+		if keys := m.keys.KeysFor(c.name); len(keys) > 0 {
+			detail = keymap.Format(keys[0])
+		}
+		name := c.name
+		items = append(items, paletteItem{label: c.title, detail: detail, run: func(m *Model) tea.Cmd {
+			_, cmd := m.runCommand(name)
+			return cmd
+		}})
+	}
+	m.showPalette(">", items)
+}
+
+// openLanguagePalette lists the languages the highlighter knows.
+func (m *Model) openLanguagePalette() {
+	var items []paletteItem
+	for _, name := range lexers.Names(false) {
+		lang := strings.ToLower(name)
+		detail := ""
+		if lang == m.lang {
+			detail = "current"
+		}
+		items = append(items, paletteItem{label: name, detail: detail, run: func(m *Model) tea.Cmd {
+			m.lang = lang
+			m.status = "Language: " + name
+			return nil
+		}})
+	}
+	m.showPalette("Language:", items)
+}
+
+func (m *Model) showPalette(prompt string, items []paletteItem) {
+	m.palette = paletteState{open: true, prompt: prompt, items: items}
+	m.filterPalette()
+}
+
+// filterPalette ranks the items against the query.
+func (m *Model) filterPalette() {
+	p := &m.palette
+	type scored struct{ i, score int }
+	var hits []scored
+	for i, it := range p.items {
+		if s, ok := fuzzyScore(p.query, it.label); ok {
+			hits = append(hits, scored{i, s})
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+	p.shown = p.shown[:0]
+	for _, h := range hits {
+		p.shown = append(p.shown, h.i)
+	}
+	p.idx = 0
+}
+
+// fuzzyScore matches the letters of query in order anywhere in text,
+// ignoring case. Letters that start a word or follow the previous match
+// score higher, so "tt" ranks "Toggle Terminal" above "Toggle Forced
+// Left-to-Right Display".
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+	t := []rune(text)
+	score, qi, last := 0, 0, -2
+	for i, r := range t {
+		if qi == len(q) {
+			break
+		}
+		if unicode.ToLower(r) != q[qi] {
+			continue
+		}
+		switch {
+		case i == last+1:
+			score += 3
+		case i == 0 || !unicode.IsLetter(t[i-1]) || (unicode.IsUpper(r) && unicode.IsLower(t[i-1])):
+			score += 2
+		default:
+			score++
+		}
+		last = i
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	// Prefer shorter labels among equal matches.
+	return score*100 - len(t), true
+}
+
+func (m Model) updatePalette(msg tea.KeyMsg) (Model, tea.Cmd) {
+	p := &m.palette
+	switch msg.String() {
+	case "esc", "ctrl+g":
+		p.open = false
+	case "up", "ctrl+p", "shift+tab":
+		if p.idx > 0 {
+			p.idx--
+		}
+	case "down", "ctrl+n", "tab":
+		if p.idx < len(p.shown)-1 {
+			p.idx++
+		}
+	case "enter":
+		p.open = false
+		if p.idx < len(p.shown) {
+			cmd := p.items[p.shown[p.idx]].run(&m)
+			m.ensureCursorVisible()
+			return m, cmd
+		}
+	case "backspace":
+		p.query = dropLastGrapheme(p.query)
+		m.filterPalette()
+	default:
+		text, ok := typedText(msg)
+		if msg.Paste {
+			text, ok = strings.SplitN(pastedText(msg), "\n", 2)[0], true
+		}
+		if ok {
+			p.query += text
+			m.filterPalette()
+		}
+	}
+	return m, nil
+}
+
+// renderPalette draws the palette as full-width rows: the query, then the
+// matching entries around the selected one.
+func (m Model) renderPalette() []string {
+	p := m.palette
+	width := max(20, m.width)
+	rows := []string{searchBarStyle.Width(width).Render(p.prompt + " " + p.query)}
+	first := max(0, p.idx-paletteRows+1)
+	for n := first; n < len(p.shown) && n < first+paletteRows; n++ {
+		it := p.items[p.shown[n]]
+		style := paletteStyle
+		if n == p.idx {
+			style = paletteSelectedStyle
+		}
+		// Cut labels too long for the row, such as search results.
+		label := lipgloss.NewStyle().MaxWidth(max(1, width-3-displayWidth(it.detail))).Render(it.label)
+		gap := max(1, width-2-displayWidth(label)-displayWidth(it.detail))
+		rows = append(rows, style.Width(width).Render(label+strings.Repeat(" ", gap)+it.detail))
+	}
+	if len(p.shown) == 0 {
+		rows = append(rows, paletteStyle.Width(width).Render("No matches"))
+	}
+	return rows
+}
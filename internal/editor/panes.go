@@ -0,0 +1,307 @@
+package editor
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	paneTitleStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#252526")).
+			Foreground(lipgloss.Color("#969696")).
+			Padding(0, 1)
+
+	focusedPaneTitleStyle = lipgloss.NewStyle().
+				Background(lipgloss.Color("#1E1E1E")).
+				Foreground(lipgloss.Color("#FFFFFF")).
+				Bold(true).
+				Padding(0, 1)
+
+	paneBorderStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#000000")).
+			Foreground(lipgloss.Color("#444444"))
+)
+
+const (
+	minPaneRatio = 0.1
+	maxPaneRatio = 0.9
+	paneResizeBy = 0.05
+)
+
+type splitDir int
+
+const (
+	splitNone       splitDir = iota
+	splitVertical            // side by side
+	splitHorizontal          // one above the other
+)
+
+// pane shows a document. Panes showing the same document share its text
+// and history but each keeps its own cursors and scroll position. The
+// focused pane's view lives in the Model's fields.
+type pane struct {
+	doc  *document
+	view docView
+}
+
+// layout is a node of the window layout tree: either a pane or a split
+// into two children, the first of which takes ratio of the space.
+type layout struct {
+	split               splitDir
+	ratio               float64
+	children            [2]*layout
+	parent              *layout
+	pane                *pane
+	x, y, width, height int // within the editor area
+}
+
+// rows returns how many lines of text the pane shows: its height less the
+// title row, or padding, above and the padding below.
+func (l *layout) rows() int {
+	return max(1, l.height-2)
+}
+
+// leaves returns the panes under l from left to right and top to bottom.
+func (l *layout) leaves() []*layout {
+	if l.pane != nil {
+		return []*layout{l}
+	}
+	return append(l.children[0].leaves(), l.children[1].leaves()...)
+}
+
+// place gives l and everything under it their share of the rectangle.
+// Panes side by side are kept apart by a one column border.
+func (l *layout) place(x, y, width, height int) {
+	l.x, l.y, l.width, l.height = x, y, width, height
+	if l.pane != nil {
+		return
+	}
+	a, b := l.children[0], l.children[1]
+	if l.split == splitVertical {
+		first := int(float64(width-1)*l.ratio + 0.5)
+		a.place(x, y, first, height)
+		b.place(x+first+1, y, width-1-first, height)
+		return
+	}
+	first := int(float64(height)*l.ratio + 0.5)
+	a.place(x, y, width, first)
+	b.place(x, y+first, width, height-first)
+}
+
+// replaceLayout puts n where l is in the tree.
+func (m *Model) replaceLayout(l, n *layout) {
+	n.parent = l.parent
+	if l.parent == nil {
+		m.root = n
+		return
+	}
+	if l.parent.children[0] == l {
+		l.parent.children[0] = n
+	} else {
+		l.parent.children[1] = n
+	}
+}
+
+// splitPane splits the focused pane in two, both showing its document,
+// and focuses the new one.
+func (m *Model) splitPane(dir splitDir) {
+	m.stash()
+	old := m.focus
+	node := &layout{split: dir, ratio: 0.5}
+	m.replaceLayout(old, node)
+	leaf := &layout{parent: node, pane: &pane{doc: old.pane.doc, view: old.pane.view}}
+	old.parent = node
+	node.children = [2]*layout{old, leaf}
+	m.focus = leaf
+	m.resize()
+}
+
+// focusPane moves the focus to the pane l, making its document the
+// active one.
+func (m *Model) focusPane(l *layout) {
+	if l == m.focus {
+		return
+	}
+	m.stash()
+	m.focus = l
+	m.active = m.indexOf(l.pane.doc)
+	m.use(l.pane.doc)
+	m.setView(l.pane.view)
+	m.touch(l.pane.doc)
+	m.history.seal()
+	if m.searchQuery != "" {
+		m.updateSearchResults()
+	}
+	m.resize()
+}
+
+// focusNextPane moves the focus to the next pane, wrapping around.
+func (m *Model) focusNextPane(delta int) {
+	leaves := m.root.leaves()
+	for i, l := range leaves {
+		if l == m.focus {
+			n := len(leaves)
+			m.focusPane(leaves[((i+delta)%n+n)%n])
+			return
+		}
+	}
+}
+
+// focusDirection moves the focus to the pane next to the focused one in
+// the direction dx, dy, picking the one level with the cursor.
+func (m *Model) focusDirection(dx, dy int) {
+	p := m.focus
+	x := min(p.x+p.width-1, p.x+2+gutterWidth+m.displayCol())
+	y := min(p.y+p.height-1, p.y+1+m.cursorY-m.scrollTop)
+	switch {
+	case dx < 0:
+		x = p.x - 2
+	case dx > 0:
+		x = p.x + p.width + 1
+	case dy < 0:
+		y = p.y - 1
+	case dy > 0:
+		y = p.y + p.height
+	}
+	if l := m.paneAt(x, y); l != nil {
+		m.focusPane(l)
+	}
+}
+
+// paneAt returns the pane covering x, y in the editor area, or nil.
+func (m *Model) paneAt(x, y int) *layout {
+	for _, l := range m.root.leaves() {
+		if x >= l.x && x < l.x+l.width && y >= l.y && y < l.y+l.height {
+			return l
+		}
+	}
+	return nil
+}
+
+// closePane closes the focused pane, leaving its document open, and gives
+// its space to the pane beside it.
+func (m *Model) closePane() {
+	if m.root.pane != nil {
+		m.status = "Cannot close the last pane"
+		return
+	}
+	m.stash()
+	old := m.focus
+	parent := old.parent
+	sibling := parent.children[0]
+	if sibling == old {
+		sibling = parent.children[1]
+	}
+	m.replaceLayout(parent, sibling)
+	m.focusPane(sibling.leaves()[0])
+}
+
+// onlyPane closes every pane but the focused one.
+func (m *Model) onlyPane() {
+	m.stash()
+	m.focus.parent = nil
+	m.root = m.focus
+	m.resize()
+}
+
+// resizePane grows the focused pane by delta of the space it shares with
+// its neighbour in the nearest split of direction dir, or in the nearest
+// split of any direction when dir is splitNone.
+func (m *Model) resizePane(dir splitDir, delta float64) {
+	child := m.focus
+	for n := child.parent; n != nil; child, n = n, n.parent {
+		if dir != splitNone && n.split != dir {
+			continue
+		}
+		if n.children[1] == child {
+			delta = -delta
+		}
+		n.ratio = min(maxPaneRatio, n.ratio+delta)
+		if n.ratio < minPaneRatio {
+			n.ratio = minPaneRatio
+		}
+		m.resize()
+		return
+	}
+}
+
+// equalizePanes gives both sides of every split the same space.
+func (m *Model) equalizePanes() {
+	var walk func(l *layout)
+	walk = func(l *layout) {
+		if l.pane == nil {
+			l.ratio = 0.5
+			walk(l.children[0])
+			walk(l.children[1])
+		}
+	}
+	walk(m.root)
+	m.resize()
+}
+
+// layoutPanes lays the panes out in the editor area and loads the focused
+// pane's size. Panes that are not focused scroll to keep their cursor in
+// view.
+func (m *Model) layoutPanes(width, height int) {
+	m.root.place(0, 0, width, height)
+	for _, l := range m.root.leaves() {
+		if l == m.focus {
+			continue
+		}
+		v := &l.pane.view
+		v.scrollTop = max(0, min(v.scrollTop, v.cursorY))
+		if v.cursorY >= v.scrollTop+l.rows() {
+			v.scrollTop = v.cursorY - l.rows() + 1
+		}
+	}
+	m.visibleRows = m.focus.rows()
+	m.viewWidth = m.focus.width
+	m.ensureCursorVisible()
+}
+
+// renderPanes draws the layout tree under l.
+func (m Model) renderPanes(l *layout) string {
+	if l.pane != nil {
+		return m.renderPane(l)
+	}
+	a, b := m.renderPanes(l.children[0]), m.renderPanes(l.children[1])
+	if l.split == splitHorizontal {
+		return lipgloss.JoinVertical(lipgloss.Left, a, b)
+	}
+	border := paneBorderStyle.Render(strings.TrimSuffix(strings.Repeat("│\n", l.height), "\n"))
+	return lipgloss.JoinHorizontal(lipgloss.Top, a, border, b)
+}
+
+// renderPane draws one pane with its title row. The focused pane is drawn
+// from the Model's fields; the others from their document and view.
+func (m Model) renderPane(l *layout) string {
+	p := l.pane
+	v := m
+	if l != m.focus {
+		if p.doc != m.docs[m.active] {
+			v.use(p.doc)
+		}
+		v.setView(p.view)
+		v.visibleRows = l.rows()
+		v.viewWidth = l.width
+	}
+	d := v.current()
+	title := d.title()
+	if d.modified() {
+		title = "● " + title
+	}
+	style := paneTitleStyle
+	if l == m.focus {
+		style = focusedPaneTitleStyle
+	}
+	header := style.Width(l.width).MaxWidth(l.width).MaxHeight(1).Render(title)
+	return lipgloss.JoinVertical(lipgloss.Left, header, v.renderEditor())
+}
+
+// scrollPane scrolls a pane that is not focused by delta lines.
+func (m *Model) scrollPane(l *layout, delta int) {
+	lines := m.doc(m.indexOf(l.pane.doc)).buf.LineCount()
+	v := &l.pane.view
+	v.scrollTop = max(0, min(lines-l.rows(), v.scrollTop+delta))
+}
@@ -0,0 +1,136 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	promptStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#C27C0E")).
+			Foreground(lipgloss.Color("#FFFFFF")).
+			Padding(0, 1).
+			Bold(true)
+
+	diffAddStyle    = paletteStyle.Foreground(lipgloss.Color("#89D185"))
+	diffDeleteStyle = paletteStyle.Foreground(lipgloss.Color("#F48771"))
+	diffHunkStyle   = paletteStyle.Foreground(lipgloss.Color("#4FC1FF"))
+)
+
+// promptChoice is one answer to a prompt, picked by pressing key.
+type promptChoice struct {
+	key   string
+	label string // shown as "[key]label" when it starts with key
+	run   func(m *Model) tea.Cmd
+}
+
+// promptState is a question shown in place of the status bar that must
+// be answered before anything else. It either offers choices or, when
+// accept is set, reads a line of text.
+type promptState struct {
+	open    bool
+	message string
+	choices []promptChoice
+	value   string
+	accept  func(m *Model, value string) tea.Cmd
+	preview []string // diff lines shown over the editor while asking
+}
+
+// ask shows message with the given choices. Esc dismisses it without
+// running any.
+func (m *Model) ask(message string, choices ...promptChoice) {
+	m.prompt = promptState{open: true, message: message, choices: choices}
+}
+
+// askText reads a line of text, starting from value, and passes it to
+// accept on Enter.
+func (m *Model) askText(message, value string, accept func(m *Model, value string) tea.Cmd) {
+	m.prompt = promptState{open: true, message: message, value: value, accept: accept}
+}
+
+func (m Model) updatePrompt(msg tea.KeyMsg) (Model, tea.Cmd) {
+	p := &m.prompt
+	k := msg.String()
+	if k == "esc" || k == "ctrl+g" {
+		p.open = false
+		m.status = "Cancelled"
+		return m, nil
+	}
+	if p.accept != nil {
+		switch {
+		case k == "enter":
+			p.open = false
+			cmd := p.accept(&m, p.value)
+			m.ensureCursorVisible()
+			return m, cmd
+		case k == "backspace":
+			p.value = dropLastGrapheme(p.value)
+		case msg.Paste:
+			p.value += strings.SplitN(pastedText(msg), "\n", 2)[0]
+		default:
+			if text, ok := typedText(msg); ok {
+				p.value += text
+			}
+		}
+		return m, nil
+	}
+	for _, c := range p.choices {
+		if strings.EqualFold(k, c.key) {
+			p.open = false
+			cmd := c.run(&m)
+			m.ensureCursorVisible()
+			return m, cmd
+		}
+	}
+	return m, nil
+}
+
+// renderPrompt draws the prompt as a single row.
+func (m Model) renderPrompt() string {
+	p := m.prompt
+	text := p.message
+	if p.accept != nil {
+		text += " " + p.value + "█"
+	} else {
+		cancel := "  [Esc] Cancel"
+		for _, c := range p.choices {
+			if c.label == "Cancel" {
+				cancel = ""
+			}
+			label := "[" + c.key + "] " + c.label
+			if len(c.label) >= len(c.key) && strings.EqualFold(c.label[:len(c.key)], c.key) {
+				label = "[" + c.label[:len(c.key)] + "]" + c.label[len(c.key):]
+			}
+			text += "  " + label
+		}
+		text += cancel
+	}
+	return promptStyle.Width(m.width).MaxHeight(1).Render(text)
+}
+
+// renderPreview draws the prompt's preview as full-width rows, at most
+// rows of them.
+func (m Model) renderPreview(rows int) []string {
+	width := max(20, m.width)
+	var out []string
+	for i, line := range m.prompt.preview {
+		if i == rows-1 && len(m.prompt.preview) > rows {
+			out = append(out, paletteStyle.Width(width).Render(fmt.Sprintf("... %d more lines", len(m.prompt.preview)-i)))
+			break
+		}
+		style := paletteStyle
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			style = diffHunkStyle
+		case strings.HasPrefix(line, "+"):
+			style = diffAddStyle
+		case strings.HasPrefix(line, "-"):
+			style = diffDeleteStyle
+		}
+		out = append(out, style.Width(width).MaxHeight(1).Render(strings.ReplaceAll(line, "\t", "    ")))
+	}
+	return out
+}
@@ -0,0 +1,330 @@
+package editor
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var selectionStyle = lipgloss.NewStyle().
+	Background(lipgloss.Color("#264F78")).
+	Foreground(lipgloss.Color("#ffffff"))
+
+// selection spans from anchor to the cursor. The cursor end moves with
+// every shifted motion while the anchor stays where selecting started.
+type selection struct {
+	active bool
+	anchor cursorPos
+}
+
+// startSelection drops the anchor at the cursor unless a selection is
+// already being extended.
+func (m *Model) startSelection() {
+	if !m.sel.active {
+		m.sel = selection{active: true, anchor: cursorPos{m.cursorX, m.cursorY}}
+	}
+}
+
+func (m *Model) clearSelection() {
+	m.sel = selection{}
+}
+
+// selectionRange returns the selected byte range in document order.
+func (m *Model) selectionRange() (int, int, bool) {
+	if !m.sel.active {
+		return 0, 0, false
+	}
+	a := m.buf.Offset(m.sel.anchor.y, byteCol(m.buf.Line(m.sel.anchor.y), m.sel.anchor.x))
+	b := m.cursorOffset()
+	if a > b {
+		a, b = b, a
+	}
+	return a, b, a != b
+}
+
+func (m *Model) selectedText() string {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		return ""
+	}
+	return m.buf.Slice(start, end)
+}
+
+// replaceSelection swaps the selected text for text as one undo step. It
+// reports false when nothing is selected.
+func (m *Model) replaceSelection(text string) bool {
+	start, end, ok := m.selectionRange()
+	m.clearSelection()
+	if !ok {
+		return false
+	}
+	m.history.seal()
+	m.replace(editOther, start, end, text)
+	return true
+}
+
+func (m *Model) selectAll() {
+	m.sel = selection{active: true}
+	last := m.buf.LineCount() - 1
+	m.cursorY = last
+	m.cursorX = graphemeCount(m.buf.Line(last))
+}
+
+// selectedLines returns the first and last line touched by the selection,
+// or the cursor line when nothing is selected. A selection ending at the
+// start of a line does not include that line.
+func (m *Model) selectedLines() (int, int) {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		return m.cursorY, m.cursorY
+	}
+	first, _ := m.buf.Position(start)
+	last, col := m.buf.Position(end)
+	if col == 0 && last > first {
+		last--
+	}
+	return first, last
+}
+
+// indentLines adds one level of indentation to every selected line, or
+// removes one when outdent is set, as a single undo step.
+func (m *Model) indentLines(outdent bool) {
+	first, last := m.selectedLines()
+	unit, width := m.indentUnit(), m.langSettings().TabWidth
+	m.history.seal()
+	m.history.begin()
+	for y := first; y <= last; y++ {
+		start := m.buf.LineStart(y)
+		line := m.buf.Line(y)
+		if !outdent {
+			if line != "" {
+				m.replace(editOther, start, start, unit)
+			}
+			continue
+		}
+		n := 0
+		if strings.HasPrefix(line, "\t") {
+			n = 1
+		} else {
+			for n < len(line) && n < width && line[n] == ' ' {
+				n++
+			}
+		}
+		m.replace(editOther, start, start+n, "")
+	}
+	m.history.end()
+	m.sel = selection{active: true, anchor: cursorPos{0, first}}
+	m.cursorY = last
+	m.cursorX = graphemeCount(m.buf.Line(last))
+}
+
+// lineSelected reports whether any part of line y falls in ranges, as
+// returned by selectionRanges.
+func (m Model) lineSelected(y int, ranges [][2]int) bool {
+	ls := m.buf.LineStart(y)
+	for _, r := range ranges {
+		if r[0] <= ls+len(m.buf.Line(y)) && r[1] > ls {
+			return true
+		}
+	}
+	return false
+}
+
+// clipboardCopiedMsg reports how sending a copy to the system clipboard
+// went.
+type clipboardCopiedMsg struct {
+	err error
+}
+
+// clipboardReadMsg delivers what the system clipboard held for a paste
+// into doc.
+type clipboardReadMsg struct {
+	doc   *document
+	text  string
+	paste func(m *Model, text string)
+}
+
+// copyText puts text on every clipboard and reports it in the status bar.
+func (m *Model) copyText(text, status string) tea.Cmd {
+	m.status = status
+	return m.copyToClipboard(text)
+}
+
+// copyToClipboard puts text on the kill ring and the terminal's clipboard
+// now and on the system clipboard in the returned command, whose tool may
+// take a while.
+func (m *Model) copyToClipboard(text string) tea.Cmd {
+	send := m.clip.Copy(text)
+	if send == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		return clipboardCopiedMsg{err: send()}
+	}
+}
+
+// readClipboard calls paste with the system clipboard, or the newest kill
+// when there is nothing to read it with. The clipboard tool runs in the
+// returned command, and paste in the document active now once it is done.
+func (m *Model) readClipboard(paste func(m *Model, text string)) tea.Cmd {
+	read := m.clip.ReadSystem()
+	if read == nil {
+		paste(m, m.clip.Paste(""))
+		return nil
+	}
+	doc := m.docs[m.active]
+	return func() tea.Msg {
+		return clipboardReadMsg{doc: doc, text: read(), paste: paste}
+	}
+}
+
+// clipboardRead pastes what readClipboard read.
+func (m *Model) clipboardRead(msg clipboardReadMsg) {
+	text := m.clip.Paste(msg.text)
+	if i := m.indexOf(msg.doc); i >= 0 {
+		m.inDocument(i, func() { msg.paste(m, text) })
+	}
+}
+
+// pasteText inserts text over the selection, or at the cursor, as a single
+// undo step however long it is.
+func (m *Model) pasteText(text string) {
+	if text == "" {
+		return
+	}
+	if !m.replaceSelection(text) {
+		m.history.seal()
+		off := m.cursorOffset()
+		m.replace(editOther, off, off, text)
+	}
+	m.history.seal()
+	m.ensureCursorVisible()
+}
+
+// pastedText returns the text of a bracketed paste with the carriage
+// returns terminals send for line breaks turned into newlines.
+func pastedText(msg tea.KeyMsg) string {
+	text := strings.ReplaceAll(string(msg.Runes), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// handleMouse places the cursor on click and extends the selection while
+// the left button is dragged.
+func (m *Model) handleMouse(msg tea.MouseMsg) {
+	if msg.Y == 1 && msg.Action == tea.MouseActionPress {
+		// The tab bar: click to switch, middle-click to close.
+		if i := m.tabAt(msg.X); i >= 0 {
+			switch msg.Button {
+			case tea.MouseButtonLeft:
+				m.switchTo(i)
+			case tea.MouseButtonMiddle:
+				m.closeTab(i)
+			}
+		}
+		return
+	}
+	top := 2 // header and tab bar
+	if m.searchBarShown() {
+		top++
+	}
+	if msg.X < sidebarWidth {
+		m.sidebarMouse(msg, msg.Y-top)
+		return
+	}
+	if l := m.paneAt(msg.X-sidebarWidth, msg.Y-top); l != nil && l != m.focus {
+		// The wheel scrolls the pane under the pointer; a click focuses it.
+		switch {
+		case msg.Button == tea.MouseButtonWheelUp:
+			m.scrollPane(l, -3)
+			return
+		case msg.Button == tea.MouseButtonWheelDown:
+			m.scrollPane(l, 3)
+			return
+		case msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft:
+			m.focusPane(l)
+		}
+	}
+	switch {
+	case msg.Button == tea.MouseButtonWheelUp:
+		m.scrollTop = max(0, m.scrollTop-3)
+		return
+	case msg.Button == tea.MouseButtonWheelDown:
+		m.scrollTop = max(0, min(m.buf.LineCount()-m.visibleRows, m.scrollTop+3))
+		return
+	}
+	y, x, ok := m.screenToText(msg.X, msg.Y)
+	if !ok {
+		return
+	}
+	switch msg.Action {
+	case tea.MouseActionPress:
+		if msg.Button != tea.MouseButtonLeft {
+			return
+		}
+		m.mode = "editor"
+		m.history.seal()
+		m.dragOrigin = cursorPos{x, y}
+		if msg.Alt {
+			// Alt+click adds a cursor; dragging on turns it into a column
+			// selection.
+			m.addCaret(caret{pos: cursorPos{x, y}})
+			return
+		}
+		m.clearCarets()
+		m.cursorX, m.cursorY = x, y
+		m.sel = selection{active: true, anchor: cursorPos{x, y}}
+	case tea.MouseActionMotion:
+		if msg.Button != tea.MouseButtonLeft {
+			return
+		}
+		if msg.Alt {
+			m.blockSelect(m.dragOrigin, cursorPos{x, y})
+			return
+		}
+		if !m.sel.active {
+			return
+		}
+		m.cursorX, m.cursorY = x, y
+		m.ensureCursorVisible()
+	case tea.MouseActionRelease:
+		if m.sel.active && m.sel.anchor == (cursorPos{m.cursorX, m.cursorY}) {
+			m.clearSelection()
+		}
+	}
+}
+
+// screenToText maps a terminal cell to a line and grapheme column.
+func (m Model) screenToText(x, y int) (int, int, bool) {
+	top := 3 + m.focus.y // header, tab bar and the pane's padding or title
+	if m.searchBarShown() {
+		top++
+	}
+	left := sidebarWidth + m.focus.x + 2 + gutterWidth
+	if y < top || x < sidebarWidth+m.focus.x {
+		return 0, 0, false
+	}
+	line := m.scrollTop + y - top
+	if line >= m.buf.LineCount() {
+		line = m.buf.LineCount() - 1
+	}
+	text := m.buf.Line(line)
+	target := x - left
+	if target < 0 {
+		return line, 0, true
+	}
+
+	l := m.layoutLine(text)
+	if l == nil {
+		l = logicalLayout(text)
+	}
+	width := 0
+	for _, c := range l.order {
+		w := displayWidth(text[l.bounds[c]:l.bounds[c+1]])
+		if target < width+w {
+			return line, c, true
+		}
+		width += w
+	}
+	return line, len(l.order), true
+}
@@ -0,0 +1,173 @@
+package editor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// configPollInterval is how often the settings files are checked for
+// changes.
+const configPollInterval = 2 * time.Second
+
+type configTickMsg struct{}
+
+func watchConfig() tea.Cmd {
+	return tea.Tick(configPollInterval, func(time.Time) tea.Msg { return configTickMsg{} })
+}
+
+// applyConfig switches to cfg and reports the problems found loading it
+// in the status bar.
+func (m *Model) applyConfig(cfg config.Config, errs []error) {
+	old := m.cfg
+	m.cfg = cfg
+	m.history.limit = cfg.UndoLimit
+	for _, d := range m.docs {
+		d.history.limit = cfg.UndoLimit
+	}
+	if cfg.KeyProfile != old.KeyProfile {
+		m.setKeyProfile(cfg.KeyProfile)
+	}
+	if m.tree != nil && (cfg.ShowHidden != old.ShowHidden || !slices.Equal(cfg.Exclude, old.Exclude)) {
+		m.ignore = nil
+		m.newIgnore(m.dir)
+		m.tree.Hide = m.ignore.Ignored
+		m.refreshTree()
+	}
+	if m.height > 0 {
+		m.resize()
+	}
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		m.status = "settings: " + strings.Join(msgs, "; ")
+	}
+}
+
+// reloadConfig reads the settings again when a settings file changed.
+func (m *Model) reloadConfig() {
+	stamp := config.Stamp(m.dir)
+	if stamp == m.cfgStamp {
+		return
+	}
+	m.cfgStamp = stamp
+	cfg, errs := config.Load(m.dir)
+	m.status = "Settings reloaded"
+	if cfg.Shell != m.cfg.Shell {
+		m.status += " (the new shell starts with the next session)"
+	}
+	m.applyConfig(cfg, errs)
+}
+
+// langSettings returns the settings for the current language.
+// An .editorconfig that applies to the file takes precedence over the
+// settings files.
+func (m *Model) langSettings() config.LanguageSettings {
+	s := m.cfg.For(m.lang)
+	switch m.ec.IndentStyle() {
+	case "tab":
+		s.InsertSpaces = false
+	case "space":
+		s.InsertSpaces = true
+	}
+	if n := m.ec.IndentSize(); n > 0 {
+		s.TabWidth = n
+	} else if n := m.ec.TabWidth(); n > 0 {
+		s.TabWidth = n
+	}
+	return s
+}
+
+// indentUnit is one level of indentation for the current language.
+func (m *Model) indentUnit() string {
+	s := m.langSettings()
+	if s.InsertSpaces {
+		return strings.Repeat(" ", s.TabWidth)
+	}
+	return "\t"
+}
+
+// formatTimeout is how long a formatter may run before it is stopped.
+const formatTimeout = 10 * time.Second
+
+// formatDoneMsg carries what a formatter made of a document's text.
+type formatDoneMsg struct {
+	doc       *document
+	formatter string
+	text      string // what was formatted
+	out       string
+	err       error
+	stderr    string
+}
+
+// formatDocument pipes the buffer through the language's formatter. It
+// runs in the returned command; formatted applies the output.
+func (m *Model) formatDocument() tea.Cmd {
+	formatter := m.langSettings().Formatter
+	if formatter == "" {
+		m.status = fmt.Sprintf("No formatter configured for %s", m.lang)
+		return nil
+	}
+	doc, buf := m.docs[m.active], m.buf.Clone()
+	m.status = fmt.Sprintf("Formatting with %s ...", formatter)
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), formatTimeout)
+		defer cancel()
+		text := buf.String()
+		var out, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", formatter)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		// Children of the shell may keep its output open after it is
+		// killed.
+		cmd.WaitDelay = time.Second
+		err := cmd.Run()
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", formatTimeout)
+		}
+		return formatDoneMsg{doc: doc, formatter: formatter, text: text, out: out.String(), err: err, stderr: stderr.String()}
+	}
+}
+
+// formatted replaces the text of the document formatDocument ran on with
+// the formatter's output, as one undo step, unless the text was edited
+// while the formatter ran.
+func (m *Model) formatted(msg formatDoneMsg) {
+	if msg.err != nil {
+		line := strings.SplitN(strings.TrimSpace(msg.stderr), "\n", 2)[0]
+		m.status = fmt.Sprintf("%s: %v %s", msg.formatter, msg.err, line)
+		return
+	}
+	i := m.indexOf(msg.doc)
+	if i < 0 {
+		return
+	}
+	m.inDocument(i, func() {
+		switch {
+		case m.buf.String() != msg.text:
+			m.status = "Not formatted: the text changed while the formatter ran"
+		case msg.out == msg.text:
+			m.status = "Already formatted"
+		default:
+			x, y := m.cursorX, m.cursorY
+			m.clearCarets()
+			m.clearSelection()
+			m.history.seal()
+			m.replace(editOther, 0, len(msg.text), msg.out)
+			m.history.seal()
+			m.cursorY = min(y, m.buf.LineCount()-1)
+			m.cursorX = min(x, graphemeCount(m.buf.Line(m.cursorY)))
+			m.status = "Formatted with " + msg.formatter
+		}
+	})
+}
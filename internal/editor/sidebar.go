@@ -0,0 +1,309 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/filetree"
+	"github.com/Mohammad-Alipour/Gonsole/internal/ignore"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The sidebar shows the directory tree rooted at m.dir. Which directories
+// are expanded, and the selected entry, are kept between sessions in the
+// user cache directory, one file per root.
+
+const treeStateVersion = 1
+
+type treeState struct {
+	Version  int      `json:"version"`
+	Root     string   `json:"root"`
+	Expanded []string `json:"expanded"`
+	Selected string   `json:"selected,omitempty"`
+}
+
+// treeStatePath returns where the sidebar state for the root dir lives.
+func treeStatePath(dir string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(cache, "gonsole", "tree", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// loadDir shows the tree rooted at dir, expanded as it was left.
+func (m *Model) loadDir(dir string) {
+	defer m.syncWatches()
+	m.newIgnore(dir)
+	if m.tree == nil {
+		m.tree = filetree.New(dir, m.ignore.Ignored)
+	} else {
+		m.tree.Hide = m.ignore.Ignored
+		m.tree.SetRoot(dir)
+	}
+	m.dir = m.tree.Root.Path
+	m.selectedIdx, m.sidebarTop = 0, 0
+	path, err := treeStatePath(m.dir)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var s treeState
+	if json.Unmarshal(data, &s) != nil || s.Version != treeStateVersion || s.Root != m.dir {
+		return
+	}
+	m.tree.SetExpanded(s.Expanded)
+	m.selectPath(s.Selected)
+}
+
+// newIgnore sets up what is left out of the tree rooted at dir, keeping
+// hidden files shown if they were.
+func (m *Model) newIgnore(dir string) {
+	showHidden := m.cfg.ShowHidden
+	if m.ignore != nil {
+		showHidden = m.ignore.ShowHidden
+	}
+	// The settings checked the patterns already.
+	m.ignore, _ = ignore.New(dir, m.cfg.Exclude)
+	m.ignore.ShowHidden = showHidden
+}
+
+// toggleHidden shows or hides files whose names start with a dot.
+func (m *Model) toggleHidden() {
+	m.ignore.ShowHidden = !m.ignore.ShowHidden
+	m.refreshTree()
+	if m.ignore.ShowHidden {
+		m.status = "Showing hidden files"
+	} else {
+		m.status = "Hiding hidden files"
+	}
+}
+
+// saveTreeState records what is expanded and selected in the sidebar.
+func (m *Model) saveTreeState() {
+	path, err := treeStatePath(m.dir)
+	if err != nil {
+		return
+	}
+	s := treeState{Version: treeStateVersion, Root: m.dir, Expanded: m.tree.ExpandedPaths()}
+	if n := m.selectedNode(); n != nil {
+		s.Selected = n.Path
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(path), 0o700) == nil {
+		_ = os.WriteFile(path, data, 0o600)
+	}
+}
+
+// sidebarRows returns the entries shown in the sidebar. A nil entry at the
+// top leads up to the parent directory.
+func (m *Model) sidebarRows() []*filetree.Node {
+	rows := m.tree.Visible()
+	if filepath.Dir(m.dir) != m.dir {
+		rows = append([]*filetree.Node{nil}, rows...)
+	}
+	return rows
+}
+
+// selectedNode returns the selected tree node, or nil for the parent
+// entry or an empty tree.
+func (m *Model) selectedNode() *filetree.Node {
+	rows := m.sidebarRows()
+	if m.selectedIdx < 0 || m.selectedIdx >= len(rows) {
+		return nil
+	}
+	return rows[m.selectedIdx]
+}
+
+// selectPath selects the entry for path if it is shown.
+func (m *Model) selectPath(path string) {
+	for i, n := range m.sidebarRows() {
+		if n != nil && n.Path == path {
+			m.selectRow(i)
+			return
+		}
+	}
+}
+
+// selectRow selects row i and scrolls the sidebar to keep it in view.
+func (m *Model) selectRow(i int) {
+	rows := m.sidebarRows()
+	m.selectedIdx = max(0, min(i, len(rows)-1))
+	height := m.sidebarHeight()
+	if m.selectedIdx < m.sidebarTop {
+		m.sidebarTop = m.selectedIdx
+	} else if m.selectedIdx >= m.sidebarTop+height {
+		m.sidebarTop = m.selectedIdx - height + 1
+	}
+	m.sidebarTop = max(0, min(m.sidebarTop, len(rows)-height))
+}
+
+// sidebarHeight returns how many entries fit in the sidebar.
+func (m *Model) sidebarHeight() int {
+	return max(1, m.root.height-2)
+}
+
+// refreshTree reads the tree again, keeping the selected entry selected
+// when it is still there.
+func (m *Model) refreshTree() {
+	var selected string
+	if n := m.selectedNode(); n != nil {
+		selected = n.Path
+	}
+	m.ignore.Reset()
+	m.tree.Refresh()
+	m.selectRow(m.selectedIdx)
+	if selected != "" {
+		m.selectPath(selected)
+	}
+	m.syncWatches()
+}
+
+// expandSelected expands the selected directory or, when it is expanded
+// already, moves to its first entry.
+func (m *Model) expandSelected() {
+	n := m.selectedNode()
+	if n == nil || !n.Dir {
+		return
+	}
+	if m.tree.IsExpanded(n) {
+		if len(n.Children) > 0 {
+			m.selectRow(m.selectedIdx + 1)
+		}
+		return
+	}
+	m.tree.Expand(n)
+	m.saveTreeState()
+	m.syncWatches()
+}
+
+// collapseSelected collapses the selected directory or, when it is not
+// expanded, moves to the directory it is in.
+func (m *Model) collapseSelected() {
+	n := m.selectedNode()
+	if n == nil {
+		return
+	}
+	if m.tree.IsExpanded(n) {
+		m.tree.Collapse(n)
+		m.saveTreeState()
+		m.syncWatches()
+		return
+	}
+	if n.Parent != m.tree.Root {
+		m.selectPath(n.Parent.Path)
+	}
+}
+
+// sidebarParent moves the root of the tree up to its parent directory,
+// keeping the old root expanded and selected.
+func (m *Model) sidebarParent() {
+	parent := filepath.Dir(m.dir)
+	if parent == m.dir {
+		return
+	}
+	old := m.dir
+	m.saveTreeState()
+	m.loadDir(parent)
+	if n := m.tree.Reveal(old); n != nil {
+		m.tree.Expand(n)
+		m.selectPath(old)
+	}
+	m.saveTreeState()
+	m.syncWatches()
+}
+
+// revealFile shows the active file in the sidebar, expanding the
+// directories above it. A file outside the tree moves the root to its
+// directory.
+func (m *Model) revealFile() {
+	if m.file == "" {
+		m.status = "No file to reveal"
+		return
+	}
+	abs, err := filepath.Abs(m.file)
+	if err != nil {
+		return
+	}
+	n := m.tree.Reveal(abs)
+	if n == nil && m.ignore.Ignored(abs, false) {
+		m.status = m.treeRel(abs) + " is excluded from the sidebar"
+		return
+	}
+	if n == nil {
+		m.loadDir(filepath.Dir(abs))
+		n = m.tree.Reveal(abs)
+	}
+	if n != nil {
+		m.selectPath(n.Path)
+		m.saveTreeState()
+		m.syncWatches()
+	}
+	m.mode = "sidebar"
+}
+
+// sidebarLabel returns how n is shown in the sidebar.
+func (m Model) sidebarLabel(n *filetree.Node) string {
+	if n == nil {
+		return "  📁 .."
+	}
+	indent := strings.Repeat("  ", n.Depth())
+	switch {
+	case !n.Dir:
+		return indent + "  📄 " + n.Name
+	case m.tree.IsExpanded(n):
+		return indent + "▾ 📂 " + n.Name
+	default:
+		return indent + "▸ 📁 " + n.Name
+	}
+}
+
+func (m Model) renderSidebar() string {
+	var out []string
+	if m.tree.Root.Err != nil {
+		out = append(out, "<cannot read dir>")
+	}
+	rows := m.sidebarRows()
+	for i := m.sidebarTop; i < len(rows) && i < m.sidebarTop+m.sidebarHeight(); i++ {
+		label := m.sidebarLabel(rows[i])
+		if i == m.selectedIdx && m.mode == "sidebar" {
+			out = append(out, activeFileStyle.Render("→ "+label))
+		} else {
+			out = append(out, "  "+label)
+		}
+	}
+	text := lipgloss.NewStyle().MaxWidth(sidebarWidth - 2).Render(strings.Join(out, "\n"))
+	return sidebarStyle.Width(sidebarWidth).Height(m.root.height).Render(text)
+}
+
+// sidebarMouse handles the mouse over the sidebar, y rows below its top:
+// the wheel scrolls it and a click selects an entry and opens it.
+func (m *Model) sidebarMouse(msg tea.MouseMsg, y int) {
+	rows := m.sidebarRows()
+	switch {
+	case msg.Button == tea.MouseButtonWheelUp:
+		m.sidebarTop = max(0, m.sidebarTop-3)
+	case msg.Button == tea.MouseButtonWheelDown:
+		m.sidebarTop = max(0, min(len(rows)-m.sidebarHeight(), m.sidebarTop+3))
+	case msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft:
+		i := m.sidebarTop + y - 1 // below the padding
+		if y < 1 || i >= len(rows) {
+			return
+		}
+		m.mode = "sidebar"
+		m.selectRow(i)
+		m.openSidebarEntry()
+	}
+}
@@ -0,0 +1,270 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/buffer"
+	"github.com/Mohammad-Alipour/Gonsole/internal/diff"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// While a document has unsaved changes its text is written every few
+// seconds to a swap file in the user cache directory, named after a hash
+// of the document's path and the process ID, so that sessions editing the
+// same file do not overwrite each other's. Saving the document, or
+// leaving it without saving, removes the swap file. One that is left
+// behind by a process that is gone means the changes were never saved,
+// and opening the file offers to recover them.
+
+const (
+	swapInterval    = 4 * time.Second
+	swapFileVersion = 1
+)
+
+type swapFile struct {
+	Version int       `json:"version"`
+	Path    string    `json:"path"`
+	PID     int       `json:"pid"`
+	Written time.Time `json:"written"`
+	Text    string    `json:"text"`
+}
+
+type swapTickMsg struct{}
+
+func watchSwap() tea.Cmd {
+	return tea.Tick(swapInterval, func(time.Time) tea.Msg { return swapTickMsg{} })
+}
+
+// swapFilePrefix returns the start of the names of the swap files for the
+// document at path.
+func swapFilePrefix(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "gonsole", "swap", hex.EncodeToString(sum[:16])), nil
+}
+
+// swapWrite is a swap file to be written: a snapshot of a document's text
+// taken on the Update goroutine, so that the writing can happen off it.
+type swapWrite struct {
+	doc   *document
+	file  string
+	text  buffer.Buffer
+	state *undoNode
+	path  string // written, once done
+	err   error
+}
+
+// swapWrittenMsg reports the swap files a writeSwapFiles command wrote.
+type swapWrittenMsg struct {
+	writes []swapWrite
+}
+
+// writeSwapFiles brings the swap file of every open document up to date:
+// written when the document has changed since it was last written,
+// removed when there is nothing unsaved. The writing happens in the
+// returned command, which reports back with a swapWrittenMsg; the next
+// tick is scheduled once it has.
+func (m *Model) writeSwapFiles() tea.Cmd {
+	m.stash()
+	var writes []swapWrite
+	for _, d := range m.docs {
+		switch {
+		case d.file == "" || d.history.current == d.history.saved:
+			d.removeSwapFile()
+		case d.swapped != d.history.current:
+			writes = append(writes, swapWrite{doc: d, file: d.file, text: d.buf.Clone(), state: d.history.current})
+		}
+	}
+	m.swapPath, m.swapped = m.docs[m.active].swapPath, m.docs[m.active].swapped
+	if len(writes) == 0 {
+		return watchSwap()
+	}
+	return func() tea.Msg {
+		for i := range writes {
+			writes[i].path, writes[i].err = writes[i].write()
+		}
+		return swapWrittenMsg{writes: writes}
+	}
+}
+
+// write writes the swap file and returns its path.
+func (w swapWrite) write() (string, error) {
+	prefix, err := swapFilePrefix(w.file)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("%s.%d.json", prefix, os.Getpid())
+	abs, _ := filepath.Abs(w.file)
+	data, err := json.Marshal(swapFile{
+		Version: swapFileVersion,
+		Path:    abs,
+		PID:     os.Getpid(),
+		Written: time.Now(),
+		Text:    w.text.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// swapFilesWritten records the swap files written by writeSwapFiles. One
+// that is no longer wanted, because its document was saved, renamed or
+// closed meanwhile, is removed again.
+func (m *Model) swapFilesWritten(msg swapWrittenMsg) error {
+	var first error
+	for _, w := range msg.writes {
+		if w.err != nil {
+			if first == nil {
+				first = w.err
+			}
+			continue
+		}
+		i := m.indexOf(w.doc)
+		if i < 0 {
+			os.Remove(w.path)
+			continue
+		}
+		m.inDocument(i, func() {
+			if m.file != w.file || m.history.current == m.history.saved {
+				if w.path != m.swapPath {
+					os.Remove(w.path)
+				}
+				return
+			}
+			if m.swapPath != "" && m.swapPath != w.path {
+				os.Remove(m.swapPath)
+			}
+			m.swapPath, m.swapped = w.path, w.state
+		})
+	}
+	return first
+}
+
+// removeSwapFile deletes the swap file this session wrote, if any.
+func (d *document) removeSwapFile() {
+	if d.swapPath != "" {
+		os.Remove(d.swapPath)
+	}
+	d.swapPath, d.swapped = "", nil
+}
+
+// removeSwapFile deletes the active document's swap file.
+func (m *Model) removeSwapFile() {
+	d := m.current()
+	d.removeSwapFile()
+	m.swapPath, m.swapped = "", nil
+}
+
+// processAlive reports whether the process pid is still running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// checkRecovery looks for changes to the current file that an earlier
+// session did not save and, when there are any newer than the file on
+// disk, asks whether to recover them, showing how they differ from it.
+func (m *Model) checkRecovery() {
+	if m.file == "" {
+		return
+	}
+	prefix, err := swapFilePrefix(m.file)
+	if err != nil {
+		return
+	}
+	names, _ := filepath.Glob(prefix + ".*.json")
+	var found []swapFile
+	var paths []string
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var f swapFile
+		if err := json.Unmarshal(data, &f); err != nil || f.Version != swapFileVersion {
+			os.Remove(name)
+			continue
+		}
+		if f.PID != os.Getpid() && processAlive(f.PID) {
+			m.status = fmt.Sprintf("%s is also being edited by process %d", filepath.Base(m.file), f.PID)
+			continue
+		}
+		if fi, err := os.Stat(m.file); (err == nil && fi.ModTime().After(f.Written)) || f.Text == m.buf.String() {
+			// Saved since, or nothing to recover.
+			os.Remove(name)
+			continue
+		}
+		found = append(found, f)
+		paths = append(paths, name)
+	}
+	if len(found) == 0 {
+		return
+	}
+	newest := 0
+	for i := range found {
+		if found[i].Written.After(found[newest].Written) {
+			newest = i
+		}
+	}
+	f, name := found[newest], paths[newest]
+	script := diff.Lines(strings.Split(m.buf.String(), "\n"), strings.Split(f.Text, "\n"))
+	m.ask(fmt.Sprintf("Unsaved changes to %s from %s were found.", filepath.Base(m.file), f.Written.Format("Jan 2 15:04:05")),
+		promptChoice{key: "r", label: "Recover", run: func(m *Model) tea.Cmd {
+			m.recover(f.Text)
+			os.Remove(name)
+			return nil
+		}},
+		promptChoice{key: "d", label: "Discard", run: func(m *Model) tea.Cmd {
+			os.Remove(name)
+			m.status = "Discarded the recovered changes"
+			return nil
+		}})
+	m.prompt.preview = diff.Unified(script, 3)
+}
+
+// recover replaces the buffer with recovered text as one undo step, so
+// that it shows as unsaved and can be undone.
+func (m *Model) recover(text string) {
+	m.replaceAll(text)
+	m.status = "Recovered unsaved changes; save to keep them"
+}
+
+// replaceAll replaces the whole buffer with text as one undo step,
+// keeping the cursor where it was as far as the new text allows.
+func (m *Model) replaceAll(text string) {
+	x, y := m.cursorX, m.cursorY
+	m.clearCarets()
+	m.clearSelection()
+	m.history.seal()
+	m.replace(editOther, 0, m.buf.Len(), text)
+	m.history.seal()
+	m.cursorY = min(y, m.buf.LineCount()-1)
+	m.cursorX = min(x, graphemeCount(m.buf.Line(m.cursorY)))
+}
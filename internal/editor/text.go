@@ -0,0 +1,135 @@
+package editor
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rivo/uniseg"
+)
+
+// Cursor columns are counted in grapheme clusters so that an accented
+// letter, a CJK ideograph or an emoji with modifiers is always one step
+// for the cursor, one unit for backspace and never split when rendering.
+
+// graphemeBounds returns the byte offset of every grapheme cluster start in
+// s followed by len(s).
+func graphemeBounds(s string) []int {
+	bounds := make([]int, 0, len(s)+1)
+	state := -1
+	pos := 0
+	for rest := s; rest != ""; {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		bounds = append(bounds, pos)
+		pos += len(cluster)
+	}
+	return append(bounds, len(s))
+}
+
+// graphemeCount returns the number of grapheme clusters in s.
+func graphemeCount(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
+
+// byteCol converts a grapheme column into a byte offset within s, clamping
+// columns past the end of the line.
+func byteCol(s string, col int) int {
+	if col <= 0 {
+		return 0
+	}
+	state := -1
+	pos := 0
+	for rest := s; rest != "" && col > 0; col-- {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		pos += len(cluster)
+	}
+	return pos
+}
+
+// graphemeCol converts a byte offset within s into a grapheme column. An
+// offset inside a cluster maps to the cluster that contains it.
+func graphemeCol(s string, off int) int {
+	if off > len(s) {
+		off = len(s)
+	}
+	state := -1
+	col, pos := 0, 0
+	for rest := s; rest != ""; col++ {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		if pos+len(cluster) > off {
+			return col
+		}
+		pos += len(cluster)
+	}
+	return col
+}
+
+// graphemeAt returns the cluster starting at byte offset off.
+func graphemeAt(s string, off int) string {
+	if off >= len(s) {
+		return ""
+	}
+	cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(s[off:], -1)
+	return cluster
+}
+
+// displayWidth returns the number of terminal cells s occupies, counting
+// East Asian wide characters and emoji as two.
+func displayWidth(s string) int {
+	return uniseg.StringWidth(s)
+}
+
+// indexFold finds q in s ignoring case and returns the byte range of the
+// match in s. Unlike searching a lowercased copy, the range is always valid
+// for s even when case folding changes the encoded length.
+func indexFold(s, q string) (int, int) {
+	if q == "" {
+		return -1, -1
+	}
+	n := utf8.RuneCountInString(q)
+	for i := 0; i < len(s); {
+		j, k := i, 0
+		for ; k < n && j < len(s); k++ {
+			_, size := utf8.DecodeRuneInString(s[j:])
+			j += size
+		}
+		if k == n && strings.EqualFold(s[i:j], q) {
+			return i, j
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return -1, -1
+}
+
+// dropLastGrapheme removes the final grapheme cluster from s.
+func dropLastGrapheme(s string) string {
+	bounds := graphemeBounds(s)
+	if len(bounds) < 2 {
+		return s
+	}
+	return s[:bounds[len(bounds)-2]]
+}
+
+// typedText returns the text a key press should insert, if any. Pasted
+// input and alt chords are not typing.
+func typedText(msg tea.KeyMsg) (string, bool) {
+	switch {
+	case msg.Paste || msg.Alt:
+		return "", false
+	case msg.Type == tea.KeyRunes:
+		return string(msg.Runes), true
+	case msg.Type == tea.KeySpace:
+		return " ", true
+	}
+	return "", false
+}
+
+// displayCol returns the terminal column of the cursor on its line.
+func (m Model) displayCol() int {
+	line := m.buf.Line(m.cursorY)
+	return displayWidth(line[:byteCol(line, m.cursorX)])
+}
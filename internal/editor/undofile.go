@@ -0,0 +1,189 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Undo trees are kept between sessions in the user cache directory, one
+// JSON file per document named after a hash of its absolute path. The file
+// also records a hash of the document content the tree was saved against;
+// a tree is only restored when that content is still what is on disk.
+
+const undoFileVersion = 1
+
+type undoFile struct {
+	Version int            `json:"version"`
+	Path    string         `json:"path"`
+	Hash    string         `json:"hash"`
+	Current int            `json:"current"`
+	Seq     int            `json:"seq"`
+	Nodes   []undoFileNode `json:"nodes"`
+}
+
+type undoFileNode struct {
+	Seq    int            `json:"seq"`
+	Parent int            `json:"parent"` // -1 for the root
+	When   time.Time      `json:"when"`
+	Active int            `json:"active"`
+	Kind   editKind       `json:"kind"`
+	Edits  []undoFileEdit `json:"edits,omitempty"`
+	Before [2]int         `json:"before"`
+	After  [2]int         `json:"after"`
+}
+
+type undoFileEdit struct {
+	Offset       int      `json:"offset"`
+	Deleted      string   `json:"deleted,omitempty"`
+	Inserted     string   `json:"inserted,omitempty"`
+	DeletedEOLs  []string `json:"deletedEOLs,omitempty"`
+	InsertedEOLs []string `json:"insertedEOLs,omitempty"`
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// undoFilePath returns where the undo tree of the document at path lives.
+func undoFilePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "gonsole", "undo", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// saveUndoFile writes the undo tree with the saved state as the current
+// node, since that is the state the file on disk will be reopened in.
+func (m *Model) saveUndoFile() error {
+	if m.file == "" || m.history.saved == nil {
+		return nil
+	}
+	path, err := undoFilePath(m.file)
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(m.file)
+	h := &m.history
+	f := undoFile{
+		Version: undoFileVersion,
+		Path:    abs,
+		Hash:    m.diskHash,
+		Current: h.saved.seq,
+		Seq:     h.seq,
+	}
+	for _, n := range h.nodes() {
+		parent := -1
+		if n.parent != nil {
+			parent = n.parent.seq
+		}
+		fn := undoFileNode{
+			Seq:    n.seq,
+			Parent: parent,
+			When:   n.when,
+			Active: n.active,
+			Kind:   n.group.kind,
+			Before: [2]int{n.group.before.x, n.group.before.y},
+			After:  [2]int{n.group.after.x, n.group.after.y},
+		}
+		for _, e := range n.group.edits {
+			fn.Edits = append(fn.Edits, undoFileEdit{
+				Offset: e.offset, Deleted: e.deleted, Inserted: e.inserted,
+				DeletedEOLs: e.deletedEOLs, InsertedEOLs: e.insertedEOLs,
+			})
+		}
+		f.Nodes = append(f.Nodes, fn)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadUndoFile restores the undo tree saved for path when it was recorded
+// against content. A stale or unreadable tree is deleted.
+func (m *Model) loadUndoFile(path string, content []byte) error {
+	file, err := undoFilePath(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f undoFile
+	abs, _ := filepath.Abs(path)
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != undoFileVersion || f.Path != abs {
+		_ = os.Remove(file)
+		return errors.New("discarded unreadable undo history")
+	}
+	if f.Hash != contentHash(content) {
+		_ = os.Remove(file)
+		return errors.New("file changed since last session, undo history discarded")
+	}
+
+	h := history{limit: m.history.limit, seq: f.Seq}
+	bySeq := make(map[int]*undoNode, len(f.Nodes))
+	for _, fn := range f.Nodes {
+		n := &undoNode{
+			seq:    fn.Seq,
+			when:   fn.When,
+			active: fn.Active,
+			group: undoGroup{
+				kind:   fn.Kind,
+				before: cursorPos{fn.Before[0], fn.Before[1]},
+				after:  cursorPos{fn.After[0], fn.After[1]},
+			},
+		}
+		for _, e := range fn.Edits {
+			n.group.edits = append(n.group.edits, edit{
+				offset: e.Offset, deleted: e.Deleted, inserted: e.Inserted,
+				deletedEOLs: e.DeletedEOLs, insertedEOLs: e.InsertedEOLs,
+			})
+		}
+		bySeq[fn.Seq] = n
+		if fn.Parent == -1 {
+			h.root = n
+			continue
+		}
+		parent, ok := bySeq[fn.Parent]
+		if !ok {
+			_ = os.Remove(file)
+			return errors.New("discarded corrupt undo history")
+		}
+		n.parent = parent
+		parent.children = append(parent.children, n)
+	}
+	h.current = bySeq[f.Current]
+	if h.root == nil || h.current == nil {
+		_ = os.Remove(file)
+		return errors.New("discarded corrupt undo history")
+	}
+	h.count = h.size(h.root)
+	h.saved = h.current
+	h.seal()
+	m.history = h
+	return nil
+}
@@ -0,0 +1,155 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	undoTreeTitleStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#00BFFF")).
+				Bold(true)
+
+	undoTreeCurrentStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#00FF88")).
+				Bold(true)
+)
+
+// undoTreeRow is one line of the undo tree panel.
+type undoTreeRow struct {
+	node   *undoNode
+	indent int
+}
+
+// undoTreeRows flattens the tree depth first. The first child continues
+// its parent's column and every later sibling opens a new branch one
+// column to the right.
+func (m Model) undoTreeRows() []undoTreeRow {
+	var rows []undoTreeRow
+	var walk func(n *undoNode, indent int)
+	walk = func(n *undoNode, indent int) {
+		rows = append(rows, undoTreeRow{node: n, indent: indent})
+		for i, c := range n.children {
+			if i == 0 {
+				walk(c, indent)
+			} else {
+				walk(c, indent+1)
+			}
+		}
+	}
+	walk(m.history.root, 0)
+	return rows
+}
+
+func (m Model) openUndoTree() Model {
+	m.showUndoTree = true
+	m.undoTreeInput = ""
+	m.undoTreeInputActive = false
+	for i, r := range m.undoTreeRows() {
+		if r.node == m.history.current {
+			m.undoTreeIdx = i
+		}
+	}
+	return m
+}
+
+func (m Model) updateUndoTree(msg tea.KeyMsg) (Model, tea.Cmd) {
+	k := msg.String()
+	if m.undoTreeInputActive {
+		switch k {
+		case "esc":
+			m.undoTreeInputActive = false
+		case "backspace":
+			m.undoTreeInput = dropLastGrapheme(m.undoTreeInput)
+		case "enter":
+			m.undoTreeInputActive = false
+			mins, err := strconv.Atoi(strings.TrimSpace(m.undoTreeInput))
+			if err != nil || mins < 0 {
+				m.status = fmt.Sprintf("invalid number of minutes: %q", m.undoTreeInput)
+				return m, nil
+			}
+			m.jumpTo(m.history.stateAt(time.Now().Add(-time.Duration(mins) * time.Minute)))
+			m.ensureCursorVisible()
+			m.status = fmt.Sprintf("Restored state as of %d minute(s) ago", mins)
+			return m.openUndoTree(), nil
+		default:
+			if text, ok := typedText(msg); ok {
+				m.undoTreeInput += text
+			}
+		}
+		return m, nil
+	}
+
+	rows := m.undoTreeRows()
+	switch k {
+	case "esc", "ctrl+u":
+		m.showUndoTree = false
+	case "up":
+		if m.undoTreeIdx > 0 {
+			m.undoTreeIdx--
+		}
+	case "down":
+		if m.undoTreeIdx < len(rows)-1 {
+			m.undoTreeIdx++
+		}
+	case "enter":
+		if m.undoTreeIdx < len(rows) {
+			m.jumpTo(rows[m.undoTreeIdx].node)
+			m.ensureCursorVisible()
+		}
+	case "e":
+		m.undoTreeInputActive = true
+		m.undoTreeInput = ""
+	}
+	return m, nil
+}
+
+func (m Model) renderUndoTree() string {
+	var b strings.Builder
+	b.WriteString(undoTreeTitleStyle.Render("Undo tree") + "\n\n")
+	rows := m.undoTreeRows()
+	// Keep the selection in view when the tree is taller than the panel.
+	height := max(5, m.height-12)
+	first := 0
+	if m.undoTreeIdx >= height {
+		first = m.undoTreeIdx - height + 1
+	}
+	for i := first; i < len(rows) && i < first+height; i++ {
+		r := rows[i]
+		n := r.node
+		marker := "○"
+		if n == m.history.current {
+			marker = "●"
+		}
+		label := "original"
+		if n.parent != nil {
+			ins, del := 0, 0
+			for _, e := range n.group.edits {
+				ins += graphemeCount(e.inserted)
+				del += graphemeCount(e.deleted)
+			}
+			label = fmt.Sprintf("#%d +%d -%d", n.seq, ins, del)
+		}
+		line := fmt.Sprintf("%s%s %s %s", strings.Repeat("│ ", r.indent), marker, n.when.Format("15:04:05"), label)
+		switch {
+		case i == m.undoTreeIdx:
+			b.WriteString(activeFileStyle.Render("→ "+line) + "\n")
+		case n == m.history.current:
+			b.WriteString(undoTreeCurrentStyle.Render("  "+line) + "\n")
+		default:
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	b.WriteString("\n")
+	if m.undoTreeInputActive {
+		b.WriteString(fmt.Sprintf("Minutes ago: %s", m.undoTreeInput))
+	} else {
+		b.WriteString("↑/↓ select · Enter jump\ne N minutes ago · Esc close")
+	}
+	return sidebarStyle.Width(sidebarWidth).Height(m.root.height).Render(b.String())
+}
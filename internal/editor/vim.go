@@ -0,0 +1,1540 @@
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Vim emulation. With the vim key profile active, keys in the editor pane
+// go to handleVimKey first. In normal and visual mode keys are collected
+// until they form a complete command, which then runs on the buffer
+// through the same replace, undo and search code as the default keys.
+// Insert mode hands every key but Esc back to the default handling.
+
+type vimMode int
+
+const (
+	vimNormal vimMode = iota
+	vimInsert
+	vimVisual
+	vimVisualLine
+	vimCmdline
+)
+
+type vimState struct {
+	mode     vimMode
+	pending  []tea.KeyMsg // keys of the command being typed
+	cmdline  string
+	visual   [2]int // first and last line of the last visual selection
+	want     int    // column j and k aim for
+	lastFind string // last f, t, F or T with its character, e.g. "tx"
+	linewise map[rune]bool
+
+	inserting  bool         // an insert session is open as one undo step
+	recording  []tea.KeyMsg // keys of the change being made, for dot-repeat
+	lastChange []tea.KeyMsg
+	replaying  bool
+}
+
+// vimCmd is a parsed normal or visual mode command.
+type vimCmd struct {
+	reg    rune
+	count  int // 0 when none was typed
+	op     string
+	motion string // motion, text object ("iw", "a(") or command
+	arg    string // character argument of f, t, F, T and r
+}
+
+// vimTarget is where a motion lands and how an operator treats it.
+type vimTarget struct {
+	off       int
+	linewise  bool
+	inclusive bool
+}
+
+const (
+	vimIncomplete = iota
+	vimComplete
+	vimInvalid
+)
+
+var (
+	vimOperators = map[string]bool{"d": true, "c": true, "y": true, ">": true, "<": true}
+
+	vimMotions = map[string]bool{
+		"h": true, "j": true, "k": true, "l": true, "w": true, "b": true, "e": true,
+		"W": true, "B": true, "E": true, "0": true, "^": true, "$": true, "G": true,
+		"%": true, ";": true, ",": true, "n": true, "N": true, "+": true, "-": true,
+		"left": true, "right": true, "up": true, "down": true, "home": true, "end": true,
+		" ": true, "backspace": true, "enter": true,
+	}
+
+	vimCommands = map[string]bool{
+		"i": true, "a": true, "I": true, "A": true, "o": true, "O": true,
+		"x": true, "X": true, "D": true, "C": true, "s": true, "S": true, "Y": true,
+		"p": true, "P": true, "u": true, "ctrl+r": true, ".": true, "J": true,
+		"r": true, "~": true, "v": true, "V": true, ":": true, "/": true, "*": true,
+		"ctrl+w": true,
+	}
+
+	vimVisualCommands = map[string]bool{
+		"x": true, "s": true, "~": true, "J": true, "o": true,
+		"v": true, "V": true, ":": true,
+	}
+
+	vimObjects = map[string]bool{
+		"w": true, "W": true, `"`: true, "'": true, "`": true,
+		"(": true, ")": true, "b": true, "{": true, "}": true, "B": true,
+		"[": true, "]": true, "<": true, ">": true,
+	}
+)
+
+// vimKey names a key the way the command tables do: the character for
+// plain typing and bubbletea's name for everything else.
+func vimKey(msg tea.KeyMsg) string {
+	if msg.Type == tea.KeyRunes && len(msg.Runes) == 1 && !msg.Alt {
+		return string(msg.Runes)
+	}
+	if msg.Type == tea.KeySpace {
+		return " "
+	}
+	return msg.String()
+}
+
+func vimCount(keys []string, i int) (int, int) {
+	n := 0
+	for ; i < len(keys) && len(keys[i]) == 1 && keys[i][0] >= '0' && keys[i][0] <= '9'; i++ {
+		if keys[i] == "0" && n == 0 {
+			break
+		}
+		n = n*10 + int(keys[i][0]-'0')
+	}
+	return n, i
+}
+
+// parseVim parses keys as one command: ["register] [count] then an
+// operator with an optional count and a motion or text object, a motion on
+// its own, or a command.
+func parseVim(keys []string, visual bool) (vimCmd, int) {
+	var c vimCmd
+	i := 0
+	if keys[0] == `"` {
+		if len(keys) == 1 {
+			return c, vimIncomplete
+		}
+		r := []rune(keys[1])
+		if len(r) != 1 {
+			return c, vimInvalid
+		}
+		c.reg = r[0]
+		i = 2
+	}
+	c.count, i = vimCount(keys, i)
+	if i == len(keys) {
+		return c, vimIncomplete
+	}
+	k := keys[i]
+	if vimOperators[k] {
+		c.op = k
+		if visual {
+			return c, vimComplete
+		}
+		n, j := vimCount(keys, i+1)
+		if n > 0 {
+			c.count = max(1, c.count) * n
+		}
+		if j == len(keys) {
+			return c, vimIncomplete
+		}
+		if keys[j] == k {
+			c.motion = "line"
+			return c, vimComplete
+		}
+		var st int
+		c.motion, c.arg, st = parseVimMotion(keys[j:], true)
+		return c, st
+	}
+	if (visual && vimVisualCommands[k]) || (!visual && vimCommands[k]) {
+		c.motion = k
+		if k == "r" || k == "ctrl+w" {
+			if i+1 == len(keys) {
+				return c, vimIncomplete
+			}
+			c.arg = keys[i+1]
+			if k == "r" && utf8.RuneCountInString(c.arg) != 1 {
+				return c, vimInvalid
+			}
+		}
+		return c, vimComplete
+	}
+	var st int
+	c.motion, c.arg, st = parseVimMotion(keys[i:], visual)
+	return c, st
+}
+
+func parseVimMotion(keys []string, objects bool) (string, string, int) {
+	k := keys[0]
+	switch {
+	case vimMotions[k]:
+		return k, "", vimComplete
+	case k == "g":
+		if len(keys) == 1 {
+			return "", "", vimIncomplete
+		}
+		if keys[1] == "g" {
+			return "gg", "", vimComplete
+		}
+	case k == "f" || k == "t" || k == "F" || k == "T":
+		if len(keys) == 1 {
+			return "", "", vimIncomplete
+		}
+		if utf8.RuneCountInString(keys[1]) == 1 {
+			return k, keys[1], vimComplete
+		}
+	case objects && (k == "i" || k == "a"):
+		if len(keys) == 1 {
+			return "", "", vimIncomplete
+		}
+		if vimObjects[keys[1]] {
+			return k + keys[1], "", vimComplete
+		}
+	}
+	return "", "", vimInvalid
+}
+
+// handleVimKey runs key through the vim layer. It reports whether the key
+// was used; keys that mean nothing to vim fall through to the default
+// bindings so that the panel and file shortcuts keep working.
+func (m *Model) handleVimKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	v := &m.vim
+	if (v.mode == vimVisual || v.mode == vimVisualLine) && !m.sel.active {
+		v.mode = vimNormal
+	}
+	switch v.mode {
+	case vimInsert:
+		if msg.String() == "esc" {
+			m.vimRecord(msg)
+			m.vimLeaveInsert()
+			return true, nil
+		}
+		m.vimRecord(msg)
+		return false, nil
+	case vimCmdline:
+		return true, m.updateVimCmdline(msg)
+	}
+
+	k := vimKey(msg)
+	if k == "esc" {
+		if len(v.pending) == 0 && v.mode != vimNormal {
+			m.vimLeaveVisual()
+		}
+		v.pending = nil
+		return true, nil
+	}
+	v.pending = append(v.pending, msg)
+	keys := make([]string, len(v.pending))
+	for i, p := range v.pending {
+		keys[i] = vimKey(p)
+	}
+	visual := v.mode == vimVisual || v.mode == vimVisualLine
+	c, st := parseVim(keys, visual)
+	switch st {
+	case vimIncomplete:
+		return true, nil
+	case vimInvalid:
+		v.pending = nil
+		if _, typed := typedText(msg); len(keys) == 1 && !typed {
+			return false, nil
+		}
+		return true, nil
+	}
+
+	typed := v.pending
+	v.pending = nil
+	var cmd tea.Cmd
+	if visual {
+		cmd = m.runVimVisual(c)
+	} else {
+		cmd = m.runVim(c)
+		if !v.replaying && vimChanges(c) {
+			if v.mode == vimInsert {
+				v.recording = append([]tea.KeyMsg(nil), typed...)
+			} else {
+				v.lastChange = typed
+			}
+		}
+	}
+	m.vimClamp()
+	m.ensureCursorVisible()
+	return true, cmd
+}
+
+// vimChanges reports whether c edits the buffer and so is what dot
+// repeats.
+func vimChanges(c vimCmd) bool {
+	if c.op != "" {
+		return c.op != "y"
+	}
+	return strings.Contains("iaIAoOxXDCsSpPJr~", c.motion) && len(c.motion) == 1
+}
+
+// vimRecord adds a key typed in insert mode to the change dot repeats.
+func (m *Model) vimRecord(msg tea.KeyMsg) {
+	if m.vim.recording != nil && !m.vim.replaying {
+		m.vim.recording = append(m.vim.recording, msg)
+	}
+}
+
+func (m *Model) vimStartInsert() {
+	m.history.seal()
+	m.history.begin()
+	m.vim.inserting = true
+	m.vim.mode = vimInsert
+	m.clearSelection()
+}
+
+func (m *Model) vimLeaveInsert() {
+	if m.vim.inserting {
+		m.history.end()
+		m.vim.inserting = false
+	}
+	if m.vim.recording != nil {
+		m.vim.lastChange = m.vim.recording
+		m.vim.recording = nil
+	}
+	m.vim.mode = vimNormal
+	m.clearSelection()
+	if m.cursorX > 0 {
+		m.cursorX = min(m.cursorX, graphemeCount(m.buf.Line(m.cursorY))) - 1
+	}
+	m.vimClamp()
+	m.vim.want = m.cursorX
+}
+
+func (m *Model) vimLeaveVisual() {
+	m.vim.mode = vimNormal
+	m.clearSelection()
+}
+
+// vimClamp keeps the cursor on a character, as normal mode has no column
+// past the end of a line.
+func (m *Model) vimClamp() {
+	if m.vim.mode == vimInsert || m.vim.mode == vimCmdline {
+		return
+	}
+	m.cursorX = max(0, min(m.cursorX, graphemeCount(m.buf.Line(m.cursorY))-1))
+}
+
+// vimMoveTo puts the cursor at off and, unless keepWant is set, makes its
+// column the one vertical motions aim for.
+func (m *Model) vimMoveTo(off int, keepWant bool) {
+	m.history.seal()
+	m.cursorY, m.cursorX = m.position(off)
+	if !keepWant {
+		m.vim.want = m.cursorX
+	}
+}
+
+// runVim runs a normal mode command.
+func (m *Model) runVim(c vimCmd) tea.Cmd {
+	n := max(1, c.count)
+	switch c.motion {
+	case "x":
+		c.op, c.motion = "d", "l"
+	case "X":
+		c.op, c.motion = "d", "h"
+	case "D":
+		c.op, c.motion = "d", "$"
+	case "C":
+		c.op, c.motion = "c", "$"
+	case "s":
+		c.op, c.motion = "c", "l"
+	case "S":
+		c.op, c.motion = "c", "line"
+	case "Y":
+		c.op, c.motion = "y", "line"
+	}
+	if c.op != "" {
+		s, e, linewise, ok := m.vimRange(c)
+		if linewise {
+			s, e = m.vimLines(s, e)
+		}
+		if !ok {
+			return nil
+		}
+		return m.vimOperate(c.op, c.reg, s, e, linewise)
+	}
+
+	y := m.cursorY
+	line := m.buf.Line(y)
+	switch c.motion {
+	case "i":
+		m.vimStartInsert()
+	case "a":
+		m.cursorX = min(m.cursorX+1, graphemeCount(line))
+		m.vimStartInsert()
+	case "I":
+		m.cursorX = graphemeCol(line, firstNonBlank(line))
+		m.vimStartInsert()
+	case "A":
+		m.cursorX = graphemeCount(line)
+		m.vimStartInsert()
+	case "o":
+		m.vimStartInsert()
+		off := m.buf.LineStart(y) + len(line)
+		m.replace(editOther, off, off, "\n")
+	case "O":
+		m.vimStartInsert()
+		off := m.buf.LineStart(y)
+		m.replace(editOther, off, off, "\n")
+		m.cursorX, m.cursorY = 0, y
+	case "p", "P":
+		return m.vimPut(c.reg, n, c.motion == "P")
+	case "u":
+		for i := 0; i < n; i++ {
+			m.undo()
+		}
+	case "ctrl+r":
+		for i := 0; i < n; i++ {
+			m.redo()
+		}
+	case ".":
+		// Replay the keys of the last change through Update so that the
+		// text typed in insert mode goes through the usual handling.
+		keys := m.vim.lastChange
+		m.vim.replaying = true
+		var mm tea.Model = *m
+		var cmds []tea.Cmd
+		for i := 0; i < n; i++ {
+			for _, k := range keys {
+				var cmd tea.Cmd
+				mm, cmd = mm.Update(k)
+				cmds = append(cmds, cmd)
+			}
+		}
+		*m = mm.(Model)
+		m.vim.replaying = false
+		return tea.Batch(cmds...)
+	case "J":
+		m.vimJoin(max(2, n) - 1)
+	case "r":
+		m.vimReplaceChars(c.arg, n)
+	case "ctrl+w":
+		return m.vimWindow(c.arg, n)
+	case "~":
+		m.vimToggleCase(n)
+	case "v", "V":
+		m.vim.mode = vimVisual
+		if c.motion == "V" {
+			m.vim.mode = vimVisualLine
+		}
+		m.sel = selection{active: true, anchor: cursorPos{m.cursorX, m.cursorY}}
+	case ":":
+		m.vim.mode = vimCmdline
+		m.vim.cmdline = ""
+	case "/":
+		m.openSearch()
+	case "*":
+		from, to, ok := wordBounds(line, m.cursorX)
+		if !ok {
+			return nil
+		}
+		m.searchQuery = line[byteCol(line, from):byteCol(line, to)]
+		m.updateSearchResults()
+		if t, ok := m.vimMotion("n", "", 1); ok {
+			m.vimMoveTo(t.off, false)
+		}
+	default:
+		t, ok := m.vimMotion(c.motion, c.arg, c.count)
+		if !ok {
+			return nil
+		}
+		m.vimMoveTo(t.off, vimVertical(c.motion))
+		if c.motion == "$" || c.motion == "end" {
+			m.vim.want = int(^uint(0) >> 1)
+		}
+	}
+	return nil
+}
+
+// runVimVisual runs a command typed in visual mode.
+func (m *Model) runVimVisual(c vimCmd) tea.Cmd {
+	switch c.motion {
+	case "x":
+		c.op = "d"
+	case "s":
+		c.op = "c"
+	}
+	if c.op != "" {
+		s, e, linewise := m.vimVisualRange()
+		m.vim.mode = vimNormal
+		m.clearSelection()
+		return m.vimOperate(c.op, c.reg, s, e, linewise)
+	}
+	switch c.motion {
+	case "v", "V":
+		mode := vimVisual
+		if c.motion == "V" {
+			mode = vimVisualLine
+		}
+		if m.vim.mode == mode {
+			m.vimLeaveVisual()
+		} else {
+			m.vim.mode = mode
+		}
+	case "o":
+		a := m.sel.anchor
+		m.sel.anchor = cursorPos{m.cursorX, m.cursorY}
+		m.cursorX, m.cursorY = a.x, a.y
+	case "~", "J":
+		s, e, _ := m.vimVisualRange()
+		first, _ := m.buf.Position(s)
+		last, _ := m.buf.Position(max(s, e-1))
+		m.vimLeaveVisual()
+		if c.motion == "J" {
+			m.cursorY = first
+			m.vimJoin(max(1, last-first))
+			return nil
+		}
+		m.history.seal()
+		m.replace(editOther, s, e, toggleCase(m.buf.Slice(s, e)))
+		m.history.seal()
+		m.vimMoveTo(s, false)
+	case ":":
+		s, e, _ := m.vimVisualRange()
+		first, _ := m.buf.Position(s)
+		last, _ := m.buf.Position(max(s, e-1))
+		m.vim.visual = [2]int{first, last}
+		m.vimLeaveVisual()
+		m.vim.mode = vimCmdline
+		m.vim.cmdline = "'<,'>"
+	default:
+		if len(c.motion) == 2 && (c.motion[0] == 'i' || c.motion[0] == 'a') {
+			s, e, ok := m.vimTextObject(c.motion)
+			if ok && e > s {
+				m.sel.anchor.y, m.sel.anchor.x = m.position(s)
+				m.vimMoveTo(m.prevGraphemeAt(e), false)
+			}
+			return nil
+		}
+		t, ok := m.vimMotion(c.motion, c.arg, c.count)
+		if ok {
+			m.vimMoveTo(t.off, vimVertical(c.motion))
+		}
+	}
+	return nil
+}
+
+// vimVisualRange returns the visually selected byte range. Unlike the
+// default selection it includes the character under the cursor, and in
+// visual line mode it covers whole lines.
+func (m *Model) vimVisualRange() (int, int, bool) {
+	a := m.buf.Offset(m.sel.anchor.y, byteCol(m.buf.Line(m.sel.anchor.y), m.sel.anchor.x))
+	c := m.cursorOffset()
+	s, e := min(a, c), max(a, c)
+	if m.vim.mode == vimVisualLine {
+		s, e = m.vimLines(s, e)
+		return s, e, true
+	}
+	return s, m.nextGraphemeAt(e), false
+}
+
+// vimSelection returns the range visual mode highlights.
+func (m Model) vimSelection() ([2]int, bool) {
+	if m.keyProfile != "vim" || (m.vim.mode != vimVisual && m.vim.mode != vimVisualLine) || !m.sel.active {
+		return [2]int{}, false
+	}
+	s, e, _ := m.vimVisualRange()
+	return [2]int{s, e}, true
+}
+
+// vimLines returns the range of the lines holding offsets s through e,
+// including the line break after the last one.
+func (m *Model) vimLines(s, e int) (int, int) {
+	first, _ := m.buf.Position(s)
+	last, _ := m.buf.Position(e)
+	s = m.buf.LineStart(first)
+	if last+1 < m.buf.LineCount() {
+		return s, m.buf.LineStart(last + 1)
+	}
+	return s, m.buf.Len()
+}
+
+// vimRange returns the range an operator command acts on.
+func (m *Model) vimRange(c vimCmd) (int, int, bool, bool) {
+	if len(c.motion) == 2 && (c.motion[0] == 'i' || c.motion[0] == 'a') {
+		s, e, ok := m.vimTextObject(c.motion)
+		return s, e, false, ok
+	}
+	motion := c.motion
+	cur := m.cursorOffset()
+	// cw changes to the end of the word, not up to the next one.
+	if c.op == "c" && cur < m.buf.Len() && !unicode.IsSpace(runeAt(m.buf.Slice(cur, cur+utf8.UTFMax), 0)) {
+		switch motion {
+		case "w":
+			motion = "e"
+		case "W":
+			motion = "E"
+		}
+	}
+	t, ok := m.vimMotion(motion, c.arg, c.count)
+	if !ok {
+		return 0, 0, false, false
+	}
+	if motion == "line" {
+		return cur, t.off, true, true
+	}
+	s, e := min(cur, t.off), max(cur, t.off)
+	if t.inclusive {
+		e = m.nextGraphemeAt(e)
+	}
+	// A word motion that crosses a line break stops at the end of the line.
+	if (motion == "w" || motion == "W") && !t.linewise {
+		if nl := strings.IndexByte(m.buf.Slice(s, e), '\n'); nl > 0 {
+			e = s + nl
+		}
+	}
+	return s, e, t.linewise, true
+}
+
+// vimOperate applies op to the text between s and e. Linewise ranges
+// already cover whole lines.
+func (m *Model) vimOperate(op string, reg rune, s, e int, linewise bool) tea.Cmd {
+	text := m.buf.Slice(s, e)
+	content := text
+	if linewise && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	var cmd tea.Cmd
+	switch op {
+	case "y":
+		cmd = m.vimYank(reg, content, linewise)
+		if linewise {
+			m.cursorY, _ = m.buf.Position(s)
+		} else {
+			m.vimMoveTo(s, false)
+		}
+	case "d":
+		cmd = m.vimYank(reg, content, linewise)
+		if linewise && e == m.buf.Len() && s > 0 {
+			// Deleting the last lines also takes the line break before them.
+			s--
+		}
+		m.history.seal()
+		m.replace(editOther, s, e, "")
+		m.history.seal()
+		if linewise {
+			line := m.buf.Line(m.cursorY)
+			m.cursorX = graphemeCol(line, firstNonBlank(line))
+		}
+		m.vim.want = m.cursorX
+	case "c":
+		cmd = m.vimYank(reg, content, linewise)
+		if linewise {
+			if strings.HasSuffix(text, "\n") {
+				e--
+			}
+			s += firstNonBlank(m.buf.Slice(s, e))
+		}
+		m.vimStartInsert()
+		m.replace(editOther, s, e, "")
+	case ">", "<":
+		m.sel = selection{active: true}
+		m.sel.anchor.y, m.sel.anchor.x = m.position(s)
+		m.cursorY, m.cursorX = m.position(max(s, e-1))
+		m.indentLines(op == "<")
+		m.clearSelection()
+		m.cursorY, _ = m.buf.Position(s)
+		m.cursorX = graphemeCol(m.buf.Line(m.cursorY), firstNonBlank(m.buf.Line(m.cursorY)))
+	}
+	return cmd
+}
+
+// vimYank stores text in reg and in the unnamed register. The + and *
+// registers are the system clipboard.
+func (m *Model) vimYank(reg rune, text string, linewise bool) tea.Cmd {
+	if m.vim.linewise == nil {
+		m.vim.linewise = map[rune]bool{}
+	}
+	var cmd tea.Cmd
+	if reg == '+' || reg == '*' {
+		cmd = m.copyToClipboard(text)
+	} else if reg != 0 && reg != '"' {
+		m.clip.Set(reg, text)
+	}
+	m.clip.Set('"', text)
+	m.vim.linewise['"'] = linewise
+	m.vim.linewise[reg] = linewise
+	return cmd
+}
+
+// vimPut pastes reg count times after the cursor, or before it.
+func (m *Model) vimPut(reg rune, count int, before bool) tea.Cmd {
+	if reg == 0 {
+		reg = '"'
+	}
+	if reg == '+' || reg == '*' {
+		return m.readClipboard(func(m *Model, text string) {
+			m.vimPutText(reg, text, count, before)
+			m.ensureCursorVisible()
+		})
+	}
+	m.vimPutText(reg, m.clip.Get(reg), count, before)
+	return nil
+}
+
+// vimPutText pastes text, held in reg, count times after the cursor, or
+// before it.
+func (m *Model) vimPutText(reg rune, text string, count int, before bool) {
+	if text == "" {
+		return
+	}
+	text = strings.Repeat(text, count)
+	y := m.cursorY
+	line := m.buf.Line(y)
+	m.history.seal()
+	if m.vim.linewise[reg] {
+		if before {
+			m.replace(editOther, m.buf.LineStart(y), m.buf.LineStart(y), text)
+		} else {
+			off := m.buf.LineStart(y) + len(line)
+			m.replace(editOther, off, off, "\n"+strings.TrimSuffix(text, "\n"))
+			y++
+		}
+		m.cursorY = y
+		m.cursorX = graphemeCol(m.buf.Line(y), firstNonBlank(m.buf.Line(y)))
+	} else {
+		off := m.cursorOffset()
+		if !before {
+			off = m.nextGraphemeAt(off)
+		}
+		m.replace(editOther, off, off, text)
+		m.cursorX--
+	}
+	m.history.seal()
+}
+
+// vimJoin joins the cursor line with the next n lines, separating them
+// with a single space.
+func (m *Model) vimJoin(n int) {
+	m.history.seal()
+	m.history.begin()
+	for i := 0; i < n && m.cursorY+1 < m.buf.LineCount(); i++ {
+		y := m.cursorY
+		line := m.buf.Line(y)
+		next := m.buf.Line(y + 1)
+		end := m.buf.LineStart(y) + len(line)
+		sep := " "
+		rest := strings.TrimLeftFunc(next, unicode.IsSpace)
+		if line == "" || strings.HasSuffix(line, " ") || rest == "" || strings.HasPrefix(rest, ")") {
+			sep = ""
+		}
+		m.replace(editOther, end, m.buf.LineStart(y+1)+len(next)-len(rest), sep)
+		m.cursorY = y
+		m.cursorX = graphemeCol(line, len(line))
+	}
+	m.history.end()
+}
+
+// vimReplaceChars replaces n characters from the cursor with ch.
+func (m *Model) vimReplaceChars(ch string, n int) {
+	line := m.buf.Line(m.cursorY)
+	if m.cursorX+n > graphemeCount(line) {
+		return
+	}
+	start := m.buf.LineStart(m.cursorY)
+	m.history.seal()
+	m.replace(editOther, start+byteCol(line, m.cursorX), start+byteCol(line, m.cursorX+n), strings.Repeat(ch, n))
+	m.history.seal()
+	m.cursorX--
+}
+
+// vimToggleCase swaps the case of n characters and moves past them.
+func (m *Model) vimToggleCase(n int) {
+	line := m.buf.Line(m.cursorY)
+	x := min(m.cursorX, graphemeCount(line))
+	end := min(x+n, graphemeCount(line))
+	if end == x {
+		return
+	}
+	start := m.buf.LineStart(m.cursorY)
+	from, to := byteCol(line, x), byteCol(line, end)
+	m.history.seal()
+	m.replace(editOther, start+from, start+to, toggleCase(line[from:to]))
+	m.history.seal()
+}
+
+func toggleCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// vimMotion returns where motion moves the cursor. count is 0 when none
+// was typed.
+func (m *Model) vimMotion(motion, arg string, count int) (vimTarget, bool) {
+	n := max(1, count)
+	cur := m.cursorOffset()
+	y := m.cursorY
+	line := m.buf.Line(y)
+	ls := m.buf.LineStart(y)
+	last := m.buf.LineCount() - 1
+	x := min(m.cursorX, graphemeCount(line))
+
+	switch motion {
+	case "h", "left", "backspace":
+		return vimTarget{off: ls + byteCol(line, max(0, x-n))}, true
+	case "l", "right", " ":
+		return vimTarget{off: ls + byteCol(line, min(graphemeCount(line), x+n))}, true
+	case "j", "down", "k", "up", "+", "-", "enter", "line":
+		d := n
+		switch motion {
+		case "k", "up", "-":
+			d = -n
+		case "line":
+			d = n - 1
+		}
+		ty := max(0, min(last, y+d))
+		if ty == y && d != 0 {
+			return vimTarget{}, false
+		}
+		tl := m.buf.Line(ty)
+		col := byteCol(tl, m.vim.want)
+		if motion != "j" && motion != "k" && motion != "up" && motion != "down" {
+			col = firstNonBlank(tl)
+		}
+		return vimTarget{off: m.buf.LineStart(ty) + col, linewise: true}, true
+	case "0", "home":
+		return vimTarget{off: ls}, true
+	case "^":
+		return vimTarget{off: ls + firstNonBlank(line)}, true
+	case "$", "end":
+		ty := min(last, y+n-1)
+		tl := m.buf.Line(ty)
+		return vimTarget{off: m.buf.LineStart(ty) + prevGrapheme(tl, len(tl)), inclusive: true}, true
+	case "gg", "G":
+		ty := 0
+		if motion == "G" {
+			ty = last
+		}
+		if count > 0 {
+			ty = min(count-1, last)
+		}
+		tl := m.buf.Line(ty)
+		return vimTarget{off: m.buf.LineStart(ty) + firstNonBlank(tl), linewise: true}, true
+	case "w", "W":
+		off, _, _ := m.scanLines(cur, func(text string, off int) (int, int, bool) {
+			for i := 0; i < n; i++ {
+				off = wordForward(text, off, motion == "W")
+			}
+			return off, off, true
+		})
+		return vimTarget{off: off}, true
+	case "e", "E":
+		off, _, _ := m.scanLines(cur, func(text string, off int) (int, int, bool) {
+			for i := 0; i < n; i++ {
+				off = wordEnd(text, off, motion == "E")
+			}
+			return off, off, true
+		})
+		return vimTarget{off: off, inclusive: true}, true
+	case "b", "B":
+		off, _, _ := m.scanLines(cur, func(text string, off int) (int, int, bool) {
+			for i := 0; i < n; i++ {
+				off = wordBackward(text, off, motion == "B")
+			}
+			return off, off, true
+		})
+		return vimTarget{off: off}, true
+	case "f", "t", "F", "T", ";", ",":
+		find := motion + arg
+		if motion == ";" || motion == "," {
+			find = m.vim.lastFind
+			if find == "" {
+				return vimTarget{}, false
+			}
+			if motion == "," {
+				flip := map[byte]string{'f': "F", 'F': "f", 't': "T", 'T': "t"}
+				find = flip[find[0]] + find[1:]
+			}
+		} else {
+			m.vim.lastFind = find
+		}
+		off, ok := findInLine(line, byteCol(line, x), find, n)
+		if !ok {
+			return vimTarget{}, false
+		}
+		return vimTarget{off: ls + off, inclusive: find[0] == 'f' || find[0] == 't'}, true
+	case "%":
+		p := strings.IndexAny(line[byteCol(line, x):], "()[]{}")
+		if p < 0 {
+			return vimTarget{}, false
+		}
+		off, _, ok := m.scanLines(ls+byteCol(line, x)+p, func(text string, off int) (int, int, bool) {
+			off, ok := matchBracket(text, off)
+			return off, off, ok
+		})
+		return vimTarget{off: off, inclusive: true}, ok
+	case "n", "N":
+		off, ok := m.searchFrom(cur, motion == "N")
+		return vimTarget{off: off}, ok
+	}
+	return vimTarget{}, false
+}
+
+// vimVertical reports whether motion moves between lines keeping the
+// column the cursor wants to be in.
+func vimVertical(motion string) bool {
+	switch motion {
+	case "j", "k", "up", "down":
+		return true
+	}
+	return false
+}
+
+// findInLine runs an f, t, F or T search for the n-th occurrence of the
+// character in find, starting at byte col of line.
+func findInLine(line string, col int, find string, n int) (int, bool) {
+	kind, ch := find[0], find[1:]
+	pos := col
+	for i := 0; i < n; i++ {
+		if kind == 'f' || kind == 't' {
+			from := pos + len(graphemeAt(line, pos))
+			idx := strings.Index(line[from:], ch)
+			if idx < 0 {
+				return 0, false
+			}
+			pos = from + idx
+		} else {
+			idx := strings.LastIndex(line[:pos], ch)
+			if idx < 0 {
+				return 0, false
+			}
+			pos = idx
+		}
+	}
+	switch kind {
+	case 't':
+		pos = prevGrapheme(line, pos)
+	case 'T':
+		pos += len(ch)
+	}
+	return pos, true
+}
+
+// matchBracket returns the offset of the bracket matching the one at off.
+func matchBracket(text string, off int) (int, bool) {
+	pairs := map[byte]byte{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+	open := text[off]
+	close := pairs[open]
+	step := 1
+	if strings.IndexByte(")]}", open) >= 0 {
+		step = -1
+	}
+	depth := 0
+	for p := off; p >= 0 && p < len(text); p += step {
+		switch text[p] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return p, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// vimTextObject returns the range of a text object such as "iw" or "a(".
+func (m *Model) vimTextObject(obj string) (int, int, bool) {
+	cur := m.cursorOffset()
+	inner := obj[0] == 'i'
+	ls := m.buf.LineStart(m.cursorY)
+	line := m.buf.Line(m.cursorY)
+	switch obj[1:] {
+	case "w", "W":
+		if line == "" {
+			return cur, cur, false
+		}
+		big := obj[1] == 'W'
+		c := min(cur-ls, prevGrapheme(line, len(line)))
+		cls := vimClass(runeAt(line, c), big)
+		s, e := c, c
+		for s > 0 && vimClass(lastRune(line[:s]), big) == cls {
+			_, size := utf8.DecodeLastRuneInString(line[:s])
+			s -= size
+		}
+		for e < len(line) && vimClass(runeAt(line, e), big) == cls {
+			e += utf8.RuneLen(runeAt(line, e))
+		}
+		if !inner {
+			t := e
+			for t < len(line) && vimClass(runeAt(line, t), big) == 0 {
+				t++
+			}
+			if t > e {
+				e = t
+			} else {
+				for s > 0 && vimClass(lastRune(line[:s]), big) == 0 {
+					s--
+				}
+			}
+		}
+		return ls + s, ls + e, true
+	case `"`, "'", "`":
+		q := obj[1]
+		var quotes []int
+		for i := 0; i < len(line); i++ {
+			if line[i] == q && (i == 0 || line[i-1] != '\\') {
+				quotes = append(quotes, i)
+			}
+		}
+		c := cur - ls
+		for i := 0; i+1 < len(quotes); i += 2 {
+			open, close := quotes[i], quotes[i+1]
+			if c <= close {
+				if inner {
+					return ls + open + 1, ls + close, true
+				}
+				e := close + 1
+				for e < len(line) && (line[e] == ' ' || line[e] == '\t') {
+					e++
+				}
+				return ls + open, ls + e, true
+			}
+		}
+		return 0, 0, false
+	}
+	var open, close byte
+	switch obj[1:] {
+	case "(", ")", "b":
+		open, close = '(', ')'
+	case "{", "}", "B":
+		open, close = '{', '}'
+	case "[", "]":
+		open, close = '[', ']'
+	case "<", ">":
+		open, close = '<', '>'
+	}
+	return m.scanLines(cur, func(text string, cur int) (int, int, bool) {
+		start := -1
+		depth := 0
+		for p := min(cur, len(text)-1); p >= 0; p-- {
+			switch {
+			case text[p] == close && p != cur:
+				depth++
+			case text[p] == open:
+				if depth == 0 {
+					start = p
+				}
+				depth--
+			}
+			if start >= 0 {
+				break
+			}
+		}
+		if start < 0 {
+			return 0, 0, false
+		}
+		depth = 0
+		for p := start; p < len(text); p++ {
+			switch text[p] {
+			case open:
+				depth++
+			case close:
+				depth--
+				if depth == 0 {
+					if inner {
+						return start + 1, p, true
+					}
+					return start, p + 1, true
+				}
+			}
+		}
+		return 0, 0, false
+	})
+}
+
+// vimClass sorts runes for word motions: 0 for blanks, 1 for word
+// characters and 2 for punctuation. With big set every non-blank is 1.
+func vimClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big, r == '_', unicode.IsLetter(r), unicode.IsDigit(r), unicode.Is(unicode.Mn, r):
+		return 1
+	}
+	return 2
+}
+
+func runeAt(s string, off int) rune {
+	r, _ := utf8.DecodeRuneInString(s[off:])
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// wordForward returns the start of the next word after off. An empty
+// line counts as a word.
+func wordForward(text string, off int, big bool) int {
+	if off >= len(text) {
+		return len(text)
+	}
+	r, size := utf8.DecodeRuneInString(text[off:])
+	cls := vimClass(r, big)
+	off += size
+	for cls != 0 && off < len(text) && vimClass(runeAt(text, off), big) == cls {
+		off += utf8.RuneLen(runeAt(text, off))
+	}
+	for off < len(text) {
+		r := runeAt(text, off)
+		if vimClass(r, big) != 0 || (r == '\n' && text[off-1] == '\n') {
+			break
+		}
+		off += utf8.RuneLen(r)
+	}
+	return off
+}
+
+// wordEnd returns the last character of the word after off.
+func wordEnd(text string, off int, big bool) int {
+	if off < len(text) {
+		off += utf8.RuneLen(runeAt(text, off))
+	}
+	for off < len(text) && vimClass(runeAt(text, off), big) == 0 {
+		off += utf8.RuneLen(runeAt(text, off))
+	}
+	if off >= len(text) {
+		return max(0, prevGrapheme(text, len(text)))
+	}
+	cls := vimClass(runeAt(text, off), big)
+	for {
+		next := off + utf8.RuneLen(runeAt(text, off))
+		if next >= len(text) || vimClass(runeAt(text, next), big) != cls {
+			return off
+		}
+		off = next
+	}
+}
+
+// wordBackward returns the start of the word before off.
+func wordBackward(text string, off int, big bool) int {
+	for off > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:off])
+		if vimClass(r, big) != 0 {
+			break
+		}
+		off -= size
+		if r == '\n' && off > 0 && text[off-1] == '\n' {
+			return off
+		}
+	}
+	if off == 0 {
+		return 0
+	}
+	cls := vimClass(lastRune(text[:off]), big)
+	for off > 0 && vimClass(lastRune(text[:off]), big) == cls {
+		_, size := utf8.DecodeLastRuneInString(text[:off])
+		off -= size
+	}
+	return off
+}
+
+// firstNonBlank returns the byte offset of the first non-blank character
+// of line, or its length when it is blank.
+func firstNonBlank(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// nextGrapheme returns the offset after the cluster at off, stopping at a
+// line break.
+func nextGrapheme(text string, off int) int {
+	if off >= len(text) || text[off] == '\n' {
+		return off
+	}
+	return off + len(graphemeAt(text, off))
+}
+
+// nextGraphemeAt is nextGrapheme for offset off of the buffer.
+func (m *Model) nextGraphemeAt(off int) int {
+	y, col := m.buf.Position(off)
+	return m.buf.LineStart(y) + nextGrapheme(m.buf.Line(y), col)
+}
+
+// prevGraphemeAt is prevGrapheme for offset off of the buffer. Before the
+// start of a line it is the line break ending the previous one.
+func (m *Model) prevGraphemeAt(off int) int {
+	y, col := m.buf.Position(off)
+	if col == 0 {
+		return max(0, off-1)
+	}
+	return m.buf.LineStart(y) + prevGrapheme(m.buf.Line(y), col)
+}
+
+// prevGrapheme returns the start of the cluster before off.
+func prevGrapheme(s string, off int) int {
+	if off <= 0 {
+		return 0
+	}
+	return byteCol(s, graphemeCol(s, off-1))
+}
+
+// updateVimCmdline edits the ":" command line.
+func (m *Model) updateVimCmdline(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.vim.mode = vimNormal
+	case "enter":
+		m.vim.mode = vimNormal
+		cmd := m.runVimCmdline(m.vim.cmdline)
+		m.vimClamp()
+		m.ensureCursorVisible()
+		return cmd
+	case "backspace":
+		if m.vim.cmdline == "" {
+			m.vim.mode = vimNormal
+		}
+		m.vim.cmdline = dropLastGrapheme(m.vim.cmdline)
+	default:
+		if text, ok := typedText(msg); ok {
+			m.vim.cmdline += text
+		} else if msg.Paste {
+			m.vim.cmdline += strings.SplitN(pastedText(msg), "\n", 2)[0]
+		}
+	}
+	return nil
+}
+
+// vimAddress parses a line address at the start of s.
+func (m *Model) vimAddress(s string) (int, string, bool) {
+	last := m.buf.LineCount() - 1
+	switch {
+	case strings.HasPrefix(s, "."):
+		return m.cursorY, s[1:], true
+	case strings.HasPrefix(s, "$"):
+		return last, s[1:], true
+	case strings.HasPrefix(s, "'<"):
+		return m.vim.visual[0], s[2:], true
+	case strings.HasPrefix(s, "'>"):
+		return m.vim.visual[1], s[2:], true
+	}
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return 0, s, false
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return max(0, min(last, n-1)), s[i:], true
+}
+
+// vimQuit quits unless a document has unsaved changes, which, as in Vim,
+// are reported rather than asked about.
+func (m *Model) vimQuit() tea.Cmd {
+	for i := range m.docs {
+		if d := m.doc(i); d.modified() {
+			if i == m.active {
+				m.status = "E37: No write since last change (add ! to override)"
+			} else {
+				m.status = fmt.Sprintf("E162: No write since last change for buffer %q", d.title())
+			}
+			return nil
+		}
+	}
+	return quit(m)
+}
+
+// vimWindow runs the window command Ctrl+W key, count times where that
+// makes sense.
+func (m *Model) vimWindow(key string, count int) tea.Cmd {
+	switch key {
+	case "s", "S", "ctrl+s":
+		m.splitPane(splitHorizontal)
+	case "v", "ctrl+v":
+		m.splitPane(splitVertical)
+	case "h", "left", "ctrl+h", "backspace":
+		m.focusDirection(-1, 0)
+	case "l", "right", "ctrl+l":
+		m.focusDirection(1, 0)
+	case "k", "up", "ctrl+k":
+		m.focusDirection(0, -1)
+	case "j", "down", "ctrl+j":
+		m.focusDirection(0, 1)
+	case "w", "ctrl+w":
+		m.focusNextPane(count)
+	case "W":
+		m.focusNextPane(-count)
+	case "c":
+		if !isSplit(m) {
+			m.status = "E444: Cannot close last window"
+			break
+		}
+		m.closePane()
+	case "q", "ctrl+q":
+		if !isSplit(m) {
+			return m.vimQuit()
+		}
+		m.closePane()
+	case "o", "ctrl+o":
+		m.onlyPane()
+	case "+":
+		m.resizePane(splitHorizontal, float64(count)*paneResizeBy)
+	case "-":
+		m.resizePane(splitHorizontal, -float64(count)*paneResizeBy)
+	case ">":
+		m.resizePane(splitVertical, float64(count)*paneResizeBy)
+	case "<":
+		m.resizePane(splitVertical, -float64(count)*paneResizeBy)
+	case "=":
+		m.equalizePanes()
+	}
+	return nil
+}
+
+// runVimCmdline runs an ex command: an optional line range followed by
+// w, q, wq, x, e, s or noh. A bare range jumps to its last line.
+func (m *Model) runVimCmdline(line string) tea.Cmd {
+	cmd := strings.TrimSpace(line)
+	first, last := m.cursorY, m.cursorY
+	ranged := false
+	if strings.HasPrefix(cmd, "%") {
+		first, last, cmd, ranged = 0, m.buf.LineCount()-1, cmd[1:], true
+	} else if a, rest, ok := m.vimAddress(cmd); ok {
+		first, last, cmd, ranged = a, a, rest, true
+		if strings.HasPrefix(cmd, ",") {
+			if b, rest, ok := m.vimAddress(cmd[1:]); ok {
+				last, cmd = b, rest
+			}
+		}
+		if first > last {
+			first, last = last, first
+		}
+	}
+	cmd = strings.TrimSpace(cmd)
+	name, arg, _ := strings.Cut(cmd, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch {
+	case name == "" && ranged:
+		m.cursorY = last
+		m.cursorX = graphemeCol(m.buf.Line(last), firstNonBlank(m.buf.Line(last)))
+	case name == "":
+	case name == "w" || name == "wq" || name == "x":
+		if arg != "" {
+			m.file = arg
+			m.detectLang(arg)
+		}
+		if err := m.saveFile(); err == nil && name != "w" {
+			if isSplit(m) {
+				m.closePane()
+				break
+			}
+			return m.vimQuit()
+		}
+	case (name == "q" || name == "q!" || name == "clo" || name == "close") && isSplit(m):
+		m.closePane()
+	case name == "clo" || name == "close":
+		m.status = "E444: Cannot close last window"
+	case name == "on" || name == "only":
+		m.onlyPane()
+	case name == "sp" || name == "split" || name == "vs" || name == "vsplit":
+		dir := splitHorizontal
+		if name[0] == 'v' {
+			dir = splitVertical
+		}
+		m.splitPane(dir)
+		if arg != "" {
+			m.openFile(arg)
+		}
+	case name == "q" || name == "qa":
+		return m.vimQuit()
+	case name == "q!" || name == "qa!":
+		return quit(m)
+	case name == "e" && arg == "" && m.modified():
+		m.status = "E37: No write since last change (add ! to override)"
+	case (name == "e" || name == "e!") && arg == "" && m.file == "":
+		m.status = "E32: No file name"
+	case (name == "e" || name == "e!") && arg == "":
+		m.loadFile(m.file)
+		m.clearCarets()
+		m.clearSelection()
+		m.cursorY = min(m.cursorY, m.buf.LineCount()-1)
+		m.cursorX = min(m.cursorX, graphemeCount(m.buf.Line(m.cursorY)))
+	case name == "e" || name == "e!":
+		m.openFile(arg)
+	case name == "bn" || name == "bnext":
+		m.cycleTab(1)
+	case name == "bp" || name == "bprevious":
+		m.cycleTab(-1)
+	case name == "bd" || name == "bdelete":
+		if m.modified() {
+			m.status = fmt.Sprintf("E89: No write since last change for buffer %q (add ! to override)", m.current().title())
+			break
+		}
+		return m.closeTab(m.active)
+	case name == "bd!" || name == "bdelete!":
+		return dropTab(m)
+	case name == "noh" || name == "nohlsearch":
+		m.searchQuery = ""
+		m.searchResults = nil
+	case len(cmd) > 1 && cmd[0] == 's' && !isWordByte(cmd[1]) && cmd[1] != ' ':
+		m.vimSubstitute(first, last, cmd[1:])
+	default:
+		m.status = fmt.Sprintf("Not an editor command: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// vimSubstitute runs :s/pattern/replacement/flags over lines first to
+// last as one undo step. Patterns are Go regular expressions; an empty
+// one reuses the search query. The replacement understands & and \1-\9.
+func (m *Model) vimSubstitute(first, last int, spec string) {
+	parts := splitUnescaped(spec[1:], spec[0])
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	pat, rep, flags := parts[0], parts[1], parts[2]
+	if pat == "" {
+		pat = regexp.QuoteMeta(m.searchQuery)
+	}
+	if strings.Contains(flags, "i") {
+		pat = "(?i)" + pat
+	}
+	re, err := regexp.Compile(pat)
+	if err != nil || pat == "" {
+		m.status = fmt.Sprintf("Invalid pattern: %s", parts[0])
+		return
+	}
+	tmpl := vimTemplate(rep)
+	global := strings.Contains(flags, "g")
+
+	subs, lines := 0, 0
+	m.history.seal()
+	m.history.begin()
+	for y := last; y >= first; y-- {
+		line := m.buf.Line(y)
+		var out []byte
+		prev, n := 0, 0
+		for _, loc := range re.FindAllStringSubmatchIndex(line, -1) {
+			out = append(out, line[prev:loc[0]]...)
+			out = re.ExpandString(out, tmpl, line, loc)
+			prev = loc[1]
+			n++
+			if !global {
+				break
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		out = append(out, line[prev:]...)
+		start := m.buf.LineStart(y)
+		m.replace(editOther, start, start+len(line), string(out))
+		subs += n
+		lines++
+		m.cursorY = y
+	}
+	m.history.end()
+	if subs == 0 {
+		m.status = fmt.Sprintf("Pattern not found: %s", parts[0])
+		return
+	}
+	m.cursorX = graphemeCol(m.buf.Line(m.cursorY), firstNonBlank(m.buf.Line(m.cursorY)))
+	m.status = fmt.Sprintf("%d substitutions on %d lines", subs, lines)
+}
+
+// splitUnescaped splits s on sep, keeping separators escaped with a
+// backslash as literal text.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == sep:
+			b.WriteByte(sep)
+			i++
+		case s[i] == '\\' && i+1 < len(s):
+			b.WriteByte(s[i])
+			b.WriteByte(s[i+1])
+			i++
+		case s[i] == sep:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return append(parts, b.String())
+}
+
+// vimTemplate converts a vim replacement string to a regexp template.
+func vimTemplate(rep string) string {
+	var b strings.Builder
+	for i := 0; i < len(rep); i++ {
+		c := rep[i]
+		switch {
+		case c == '\\' && i+1 < len(rep):
+			i++
+			switch n := rep[i]; {
+			case n >= '0' && n <= '9':
+				b.WriteString("${" + string(n) + "}")
+			case n == 'n':
+				b.WriteByte('\n')
+			case n == 't':
+				b.WriteByte('\t')
+			case n == '$':
+				b.WriteString("$$")
+			default:
+				b.WriteByte(n)
+			}
+		case c == '&':
+			b.WriteString("${0}")
+		case c == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// vimIndicator names the vim mode for the status bar.
+func (m Model) vimIndicator() string {
+	if m.keyProfile != "vim" {
+		return ""
+	}
+	var keys string
+	for _, k := range m.vim.pending {
+		keys += vimKey(k)
+	}
+	if keys != "" {
+		keys = " " + keys
+	}
+	switch m.vim.mode {
+	case vimInsert:
+		return " | INSERT"
+	case vimVisual:
+		return " | VISUAL" + keys
+	case vimVisualLine:
+		return " | V-LINE" + keys
+	}
+	return " | NORMAL" + keys
+}
@@ -0,0 +1,136 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// press sends keys to m one at a time, as bubbletea names them.
+func press(m *Model, keys ...string) {
+	var mm tea.Model = *m
+	for _, k := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		switch k {
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		case "alt+f", "alt+b", "alt+d":
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k[4:]), Alt: true}
+		case "alt+backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace, Alt: true}
+		case "ctrl+s":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlS}
+		case "ctrl+r":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlR}
+		}
+		mm, _ = mm.Update(msg)
+	}
+	*m = mm.(Model)
+}
+
+func TestVimMotions(t *testing.T) {
+	text := "alpha beta(gamma)\nx\n\nlong line here\n"
+	tests := []struct {
+		keys []string
+		y, x int
+	}{
+		{[]string{"w"}, 0, 6},
+		{[]string{"w", "w"}, 0, 10},
+		{[]string{"e"}, 0, 4},
+		{[]string{"$", "b"}, 0, 11},
+		{[]string{"f", "(", "%"}, 0, 16},
+		{[]string{"$", "%"}, 0, 10},
+		{[]string{"j", "j", "j", "w", "b"}, 3, 0},
+		{[]string{"4", "w"}, 0, 16},
+		{[]string{"5", "w"}, 1, 0},
+		{[]string{"G", "b"}, 3, 10},
+		// A motion within the line sets the column j and k keep.
+		{[]string{"w", "j", "j", "j"}, 3, 6},
+		{[]string{"$", "j", "j", "j"}, 3, 13},
+		{[]string{"w", "w", "w", "j"}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.keys, " "), func(t *testing.T) {
+			m, _ := newTestModel(t, text)
+			m.setKeyProfile("vim")
+			press(m, tt.keys...)
+			if m.cursorY != tt.y || m.cursorX != tt.x {
+				t.Errorf("cursor at %d:%d, want %d:%d", m.cursorY, m.cursorX, tt.y, tt.x)
+			}
+		})
+	}
+}
+
+func TestVimEdits(t *testing.T) {
+	text := "alpha beta(gamma) delta\nsecond (line\nx) end\n"
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"d", "w"}, "beta(gamma) delta\nsecond (line\nx) end\n"},
+		{[]string{"c", "w", "Z", "esc"}, "Z beta(gamma) delta\nsecond (line\nx) end\n"},
+		{[]string{"d", "e"}, " beta(gamma) delta\nsecond (line\nx) end\n"},
+		{[]string{"$", "d", "b"}, "alpha beta(gamma) a\nsecond (line\nx) end\n"},
+		{[]string{"f", "m", "d", "i", "("}, "alpha beta() delta\nsecond (line\nx) end\n"},
+		{[]string{"f", "m", "d", "a", "("}, "alpha beta delta\nsecond (line\nx) end\n"},
+		{[]string{"j", "w", "w", "d", "i", "("}, "alpha beta(gamma) delta\nsecond () end\n"},
+		{[]string{"f", "(", "d", "%"}, "alpha beta delta\nsecond (line\nx) end\n"},
+		{[]string{"v", "e", "~"}, "ALPHA beta(gamma) delta\nsecond (line\nx) end\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.keys, " "), func(t *testing.T) {
+			m, _ := newTestModel(t, text)
+			m.setKeyProfile("vim")
+			press(m, tt.keys...)
+			if got := m.buf.String(); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Motions reaching past the lines around the cursor search further out.
+func TestVimFarMotions(t *testing.T) {
+	far := strings.Repeat("  \n", 100)
+	text := "key (\n" + far + "key)\n"
+	tests := []struct {
+		keys []string
+		y, x int
+		want string // the text after, when it changes
+	}{
+		{[]string{"w", "w"}, 101, 0, ""},
+		{[]string{"G", "k", "b"}, 0, 4, ""},
+		{[]string{"G", "k", "b", "b"}, 0, 0, ""},
+		{[]string{"G", "k", "e", "e"}, 101, 3, ""},
+		{[]string{"f", "(", "%"}, 101, 3, ""},
+		{[]string{"G", "k", "$", "%"}, 0, 4, ""},
+		{[]string{"*"}, 101, 0, ""},
+		{[]string{"*", "n"}, 0, 0, ""},
+		{[]string{"*", "N"}, 0, 0, ""},
+		{[]string{"*", "N", "N"}, 101, 0, ""},
+		{[]string{"f", "(", "d", "i", "("}, 0, 5, "key ()\n"},
+		{[]string{"j", "j", "d", "a", "("}, 0, 3, "key \n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.keys, " "), func(t *testing.T) {
+			m, _ := newTestModel(t, text)
+			m.setKeyProfile("vim")
+			press(m, tt.keys...)
+			if m.cursorY != tt.y || m.cursorX != tt.x {
+				t.Errorf("cursor at %d:%d, want %d:%d", m.cursorY, m.cursorX, tt.y, tt.x)
+			}
+			want := tt.want
+			if want == "" {
+				want = text
+			}
+			if got := m.buf.String(); got != want {
+				t.Errorf("text = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Gonsole/internal/atomicfile"
+	"github.com/Mohammad-Alipour/Gonsole/internal/diff"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Files change behind the editor's back: a build writes its output, git
+// checks out a branch, the terminal runs a formatter. The directories the
+// sidebar shows and those holding open files are watched. The tree follows
+// what happens in them, and an open document whose file changed is
+// reloaded when it has no unsaved changes; otherwise it asks whether to
+// reload, keep the changes or see how the two differ. Reloading is one
+// undo step, so what was replaced can be brought back.
+
+// fsChangeMsg lists the paths that changed on disk.
+type fsChangeMsg struct {
+	paths []string
+}
+
+// errChangedOnDisk stops a save that would overwrite changes made on disk
+// since the file was read.
+var errChangedOnDisk = errors.New("the file changed on disk")
+
+// waitForChanges waits for the next changes the watcher reports.
+func (m *Model) waitForChanges() tea.Cmd {
+	w := m.watcher
+	return func() tea.Msg {
+		if paths := w.Next(); len(paths) > 0 {
+			return fsChangeMsg{paths: paths}
+		}
+		return nil
+	}
+}
+
+// syncWatches watches the root of the tree, its expanded directories and
+// the directories of the open files. It is called wherever those change:
+// the tree is loaded, expanded, collapsed or refreshed, or a document is
+// opened, closed, saved under another name or moved. Changes reported by
+// the watcher are followed by one too, since reported directories are
+// dropped from the watched set.
+func (m *Model) syncWatches() {
+	if m.tree == nil {
+		// Not loaded yet; loadDir syncs.
+		return
+	}
+	dirs := []string{m.dir}
+	for _, p := range m.tree.ExpandedPaths() {
+		if strings.HasPrefix(p, m.dir+string(filepath.Separator)) {
+			dirs = append(dirs, p)
+		}
+	}
+	for i, d := range m.docs {
+		file := d.file
+		if i == m.active {
+			file = m.file
+		}
+		if abs, err := filepath.Abs(file); err == nil && file != "" {
+			dirs = append(dirs, filepath.Dir(abs))
+		}
+	}
+	m.watcher.Set(dirs)
+}
+
+// filesChanged refreshes the tree when paths are in it and queues the
+// documents open on them to be compared with the disk.
+func (m *Model) filesChanged(paths []string) {
+	changed := make(map[string]bool, len(paths))
+	inTree := false
+	for _, p := range paths {
+		changed[p] = true
+		inTree = inTree || p == m.dir || strings.HasPrefix(p, m.dir+string(filepath.Separator))
+	}
+	if inTree {
+		m.refreshTree()
+	}
+	for i, d := range m.docs {
+		abs, err := filepath.Abs(m.doc(i).file)
+		if err == nil && m.doc(i).file != "" && (changed[abs] || changed[filepath.Dir(abs)]) {
+			m.diskChecks[d] = true
+		}
+	}
+}
+
+// checkDisk compares the queued documents with their files, stopping at
+// the first that needs a question answered while another is asked.
+func (m *Model) checkDisk() {
+	for d := range m.diskChecks {
+		if m.prompt.open {
+			return
+		}
+		delete(m.diskChecks, d)
+		if i := m.indexOf(d); i >= 0 {
+			m.compareWithDisk(i)
+		}
+	}
+}
+
+// compareWithDisk deals with document i's file having changed: a
+// document without unsaved changes is reloaded, one with changes is
+// switched to and asks what to do.
+func (m *Model) compareWithDisk(i int) {
+	var data []byte
+	ask := false
+	m.inDocument(i, func() {
+		if m.file == "" {
+			return
+		}
+		name := filepath.Base(m.file)
+		var err error
+		data, err = os.ReadFile(m.file)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if m.diskHash != "" {
+				// Nothing on disk matches the buffer any more, so leaving
+				// it asks to save.
+				m.diskHash = ""
+				m.history.saved = nil
+				m.status = fmt.Sprintf("%s was deleted on disk; saving writes it again", name)
+			}
+			return
+		case err != nil || contentHash(data) == m.diskHash:
+			return
+		}
+		text, format, err := m.diskText(data)
+		switch {
+		case err != nil:
+			m.status = fmt.Sprintf("%s changed on disk and cannot be read: %v", name, err)
+		case text == m.buf.String() && !m.formatChanged:
+			// Saved elsewhere with the same text, or back to it.
+			m.format = format
+			m.diskHash = contentHash(data)
+			m.history.saved = m.history.current
+		case !m.modified():
+			m.reloadFromDisk(data, text, format)
+			m.status = fmt.Sprintf("Reloaded %s, which changed on disk", name)
+		default:
+			ask = true
+		}
+	})
+	if ask {
+		m.switchTo(i)
+		m.askReload(data, false)
+	}
+}
+
+// inDocument runs f with document i in the Model's fields, as if it were
+// active, and leaves the active document and the panes as they were.
+func (m *Model) inDocument(i int, f func()) {
+	if i == m.active {
+		f()
+		return
+	}
+	m.stash()
+	prev := m.active
+	m.active = i
+	m.use(m.docs[i])
+	f()
+	*m.docs[i] = m.current()
+	m.active = prev
+	m.use(m.docs[prev])
+}
+
+// diskText decodes data as opening the file would, without changing the
+// format the buffer is saved in.
+func (m *Model) diskText(data []byte) (string, fileFormat, error) {
+	old := m.format
+	text, err := m.decodeFile(data, "")
+	format := m.format
+	m.format = old
+	return text, format, err
+}
+
+// reloadFromDisk replaces the buffer with text, read from data on disk,
+// as one undo step and marks it saved.
+func (m *Model) reloadFromDisk(data []byte, text string, format fileFormat) {
+	if text != m.buf.String() {
+		m.replaceAll(text)
+	}
+	m.format = format
+	m.formatChanged = false
+	m.diskHash = contentHash(data)
+	m.history.saved = m.history.current
+}
+
+// askReload asks whether to replace the unsaved changes with the file's
+// new content, data, optionally showing how the two differ.
+func (m *Model) askReload(data []byte, showDiff bool) {
+	name := filepath.Base(m.file)
+	text, format, err := m.diskText(data)
+	if err != nil {
+		m.status = fmt.Sprintf("%s changed on disk and cannot be read: %v", name, err)
+		return
+	}
+	choices := []promptChoice{
+		reloadChoice(data, text, format),
+		{key: "k", label: "Keep mine", run: func(m *Model) tea.Cmd {
+			// Saving now overwrites what was found on disk.
+			m.diskHash = contentHash(data)
+			m.status = fmt.Sprintf("Kept your changes to %s; saving overwrites the file on disk", name)
+			return nil
+		}},
+	}
+	if !showDiff {
+		choices = append(choices, promptChoice{key: "d", label: "Diff", run: func(m *Model) tea.Cmd {
+			m.askReload(data, true)
+			return nil
+		}})
+	}
+	m.ask(fmt.Sprintf("%s changed on disk and has unsaved changes.", name), choices...)
+	if showDiff {
+		script := diff.Lines(strings.Split(m.buf.String(), "\n"), strings.Split(text, "\n"))
+		m.prompt.preview = diff.Unified(script, 3)
+	}
+}
+
+// reloadChoice is the answer that replaces unsaved changes with the
+// file's new content.
+func reloadChoice(data []byte, text string, format fileFormat) promptChoice {
+	return promptChoice{key: "r", label: "Reload", run: func(m *Model) tea.Cmd {
+		m.reloadFromDisk(data, text, format)
+		m.status = "Reloaded " + filepath.Base(m.file)
+		if h := m.keyHint("edit.undo", "brings your changes back"); h != "" {
+			m.status += " (" + h + ")"
+		}
+		return nil
+	}}
+}
+
+// changedOnDisk reports whether the file holds something other than what
+// was last read from or written to it.
+func (m *Model) changedOnDisk() bool {
+	data, err := os.ReadFile(m.file)
+	return err == nil && contentHash(data) != m.diskHash
+}
+
+// confirmOverwrite asks before saving content over changes made to the
+// file on disk, optionally showing what saving would change.
+func (m *Model) confirmOverwrite(content []byte, showDiff bool) {
+	name := filepath.Base(m.file)
+	data, err := os.ReadFile(m.file)
+	if err != nil {
+		m.status = fmt.Sprintf("cannot read %s: %v (changes not saved)", name, unwrapPathError(err))
+		return
+	}
+	text, format, err := m.diskText(data)
+	if err != nil {
+		m.status = fmt.Sprintf("cannot read %s: %v (changes not saved)", name, err)
+		return
+	}
+	m.status = fmt.Sprintf("%s changed on disk since it was read (changes not saved)", name)
+	choices := []promptChoice{
+		{key: "o", label: "Overwrite", run: func(m *Model) tea.Cmd {
+			if err := atomicfile.Write(m.file, content, 0o644); err != nil {
+				m.saveFailed(err, content)
+				return nil
+			}
+			m.markSaved(content)
+			return nil
+		}},
+		reloadChoice(data, text, format),
+	}
+	if !showDiff {
+		choices = append(choices, promptChoice{key: "d", label: "Diff", run: func(m *Model) tea.Cmd {
+			m.confirmOverwrite(content, true)
+			return nil
+		}})
+	}
+	m.ask(fmt.Sprintf("%s changed on disk since it was read.", name), choices...)
+	if showDiff {
+		saved, _ := m.saveRules(m.buf.String())
+		script := diff.Lines(strings.Split(text, "\n"), strings.Split(saved, "\n"))
+		m.prompt.preview = diff.Unified(script, 3)
+	}
+}
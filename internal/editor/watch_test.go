@@ -0,0 +1,71 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestModel returns an editor opened on a file holding text, with the
+// settings, caches and tree state kept in a temporary directory.
+func newTestModel(t *testing.T, text string) (*Model, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("SHELL", "/bin/sh")
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := os.Args
+	os.Args = []string{"gonsole", path}
+	t.Cleanup(func() { os.Args = args })
+	m := New()
+	t.Cleanup(func() {
+		_ = m.watcher.Close()
+		if m.ptyCmd != nil && m.ptyCmd.Process != nil {
+			_ = m.ptyCmd.Process.Kill()
+		}
+		if m.ptyFile != nil {
+			_ = m.ptyFile.Close()
+		}
+	})
+	return &m, path
+}
+
+func TestEditsAfterDiskChangeAreUnsaved(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   string // typed before the file changes, if anything
+		disk   string
+		status string
+	}{
+		{"reloaded", "", "changed\n", "Reloaded file.txt, which changed on disk"},
+		{"saved elsewhere with the same text", "x", "xone\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, path := newTestModel(t, "one\n")
+			m.status = ""
+			m.typeText(tt.edit)
+			if err := os.WriteFile(path, []byte(tt.disk), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			m.compareWithDisk(m.active)
+			if m.status != tt.status {
+				t.Errorf("status = %q, want %q", m.status, tt.status)
+			}
+			if m.modified() || m.buf.String() != tt.disk {
+				t.Fatalf("after the change: modified = %v, text %q, want clean %q", m.modified(), m.buf.String(), tt.disk)
+			}
+			// Typing where the last edit ended must not look saved.
+			m.cursorY, m.cursorX = 0, len(tt.edit)
+			m.typeText("y")
+			if !m.modified() {
+				t.Errorf("typing after the change left the buffer unmodified")
+			}
+		})
+	}
+}
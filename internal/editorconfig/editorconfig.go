@@ -0,0 +1,313 @@
+// Package editorconfig reads .editorconfig files (https://editorconfig.org).
+//
+// Resolve walks from a file's directory upwards, stopping at a file that
+// declares root = true, and merges the sections whose glob matches the
+// file. Closer files win over farther ones and later sections over
+// earlier ones.
+package editorconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileName is the name of an EditorConfig file.
+const FileName = ".editorconfig"
+
+// Properties maps lower-case property names to their values. Values of
+// the standard properties are lower-cased too.
+type Properties map[string]string
+
+// knownProperties are the properties whose values are case-insensitive.
+var knownProperties = map[string]bool{
+	"indent_style":             true,
+	"indent_size":              true,
+	"tab_width":                true,
+	"end_of_line":              true,
+	"charset":                  true,
+	"trim_trailing_whitespace": true,
+	"insert_final_newline":     true,
+	"root":                     true,
+}
+
+type section struct {
+	glob  *regexp.Regexp
+	props Properties
+}
+
+type file struct {
+	dir      string
+	root     bool
+	sections []section
+}
+
+// Resolve returns the properties that apply to the file at path.
+func Resolve(path string) (Properties, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []*file
+	for dir := filepath.Dir(path); ; {
+		f, err := parseFile(filepath.Join(dir, FileName))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			files = append(files, f)
+			if f.root {
+				dir = ""
+			}
+		}
+		parent := filepath.Dir(dir)
+		if dir == "" || parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	props := Properties{}
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, s := range f.sections {
+			if !s.glob.MatchString(rel) {
+				continue
+			}
+			for k, v := range s.props {
+				props[k] = v
+			}
+		}
+	}
+	for k, v := range props {
+		if v == "unset" {
+			delete(props, k)
+		}
+	}
+	// indent_size = tab means the tab width, and tab_width defaults to
+	// indent_size.
+	if props["indent_size"] == "tab" && props["tab_width"] != "" {
+		props["indent_size"] = props["tab_width"]
+	}
+	if _, ok := props["tab_width"]; !ok && props["indent_size"] != "" && props["indent_size"] != "tab" {
+		props["tab_width"] = props["indent_size"]
+	}
+	return props, nil
+}
+
+func parseFile(path string) (*file, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	f := &file{dir: filepath.Dir(path)}
+	var cur *section
+	sc := bufio.NewScanner(fh)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			re, err := compileGlob(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			f.sections = append(f.sections, section{glob: re, props: Properties{}})
+			cur = &f.sections[len(f.sections)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			key, value, ok = strings.Cut(line, ":")
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if knownProperties[key] {
+			value = strings.ToLower(value)
+		}
+		switch {
+		case cur != nil:
+			cur.props[key] = value
+		case key == "root":
+			f.root = value == "true"
+		}
+	}
+	return f, sc.Err()
+}
+
+// compileGlob turns an EditorConfig glob into a regular expression over
+// slash-separated paths relative to the file's directory. A glob without
+// a slash matches the file name in any directory.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	switch {
+	case strings.HasPrefix(glob, "/"):
+		glob = glob[1:]
+	case !strings.Contains(glob, "/"):
+		b.WriteString("(?:.*/)?")
+	}
+	depth := 0 // open braces
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(runes[i])))
+			}
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := -1
+			for j := i + 1; j < len(runes) && runes[j] != '/'; j++ {
+				if runes[j] == ']' {
+					end = j
+					break
+				}
+			}
+			class := []rune{}
+			if end > 0 {
+				class = runes[i+1 : end]
+			}
+			if len(class) == 0 || string(class) == "!" {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteString("[")
+			if class[0] == '!' {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			for _, c := range class {
+				if c == '\\' || c == '[' || c == '^' {
+					b.WriteString(`\`)
+				}
+				b.WriteRune(c)
+			}
+			b.WriteString("]")
+			i = end
+		case '{':
+			close := strings.IndexRune(string(runes[i:]), '}')
+			if close < 0 {
+				b.WriteString(`\{`)
+				continue
+			}
+			body := string(runes[i:])[1:close]
+			if m := numRange.FindStringSubmatch(body); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				if lo > hi {
+					lo, hi = hi, lo
+				}
+				var alts []string
+				for n := lo; n <= hi && n-lo < 10000; n++ {
+					alts = append(alts, strconv.Itoa(n))
+				}
+				b.WriteString("(?:" + strings.Join(alts, "|") + ")")
+				i += len([]rune(body)) + 1
+				continue
+			}
+			if !strings.Contains(body, ",") {
+				// A single word in braces is matched literally.
+				b.WriteString(regexp.QuoteMeta("{" + body + "}"))
+				i += len([]rune(body)) + 1
+				continue
+			}
+			b.WriteString("(?:")
+			depth++
+		case '}':
+			if depth > 0 {
+				b.WriteString(")")
+				depth--
+			} else {
+				b.WriteString(`\}`)
+			}
+		case ',':
+			if depth > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("unclosed brace in [%s]", glob)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+var numRange = regexp.MustCompile(`^([+-]?\d+)\.\.([+-]?\d+)$`)
+
+// IndentStyle returns "tab", "space" or "".
+func (p Properties) IndentStyle() string {
+	return p["indent_style"]
+}
+
+// IndentSize returns the width of one indentation level, or 0.
+func (p Properties) IndentSize() int {
+	n, _ := strconv.Atoi(p["indent_size"])
+	return n
+}
+
+// TabWidth returns the display width of a tab, or 0.
+func (p Properties) TabWidth() int {
+	n, _ := strconv.Atoi(p["tab_width"])
+	return n
+}
+
+// EndOfLine returns "\n", "\r\n", "\r" or "" when unset.
+func (p Properties) EndOfLine() string {
+	switch p["end_of_line"] {
+	case "lf":
+		return "\n"
+	case "crlf":
+		return "\r\n"
+	case "cr":
+		return "\r"
+	}
+	return ""
+}
+
+// Charset returns the charset property: "utf-8", "utf-8-bom", "latin1",
+// "utf-16be", "utf-16le" or "".
+func (p Properties) Charset() string {
+	return p["charset"]
+}
+
+// Bool returns a true/false property and whether it is set.
+func (p Properties) Bool(name string) (value, ok bool) {
+	switch p[name] {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
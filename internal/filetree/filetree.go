@@ -0,0 +1,262 @@
+// Package filetree models the directory tree shown in the sidebar.
+//
+// Directories are read lazily, the first time they are expanded. Which
+// directories are expanded is recorded by path rather than on the nodes,
+// so it survives refreshing the tree, moving its root and, through
+// ExpandedPaths and SetExpanded, restarting the editor.
+package filetree
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Node is a file or directory in the tree.
+type Node struct {
+	Name   string
+	Path   string // absolute
+	Dir    bool
+	Parent *Node
+	// Children of a directory, directories first and each group sorted by
+	// name. They are read when the directory is first expanded.
+	Children []*Node
+	Err      error // why the directory could not be read
+	loaded   bool
+}
+
+// Depth returns how many directories lie between n and the root.
+func (n *Node) Depth() int {
+	d := -1
+	for p := n.Parent; p != nil; p = p.Parent {
+		d++
+	}
+	return d
+}
+
+// Tree is a directory tree rooted at Root, which is always expanded.
+type Tree struct {
+	Root *Node
+	// Hide, when set, reports the entries to leave out of the tree. It
+	// applies from the next time a directory is read.
+	Hide     func(path string, dir bool) bool
+	expanded map[string]bool
+}
+
+// New returns the tree rooted at dir with its top level read, leaving out
+// what hide reports.
+func New(dir string, hide func(path string, dir bool) bool) *Tree {
+	t := &Tree{Hide: hide, expanded: map[string]bool{}}
+	t.SetRoot(dir)
+	return t
+}
+
+// SetRoot moves the root of the tree to dir, keeping what is expanded.
+func (t *Tree) SetRoot(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	t.Root = &Node{Name: filepath.Base(dir), Path: dir, Dir: true}
+	t.load(t.Root)
+}
+
+// IsExpanded reports whether the children of n are shown.
+func (t *Tree) IsExpanded(n *Node) bool {
+	return n == t.Root || (n.Dir && t.expanded[n.Path])
+}
+
+// Expand shows the children of the directory n, reading them if needed.
+func (t *Tree) Expand(n *Node) {
+	if !n.Dir {
+		return
+	}
+	t.expanded[n.Path] = true
+	t.fill(n)
+}
+
+// fill reads n, and every directory below it that is expanded, if they
+// were not read yet.
+func (t *Tree) fill(n *Node) {
+	if !n.loaded {
+		t.load(n)
+	}
+	for _, c := range n.Children {
+		if t.IsExpanded(c) {
+			t.fill(c)
+		}
+	}
+}
+
+// Collapse hides the children of n.
+func (t *Tree) Collapse(n *Node) {
+	delete(t.expanded, n.Path)
+}
+
+// Toggle expands n when it is collapsed and collapses it otherwise.
+func (t *Tree) Toggle(n *Node) {
+	if t.IsExpanded(n) {
+		t.Collapse(n)
+	} else {
+		t.Expand(n)
+	}
+}
+
+// Visible returns the nodes shown under the root, in display order.
+func (t *Tree) Visible() []*Node {
+	var out []*Node
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, c := range n.Children {
+			out = append(out, c)
+			if t.IsExpanded(c) {
+				walk(c)
+			}
+		}
+	}
+	walk(t.Root)
+	return out
+}
+
+// Find returns the node for path among those read so far, or nil.
+func (t *Tree) Find(path string) *Node {
+	rel, ok := t.rel(path)
+	if !ok {
+		return nil
+	}
+	n := t.Root
+	if rel == "." {
+		return n
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		n = n.child(name)
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Reveal expands every directory above path and returns its node, or nil
+// when path is not under the root.
+func (t *Tree) Reveal(path string) *Node {
+	rel, ok := t.rel(path)
+	if !ok {
+		return nil
+	}
+	n := t.Root
+	if rel == "." {
+		return n
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		t.Expand(n)
+		n = n.child(name)
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Refresh reads every directory that is expanded again, so that the tree
+// shows what is on disk now. Directories that are collapsed are read when
+// next expanded.
+func (t *Tree) Refresh() {
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if !t.IsExpanded(n) {
+			n.Children, n.loaded = nil, false
+			return
+		}
+		old := n.Children
+		t.load(n)
+		for i, c := range n.Children {
+			for _, o := range old {
+				if o.Name == c.Name && o.Dir == c.Dir {
+					// Keep what was read below it.
+					o.Parent = n
+					n.Children[i] = o
+					break
+				}
+			}
+			walk(n.Children[i])
+		}
+	}
+	walk(t.Root)
+}
+
+// Rename records that the entry at from was moved to to, so that what was
+// expanded in it stays expanded. Refresh shows it in its new place.
+func (t *Tree) Rename(from, to string) {
+	for p := range t.expanded {
+		if p == from || strings.HasPrefix(p, from+string(filepath.Separator)) {
+			delete(t.expanded, p)
+			t.expanded[to+p[len(from):]] = true
+		}
+	}
+}
+
+// ExpandedPaths returns the expanded directories, sorted.
+func (t *Tree) ExpandedPaths() []string {
+	paths := make([]string, 0, len(t.expanded))
+	for p := range t.expanded {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// SetExpanded expands the directories at paths, reading the ones that are
+// shown.
+func (t *Tree) SetExpanded(paths []string) {
+	for _, p := range paths {
+		t.expanded[p] = true
+	}
+	t.fill(t.Root)
+}
+
+// rel returns path relative to the root, if it is under it.
+func (t *Tree) rel(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(t.Root.Path, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+func (n *Node) child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// load reads the children of the directory n.
+func (t *Tree) load(n *Node) {
+	n.loaded = true
+	entries, err := os.ReadDir(n.Path)
+	n.Err = err
+	n.Children = nil
+	for _, e := range entries {
+		dir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if fi, err := os.Stat(filepath.Join(n.Path, e.Name())); err == nil {
+				dir = fi.IsDir()
+			}
+		}
+		path := filepath.Join(n.Path, e.Name())
+		if t.Hide != nil && t.Hide(path, dir) {
+			continue
+		}
+		n.Children = append(n.Children, &Node{Name: e.Name(), Path: path, Dir: dir, Parent: n})
+	}
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		return n.Children[i].Dir && !n.Children[j].Dir
+	})
+}
@@ -0,0 +1,344 @@
+// Package ignore decides which files the sidebar, project search and the
+// file finder leave out.
+//
+// It reads .gitignore and .ignore files with git's rules: a file applies
+// to its directory and everything below it, deeper files override
+// shallower ones and later patterns earlier ones, "!" includes again what
+// an earlier pattern left out, a trailing slash matches only directories,
+// and a pattern with a slash anywhere but at its end is anchored to the
+// file's directory. As in git, nothing inside a directory that is left
+// out can be included again. Files are read from the top of the git
+// repository the root is in, so that rules above the root still apply,
+// along with the repository's .git/info/exclude.
+//
+// Exclude patterns from the settings use the same syntax and cannot be
+// overridden by ignore files. Hidden files, whose names start with a dot,
+// are left out unless ShowHidden is set.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Files are the names of the ignore files read in every directory, in
+// increasing precedence.
+var Files = []string{".gitignore", ".ignore"}
+
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher decides what is left out under Root. It reads ignore files the
+// first time a directory is looked at; Reset makes it read them again.
+// It is not safe for concurrent use.
+type Matcher struct {
+	Root       string // absolute
+	ShowHidden bool
+	top        string // the top of the repository, or Root
+	base       string // Root relative to top
+	excludes   []pattern
+	dirs       map[string][]pattern // by directory, relative to top
+}
+
+// New returns a matcher for the tree under root that also leaves out what
+// the exclude patterns match. Patterns that cannot be compiled are
+// skipped and reported.
+func New(root string, excludes []string) (*Matcher, []error) {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	m := &Matcher{Root: root, top: root}
+	for dir := root; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			m.top = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	m.base, _ = relTo(m.top, root)
+	var errs []error
+	for _, e := range excludes {
+		p, ok, err := parse(e)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			m.excludes = append(m.excludes, p)
+		}
+	}
+	m.Reset()
+	return m, errs
+}
+
+// Check reports whether glob is a valid pattern.
+func Check(glob string) error {
+	_, _, err := parse(glob)
+	return err
+}
+
+// Clone returns a matcher with the same settings and its own copy of the
+// ignore files read so far, for use on another goroutine.
+func (m *Matcher) Clone() *Matcher {
+	c := *m
+	c.dirs = make(map[string][]pattern, len(m.dirs))
+	for rel, ps := range m.dirs {
+		c.dirs[rel] = ps
+	}
+	return &c
+}
+
+// Reset forgets the ignore files read so far.
+func (m *Matcher) Reset() {
+	m.dirs = map[string][]pattern{}
+}
+
+// Ignored reports whether the file or directory at path is left out,
+// either itself or because a directory above it is. Only the part of
+// path below Root is considered, so the root itself is never left out.
+func (m *Matcher) Ignored(path string, dir bool) bool {
+	rel, ok := relTo(m.Root, path)
+	if !ok || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		if m.ignored(strings.Join(parts[:i+1], "/"), dir || i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk calls fn for every regular file under Root that is not left out,
+// in lexical order, without descending into directories that are. Fn can
+// return fs.SkipAll to stop. Directories that cannot be read are skipped.
+func (m *Matcher) Walk(fn func(path string) error) error {
+	return filepath.WalkDir(m.Root, func(path string, d fs.DirEntry, err error) error {
+		if path == m.Root {
+			return err
+		}
+		if err != nil {
+			return nil
+		}
+		rel, _ := relTo(m.Root, path)
+		if m.ignored(rel, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// ignored reports whether the entry at rel, slash-separated and relative
+// to Root, is left out by its own name, assuming the directories above it
+// are not.
+func (m *Matcher) ignored(rel string, dir bool) bool {
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	if !m.ShowHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if match(m.excludes, rel, dir) {
+		return true
+	}
+	if m.base != "" {
+		rel = m.base + "/" + rel
+	}
+	out := false
+	parent, dirs := "", []string{""}
+	for _, part := range strings.Split(rel, "/")[:strings.Count(rel, "/")] {
+		parent = strings.TrimPrefix(parent+"/"+part, "/")
+		dirs = append(dirs, parent)
+	}
+	for _, d := range dirs {
+		sub := rel
+		if d != "" {
+			sub = rel[len(d)+1:]
+		}
+		for _, p := range m.patterns(d) {
+			if (!p.dirOnly || dir) && p.re.MatchString(sub) {
+				out = !p.negate
+			}
+		}
+	}
+	return out
+}
+
+// match reports whether the last of patterns to match rel leaves it out.
+func match(patterns []pattern, rel string, dir bool) bool {
+	out := false
+	for _, p := range patterns {
+		if (!p.dirOnly || dir) && p.re.MatchString(rel) {
+			out = !p.negate
+		}
+	}
+	return out
+}
+
+// patterns returns the patterns of the ignore files in the directory rel,
+// relative to the top.
+func (m *Matcher) patterns(rel string) []pattern {
+	if ps, ok := m.dirs[rel]; ok {
+		return ps
+	}
+	dir := filepath.Join(m.top, filepath.FromSlash(rel))
+	var ps []pattern
+	if rel == "" {
+		ps = readFile(filepath.Join(m.top, ".git", "info", "exclude"))
+	}
+	for _, name := range Files {
+		ps = append(ps, readFile(filepath.Join(dir, name))...)
+	}
+	m.dirs[rel] = ps
+	return ps
+}
+
+// readFile returns the patterns in the ignore file at path. Lines that
+// are not valid patterns are skipped, as git does.
+func readFile(path string) []pattern {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var ps []pattern
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if p, ok, err := parse(sc.Text()); ok && err == nil {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// parse compiles one line of an ignore file. Blank lines and comments
+// give ok == false.
+func parse(line string) (p pattern, ok bool, err error) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return p, false, nil
+	}
+	glob := line
+	if glob[0] == '!' {
+		p.negate = true
+		glob = glob[1:]
+	}
+	if strings.HasSuffix(glob, "/") {
+		p.dirOnly = true
+		glob = strings.TrimRight(glob, "/")
+	}
+	if glob == "" {
+		return p, false, nil
+	}
+	p.re, err = compileGlob(glob)
+	if err != nil {
+		return p, false, fmt.Errorf("%q: %w", line, err)
+	}
+	return p, true, nil
+}
+
+// compileGlob turns an ignore pattern into a regular expression over
+// slash-separated paths relative to the ignore file's directory. A
+// pattern without a slash matches the name in any directory.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	switch {
+	case strings.HasPrefix(glob, "/"):
+		glob = glob[1:]
+	case !strings.Contains(glob, "/"):
+		b.WriteString("(?:.*/)?")
+	}
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(runes[i])))
+			}
+		case '*':
+			double := i+1 < len(runes) && runes[i+1] == '*'
+			atStart := i == 0 || runes[i-1] == '/'
+			switch {
+			case double && atStart && i+2 == len(runes):
+				// "dir/**" is everything inside dir.
+				b.WriteString(".*")
+				i++
+			case double && atStart && runes[i+2] == '/':
+				// "**/" is any number of directories, none included.
+				b.WriteString("(?:.*/)?")
+				i += 2
+			default:
+				for i+1 < len(runes) && runes[i+1] == '*' {
+					i++
+				}
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := -1
+			for j := i + 1; j < len(runes) && runes[j] != '/'; j++ {
+				if runes[j] == ']' && j > i+1 && !(j == i+2 && (runes[i+1] == '!' || runes[i+1] == '^')) {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := runes[i+1 : end]
+			b.WriteString("[")
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			for _, c := range class {
+				if c == '\\' || c == '[' || c == ']' || c == '^' {
+					b.WriteString(`\`)
+				}
+				b.WriteRune(c)
+			}
+			b.WriteString("]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// relTo returns path relative to dir with slashes, "" for dir itself, or
+// false when path is not under dir.
+func relTo(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,393 @@
+// Package keymap maps key sequences to named commands.
+//
+// Keys are written the way bubbletea names them ("ctrl+s", "alt+shift+up",
+// "f2") and a sequence of several keys, a chord, separates them with
+// spaces ("ctrl+k ctrl+c"). Every binding belongs to a scope. Lookups walk
+// a list of scopes from the most specific one, so an editor binding can
+// shadow a global one and fall back to it when its command does not apply.
+package keymap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scope is the part of the UI a binding applies to.
+type Scope string
+
+const (
+	Global     Scope = "global"
+	Editor     Scope = "editor"
+	Sidebar    Scope = "sidebar"
+	Terminal   Scope = "terminal"
+	Search     Scope = "search"
+	Extensions Scope = "extensions"
+)
+
+// Scopes lists every scope, Global first.
+var Scopes = []Scope{Global, Editor, Sidebar, Terminal, Search, Extensions}
+
+// Binding ties a key sequence in a scope to a command. In a user file a
+// command starting with "-" removes the binding instead.
+type Binding struct {
+	Keys    string `json:"key"`
+	Command string `json:"command"`
+	Scope   Scope  `json:"scope,omitempty"`
+}
+
+// Result says what feeding a key did.
+type Result int
+
+const (
+	// None means the key is not bound and no chord was in progress.
+	None Result = iota
+	// Pending means the key starts or continues a chord.
+	Pending
+	// Match means the key completed a bound sequence.
+	Match
+	// Broken means a chord was in progress and the key does not continue it.
+	Broken
+)
+
+// Keymap holds the bindings and the chord typed so far.
+type Keymap struct {
+	bindings map[Scope]map[string]string
+	pending  []string
+	dupes    []Conflict // bindings a user file made twice
+}
+
+// New returns an empty keymap.
+func New() *Keymap {
+	k := &Keymap{bindings: make(map[Scope]map[string]string)}
+	for _, s := range Scopes {
+		k.bindings[s] = make(map[string]string)
+	}
+	return k
+}
+
+// Normalize rewrites a key sequence in canonical form: modifiers in
+// lower case and in the order bubbletea prints them (alt, ctrl, shift).
+func Normalize(seq string) (string, error) {
+	fields := strings.Fields(seq)
+	if len(fields) == 0 {
+		return "", errors.New("empty key sequence")
+	}
+	for i, f := range fields {
+		parts := strings.Split(f, "+")
+		key := parts[len(parts)-1]
+		if key == "" {
+			// "ctrl++" binds the plus key.
+			key = "+"
+			parts = parts[:len(parts)-1]
+		}
+		mods := map[string]bool{}
+		for _, p := range parts[:len(parts)-1] {
+			p = strings.ToLower(p)
+			switch p {
+			case "alt", "ctrl", "shift":
+				mods[p] = true
+			case "":
+			default:
+				return "", fmt.Errorf("unknown modifier %q in %q", p, f)
+			}
+		}
+		if len([]rune(key)) > 1 {
+			key = strings.ToLower(key)
+		}
+		switch key {
+		case "escape":
+			key = "esc"
+		case "return":
+			key = "enter"
+		case "space":
+			key = " "
+		}
+		var b strings.Builder
+		for _, mod := range []string{"alt", "ctrl", "shift"} {
+			if mods[mod] {
+				b.WriteString(mod + "+")
+			}
+		}
+		b.WriteString(key)
+		fields[i] = b.String()
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// Format renders a sequence for display, e.g. "Ctrl+K Ctrl+C".
+func Format(seq string) string {
+	fields := strings.Split(seq, " ")
+	if seq == " " {
+		fields = []string{"space"}
+	}
+	for i, f := range fields {
+		parts := strings.Split(f, "+")
+		for j, p := range parts {
+			if p == "" {
+				parts[j] = "Space"
+				continue
+			}
+			parts[j] = strings.ToUpper(p[:1]) + p[1:]
+		}
+		fields[i] = strings.Join(parts, "+")
+	}
+	return strings.Join(fields, " ")
+}
+
+func validScope(s Scope) bool {
+	for _, x := range Scopes {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Bind maps keys in scope to command, replacing an earlier binding of the
+// same keys. An empty scope means Global.
+func (k *Keymap) Bind(scope Scope, keys, command string) error {
+	if scope == "" {
+		scope = Global
+	}
+	if !validScope(scope) {
+		return fmt.Errorf("unknown scope %q", scope)
+	}
+	seq, err := Normalize(keys)
+	if err != nil {
+		return err
+	}
+	k.bindings[scope][seq] = command
+	return nil
+}
+
+// Unbind removes the binding of keys in scope.
+func (k *Keymap) Unbind(scope Scope, keys string) error {
+	if scope == "" {
+		scope = Global
+	}
+	seq, err := Normalize(keys)
+	if err != nil {
+		return err
+	}
+	delete(k.bindings[scope], seq)
+	return nil
+}
+
+// Lookup returns the command bound to keys in scope alone.
+func (k *Keymap) Lookup(scope Scope, keys string) string {
+	seq, err := Normalize(keys)
+	if err != nil {
+		return ""
+	}
+	return k.bindings[scope][seq]
+}
+
+// Bindings returns every binding sorted by scope and keys.
+func (k *Keymap) Bindings() []Binding {
+	var out []Binding
+	for _, s := range Scopes {
+		for seq, cmd := range k.bindings[s] {
+			out = append(out, Binding{Keys: seq, Command: cmd, Scope: s})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Scope != out[j].Scope {
+			return scopeIndex(out[i].Scope) < scopeIndex(out[j].Scope)
+		}
+		return out[i].Keys < out[j].Keys
+	})
+	return out
+}
+
+func scopeIndex(s Scope) int {
+	for i, x := range Scopes {
+		if x == s {
+			return i
+		}
+	}
+	return len(Scopes)
+}
+
+// KeysFor returns the sequences bound to command, global and editor
+// bindings first and shorter sequences before longer ones.
+func (k *Keymap) KeysFor(command string) []string {
+	var found []Binding
+	for _, b := range k.Bindings() {
+		if b.Command == command {
+			found = append(found, b)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Scope != found[j].Scope {
+			return scopeIndex(found[i].Scope) < scopeIndex(found[j].Scope)
+		}
+		return len(found[i].Keys) < len(found[j].Keys)
+	})
+	out := make([]string, len(found))
+	for i, b := range found {
+		out[i] = b.Keys
+	}
+	return out
+}
+
+// Feed adds key to the chord in progress and looks the sequence up in
+// scopes, most specific first. On a match it returns the bound commands in
+// that order so the caller can run the first one that applies.
+func (k *Keymap) Feed(key string, scopes ...Scope) ([]string, Result) {
+	seq := strings.Join(append(k.pending, key), " ")
+	var cmds []string
+	longer := false
+	for _, s := range scopes {
+		if c, ok := k.bindings[s][seq]; ok {
+			cmds = append(cmds, c)
+		}
+		for b := range k.bindings[s] {
+			if strings.HasPrefix(b, seq+" ") {
+				longer = true
+			}
+		}
+	}
+	switch {
+	case longer:
+		k.pending = append(k.pending, key)
+		return nil, Pending
+	case len(cmds) > 0:
+		k.pending = nil
+		return cmds, Match
+	case len(k.pending) > 0:
+		k.pending = nil
+		return nil, Broken
+	}
+	return nil, None
+}
+
+// Pending returns the chord typed so far, or "".
+func (k *Keymap) Pending() string {
+	return strings.Join(k.pending, " ")
+}
+
+// Reset abandons the chord in progress.
+func (k *Keymap) Reset() {
+	k.pending = nil
+}
+
+// Conflict is a binding that can never fire, or a key bound twice.
+type Conflict struct {
+	Scope        Scope
+	Keys         string
+	Command      string
+	OtherKeys    string
+	OtherCommand string
+}
+
+func (c Conflict) String() string {
+	if c.Keys == c.OtherKeys {
+		return fmt.Sprintf("%s: %s is bound to both %s and %s", c.Scope, Format(c.Keys), c.Command, c.OtherCommand)
+	}
+	return fmt.Sprintf("%s: %s (%s) is never reached because %s (%s) starts with it",
+		c.Scope, Format(c.Keys), c.Command, Format(c.OtherKeys), c.OtherCommand)
+}
+
+// Conflicts reports keys bound twice by a user file and bindings shadowed
+// by a chord that begins with the same keys, within a scope or between a
+// scope and Global.
+func (k *Keymap) Conflicts() []Conflict {
+	out := append([]Conflict(nil), k.dupes...)
+	for _, s := range Scopes {
+		type entry struct {
+			scope     Scope
+			seq, name string
+		}
+		var entries []entry
+		for seq, c := range k.bindings[s] {
+			entries = append(entries, entry{s, seq, c})
+		}
+		if s != Global {
+			for seq, c := range k.bindings[Global] {
+				entries = append(entries, entry{Global, seq, c})
+			}
+		}
+		for _, a := range entries {
+			for _, b := range entries {
+				if a.scope != s && b.scope != s {
+					continue // a Global pair, reported under Global
+				}
+				if strings.HasPrefix(b.seq, a.seq+" ") {
+					out = append(out, Conflict{Scope: s, Keys: a.seq, Command: a.name, OtherKeys: b.seq, OtherCommand: b.name})
+				}
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out
+}
+
+// DefaultPath returns the user keybindings file,
+// $XDG_CONFIG_HOME/gonsole/keybindings.json on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gonsole", "keybindings.json"), nil
+}
+
+// Load applies the bindings in the JSON file at path on top of the
+// current ones. A missing file is not an error. Entries that cannot be
+// applied are skipped and reported together in the returned error.
+func (k *Keymap) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var bindings []Binding
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var errs []error
+	seen := map[string]Binding{}
+	for i, b := range bindings {
+		if b.Scope == "" {
+			b.Scope = Global
+		}
+		if remove, ok := strings.CutPrefix(b.Command, "-"); ok {
+			// Only the binding named goes; keys bound to something else
+			// are left alone.
+			_, err := Normalize(b.Keys)
+			if err == nil && !validScope(b.Scope) {
+				err = fmt.Errorf("unknown scope %q", b.Scope)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: entry %d: %w", path, i+1, err))
+				continue
+			}
+			switch cur := k.Lookup(b.Scope, b.Keys); cur {
+			case remove:
+				_ = k.Unbind(b.Scope, b.Keys)
+			case "":
+			default:
+				errs = append(errs, fmt.Errorf("%s: entry %d: %s is bound to %s, not %s", path, i+1, b.Keys, cur, remove))
+			}
+			continue
+		}
+		if err := k.Bind(b.Scope, b.Keys, b.Command); err != nil {
+			errs = append(errs, fmt.Errorf("%s: entry %d: %w", path, i+1, err))
+			continue
+		}
+		seq, _ := Normalize(b.Keys)
+		id := string(b.Scope) + "\x00" + seq
+		if prev, ok := seen[id]; ok && prev.Command != b.Command {
+			k.dupes = append(k.dupes, Conflict{Scope: b.Scope, Keys: seq, Command: prev.Command, OtherKeys: seq, OtherCommand: b.Command})
+		}
+		seen[id] = b
+	}
+	return errors.Join(errs...)
+}
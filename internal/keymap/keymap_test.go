@@ -0,0 +1,171 @@
+package keymap
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      bool
+	}{
+		{"ctrl+s", "ctrl+s", false},
+		{"Shift+Ctrl+Up", "ctrl+shift+up", false},
+		{"ctrl+alt+x", "alt+ctrl+x", false},
+		{"ctrl+K  ctrl+C", "ctrl+K ctrl+C", false},
+		{"ctrl++", "ctrl++", false},
+		{"Escape", "esc", false},
+		{"space", " ", false},
+		{"", "", true},
+		{"hyper+x", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	defaults := func() *Keymap {
+		k := New()
+		_ = k.Bind(Global, "ctrl+s", "file.save")
+		_ = k.Bind(Global, "ctrl+k ctrl+c", "edit.comment")
+		_ = k.Bind(Editor, "ctrl+d", "edit.duplicate")
+		return k
+	}
+	tests := []struct {
+		name  string
+		file  string
+		want  map[string]string // "scope keys" to command; "" when unbound
+		errs  []string
+		dupes int
+	}{
+		{
+			name: "missing file",
+			want: map[string]string{"global ctrl+s": "file.save"},
+		},
+		{
+			name: "bind and rebind",
+			file: `[{"key": "Ctrl+s", "command": "file.saveAll"}, {"key": "ctrl+e", "command": "x", "scope": "editor"}]`,
+			want: map[string]string{"global ctrl+s": "file.saveAll", "editor ctrl+e": "x"},
+		},
+		{
+			name: "remove a binding",
+			file: `[{"key": "ctrl+s", "command": "-file.save"}, {"key": "ctrl+d", "command": "-edit.duplicate", "scope": "editor"}]`,
+			want: map[string]string{"global ctrl+s": "", "editor ctrl+d": ""},
+		},
+		{
+			name: "removing another command's binding keeps it",
+			file: `[{"key": "ctrl+s", "command": "-file.open"}]`,
+			want: map[string]string{"global ctrl+s": "file.save"},
+			errs: []string{"entry 1: ctrl+s is bound to file.save, not file.open"},
+		},
+		{
+			name: "removing an unbound key",
+			file: `[{"key": "ctrl+q", "command": "-app.quit"}]`,
+			want: map[string]string{"global ctrl+s": "file.save"},
+		},
+		{
+			name: "removing in the wrong scope",
+			file: `[{"key": "ctrl+d", "command": "-edit.duplicate"}]`,
+			want: map[string]string{"editor ctrl+d": "edit.duplicate"},
+		},
+		{
+			name: "bad entries are skipped",
+			file: `[{"key": "hyper+x", "command": "a"}, {"key": "ctrl+x", "command": "b", "scope": "nowhere"}, {"key": "ctrl+y", "command": "c"}, {"key": "", "command": "-d"}]`,
+			want: map[string]string{"global ctrl+y": "c", "global ctrl+x": ""},
+			errs: []string{"entry 1:", "entry 2: unknown scope", "entry 4: empty key sequence"},
+		},
+		{
+			name:  "bound twice",
+			file:  `[{"key": "ctrl+j", "command": "a"}, {"key": "Ctrl+j", "command": "b"}]`,
+			want:  map[string]string{"global ctrl+j": "b"},
+			dupes: 1,
+		},
+		{
+			name: "broken file changes nothing",
+			file: `[{"key": "ctrl+s", "command": "x"},`,
+			want: map[string]string{"global ctrl+s": "file.save"},
+			errs: []string{"keybindings.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keybindings.json")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			k := defaults()
+			err := k.Load(path)
+			msg := ""
+			if err != nil {
+				msg = err.Error()
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(msg, e) {
+					t.Errorf("error %q does not mention %q", msg, e)
+				}
+			}
+			if len(tt.errs) == 0 && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for key, want := range tt.want {
+				scope, keys, _ := strings.Cut(key, " ")
+				if got := k.Lookup(Scope(scope), keys); got != want {
+					t.Errorf("%s: bound to %q, want %q", key, got, want)
+				}
+			}
+			if got := len(k.Conflicts()); got != tt.dupes {
+				t.Errorf("%d conflicts, want %d: %v", got, tt.dupes, k.Conflicts())
+			}
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	k := New()
+	_ = k.Bind(Global, "ctrl+s", "file.save")
+	_ = k.Bind(Global, "ctrl+k ctrl+c", "edit.comment")
+	_ = k.Bind(Editor, "ctrl+s", "editor.save")
+	_ = k.Bind(Sidebar, "ctrl+k ctrl+c", "sidebar.copy")
+	tests := []struct {
+		name   string
+		scopes []Scope
+		keys   []string
+		cmds   []string
+		result Result
+	}{
+		{"unbound", []Scope{Global}, []string{"ctrl+q"}, nil, None},
+		{"global", []Scope{Global}, []string{"ctrl+s"}, []string{"file.save"}, Match},
+		{"most specific first", []Scope{Editor, Global}, []string{"ctrl+s"}, []string{"editor.save", "file.save"}, Match},
+		{"chord starts", []Scope{Global}, []string{"ctrl+k"}, nil, Pending},
+		{"chord completes", []Scope{Global}, []string{"ctrl+k", "ctrl+c"}, []string{"edit.comment"}, Match},
+		{"chord broken", []Scope{Global}, []string{"ctrl+k", "x"}, nil, Broken},
+		{"chord in a scope", []Scope{Sidebar, Global}, []string{"ctrl+k", "ctrl+c"}, []string{"sidebar.copy", "edit.comment"}, Match},
+		{"after a broken chord", []Scope{Global}, []string{"ctrl+k", "x", "ctrl+s"}, []string{"file.save"}, Match},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k.Reset()
+			var cmds []string
+			var res Result
+			for _, key := range tt.keys {
+				cmds, res = k.Feed(key, tt.scopes...)
+			}
+			if res != tt.result || !slices.Equal(cmds, tt.cmds) {
+				t.Errorf("Feed = %v, %v, want %v, %v", cmds, res, tt.cmds, tt.result)
+			}
+			if res != Pending && k.Pending() != "" {
+				t.Errorf("chord %q left pending", k.Pending())
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package trash
+
+import "io/fs"
+
+func device(fs.FileInfo) (uint64, bool) { return 0, false }
@@ -0,0 +1,16 @@
+//go:build unix
+
+package trash
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func device(fi fs.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
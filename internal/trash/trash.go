@@ -0,0 +1,157 @@
+// Package trash moves files to the trash the way desktop file managers do,
+// following the FreeDesktop.org Trash specification, so that they can be
+// restored from here or from the desktop.
+//
+// A file goes to the trash in the user's data directory,
+// $XDG_DATA_HOME/Trash, when it is on the same filesystem; otherwise to
+// .Trash-UID at the top of its own filesystem, since moving it across
+// filesystems would mean copying it.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Item is a file or directory in the trash.
+type Item struct {
+	Path    string // where it was
+	Trashed string // where it is now
+	Info    string // its .trashinfo file
+	Deleted time.Time
+}
+
+// Put moves the file or directory at path to the trash.
+func Put(path string) (Item, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Item{}, err
+	}
+	fi, err := os.Lstat(abs)
+	if err != nil {
+		return Item{}, err
+	}
+	dir, err := trashFor(abs, fi)
+	if err != nil {
+		return Item{}, err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return Item{}, err
+		}
+	}
+
+	it := Item{Path: abs, Deleted: time.Now()}
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: abs}).EscapedPath(), it.Deleted.Format("2006-01-02T15:04:05"))
+	name := filepath.Base(abs)
+	ext := filepath.Ext(name)
+	for n := 1; ; n++ {
+		// The info file is created first and exclusively, which reserves
+		// the name against other programs trashing at the same time.
+		try := name
+		if n > 1 {
+			try = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), n, ext)
+		}
+		it.Info = filepath.Join(dir, "info", try+".trashinfo")
+		it.Trashed = filepath.Join(dir, "files", try)
+		f, err := os.OpenFile(it.Info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return Item{}, err
+		}
+		_, err = f.WriteString(info)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(abs, it.Trashed)
+		}
+		if err != nil {
+			os.Remove(it.Info)
+			return Item{}, err
+		}
+		return it, nil
+	}
+}
+
+// Restore moves it back out of the trash to where it was.
+func Restore(it Item) error {
+	if _, err := os.Lstat(it.Path); err == nil {
+		return fmt.Errorf("%s already exists", it.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(it.Path), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(it.Trashed, it.Path); err != nil {
+		return err
+	}
+	os.Remove(it.Info)
+	return nil
+}
+
+// HomeDir returns the trash in the user's data directory.
+func HomeDir() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "Trash"), nil
+}
+
+// trashFor returns the trash directory that the file at path, with info
+// fi, goes to.
+func trashFor(path string, fi fs.FileInfo) (string, error) {
+	home, err := HomeDir()
+	if err != nil {
+		return "", err
+	}
+	dev, ok := device(fi)
+	if !ok {
+		return home, nil
+	}
+	if hd, ok := nearestDevice(home); !ok || hd == dev {
+		return home, nil
+	}
+	// The top of the filesystem is the highest directory above path that
+	// is still on it.
+	top := filepath.Dir(path)
+	for parent := filepath.Dir(top); parent != top; top, parent = parent, filepath.Dir(parent) {
+		pfi, err := os.Stat(parent)
+		if err != nil {
+			break
+		}
+		if d, ok := device(pfi); !ok || d != dev {
+			break
+		}
+	}
+	return filepath.Join(top, ".Trash-"+strconv.Itoa(os.Getuid())), nil
+}
+
+// nearestDevice returns the device of path or, when it does not exist
+// yet, of the nearest directory above it that does.
+func nearestDevice(path string) (uint64, bool) {
+	for {
+		if fi, err := os.Stat(path); err == nil {
+			return device(fi)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// inotify watches directories with one inotify instance. Its descriptor
+// is non-blocking and wrapped in an os.File, so that reading it waits in
+// the runtime's poller and closing it ends the read.
+type inotify struct {
+	f      *os.File
+	fd     int
+	notify func(string)
+
+	mu   sync.Mutex
+	dirs map[int32][]string // watch descriptor to the paths it was added as
+	wds  map[string]int32
+}
+
+func newNative(notify func(string)) (backend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	in := &inotify{
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		notify: notify,
+		dirs:   map[int32][]string{},
+		wds:    map[string]int32{},
+	}
+	go in.read()
+	return in, nil
+}
+
+func (in *inotify) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(in.fd, dir, inotifyMask)
+	if errors.Is(err, unix.ENOSPC) || errors.Is(err, unix.EMFILE) {
+		return errLimit
+	}
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	// Paths to the same directory share a descriptor.
+	in.dirs[int32(wd)] = append(in.dirs[int32(wd)], dir)
+	in.wds[dir] = int32(wd)
+	return nil
+}
+
+func (in *inotify) remove(dir string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	wd, ok := in.wds[dir]
+	if !ok {
+		return
+	}
+	delete(in.wds, dir)
+	var rest []string
+	for _, d := range in.dirs[wd] {
+		if d != dir {
+			rest = append(rest, d)
+		}
+	}
+	if len(rest) > 0 {
+		in.dirs[wd] = rest
+		return
+	}
+	delete(in.dirs, wd)
+	_, _ = unix.InotifyRmWatch(in.fd, uint32(wd))
+}
+
+func (in *inotify) close() error {
+	return in.f.Close()
+}
+
+// read turns events into paths until the descriptor is closed.
+func (in *inotify) read() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := in.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + unix.SizeofInotifyEvent
+			off = start + int(ev.Len)
+			name := strings.TrimRight(string(buf[start:min(off, n)]), "\x00")
+
+			in.mu.Lock()
+			dirs := in.dirs[ev.Wd]
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// Events were lost: every directory may have changed.
+				dirs, name = nil, ""
+				for d := range in.wds {
+					dirs = append(dirs, d)
+				}
+			}
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				// The watch is gone with its directory.
+				for _, d := range in.dirs[ev.Wd] {
+					delete(in.wds, d)
+				}
+				delete(in.dirs, ev.Wd)
+			}
+			in.mu.Unlock()
+
+			for _, d := range dirs {
+				if name != "" {
+					in.notify(filepath.Join(d, name))
+				} else {
+					in.notify(d)
+				}
+			}
+		}
+	}
+}
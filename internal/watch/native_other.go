@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watch
+
+import (
+	"errors"
+	"runtime"
+)
+
+func newNative(notify func(string)) (backend, error) {
+	return nil, errors.New("no native file watching on " + runtime.GOOS)
+}
@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stamp is what polling compares to tell that an entry changed.
+type stamp struct {
+	size int64
+	mod  int64 // nanoseconds
+	mode fs.FileMode
+}
+
+// poller reads every directory each pollInterval and compares its entries
+// with what it found last time.
+type poller struct {
+	notify func(string)
+	mu     sync.Mutex
+	dirs   map[string]map[string]stamp // nil for a directory that cannot be read
+	stop   chan struct{}
+}
+
+func newPoller(notify func(string)) *poller {
+	p := &poller{notify: notify, dirs: map[string]map[string]stamp{}, stop: make(chan struct{})}
+	go p.loop()
+	return p
+}
+
+func (p *poller) add(dir string) error {
+	snap, err := scan(dir)
+	p.mu.Lock()
+	p.dirs[dir] = snap
+	p.mu.Unlock()
+	return err
+}
+
+func (p *poller) remove(dir string) {
+	p.mu.Lock()
+	delete(p.dirs, dir)
+	p.mu.Unlock()
+}
+
+func (p *poller) close() error {
+	close(p.stop)
+	return nil
+}
+
+func (p *poller) loop() {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.poll()
+		}
+	}
+}
+
+// poll reads every directory and reports what differs.
+func (p *poller) poll() {
+	p.mu.Lock()
+	dirs := make([]string, 0, len(p.dirs))
+	for d := range p.dirs {
+		dirs = append(dirs, d)
+	}
+	p.mu.Unlock()
+	for _, dir := range dirs {
+		snap, _ := scan(dir)
+		p.mu.Lock()
+		old, ok := p.dirs[dir]
+		if ok {
+			p.dirs[dir] = snap
+		}
+		p.mu.Unlock()
+		switch {
+		case !ok:
+			// Removed while it was read.
+		case (old == nil) != (snap == nil):
+			p.notify(dir)
+		default:
+			for name, s := range snap {
+				if o, ok := old[name]; !ok || o != s {
+					p.notify(filepath.Join(dir, name))
+				}
+			}
+			for name := range old {
+				if _, ok := snap[name]; !ok {
+					p.notify(filepath.Join(dir, name))
+				}
+			}
+		}
+	}
+}
+
+// scan returns the stamps of the entries of dir.
+func scan(dir string) (map[string]stamp, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snap := make(map[string]stamp, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snap[e.Name()] = stamp{size: fi.Size(), mod: fi.ModTime().UnixNano(), mode: fi.Mode()}
+	}
+	return snap, nil
+}
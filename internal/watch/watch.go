@@ -0,0 +1,187 @@
+// Package watch reports changes to the files in a set of directories.
+//
+// On Linux it uses inotify. Elsewhere, or when inotify cannot be used
+// because the system's limit on watches is reached, it polls the
+// directories instead, which notices the same changes a little later.
+package watch
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// quiet is how long Next waits for more changes after one arrives,
+	// so that a checkout or a build is reported at once rather than file
+	// by file.
+	quiet = 100 * time.Millisecond
+	// maxWait bounds that wait when changes keep coming.
+	maxWait = time.Second
+	// pollInterval is how often polling looks at the directories.
+	pollInterval = time.Second
+)
+
+// errLimit is returned by a backend that cannot watch any more
+// directories.
+var errLimit = errors.New("too many watches")
+
+// backend watches directories and calls notify with the path of each
+// entry that changes in them, or of a directory that changed too much to
+// tell what or went away.
+type backend interface {
+	add(dir string) error
+	remove(dir string)
+	close() error
+}
+
+// Watcher watches a set of directories. Its methods may be called from
+// different goroutines.
+type Watcher struct {
+	mu      sync.Mutex
+	b       backend
+	polling bool
+	dirs    map[string]bool
+
+	pmu     sync.Mutex
+	pending map[string]bool
+	signal  chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns a watcher watching nothing yet.
+func New() *Watcher {
+	w := &Watcher{
+		dirs:    map[string]bool{},
+		pending: map[string]bool{},
+		signal:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	b, err := newNative(w.notify)
+	if err != nil {
+		b, w.polling = newPoller(w.notify), true
+	}
+	w.b = b
+	return w
+}
+
+// Polling reports whether the watcher polls rather than being told of
+// changes.
+func (w *Watcher) Polling() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.polling
+}
+
+// Set makes dirs the directories watched. Directories that cannot be
+// watched, because they do not exist say, are tried again only after
+// they drop out of dirs, or after Next reports them.
+func (w *Watcher) Set(dirs []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	want := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		want[d] = true
+	}
+	for d := range w.dirs {
+		if !want[d] {
+			w.b.remove(d)
+			delete(w.dirs, d)
+		}
+	}
+	for d := range want {
+		if w.dirs[d] {
+			continue
+		}
+		w.dirs[d] = true
+		if err := w.b.add(d); errors.Is(err, errLimit) {
+			w.fallBack()
+		}
+	}
+}
+
+// fallBack switches to polling every directory.
+func (w *Watcher) fallBack() {
+	if w.polling {
+		return
+	}
+	_ = w.b.close()
+	w.b, w.polling = newPoller(w.notify), true
+	for d := range w.dirs {
+		_ = w.b.add(d)
+	}
+}
+
+// Next waits for changes and returns the paths that changed, sorted:
+// entries of the watched directories, or a watched directory itself. It
+// returns nil once the watcher is closed.
+func (w *Watcher) Next() []string {
+	for {
+		select {
+		case <-w.signal:
+		case <-w.done:
+			return nil
+		}
+		deadline := time.After(maxWait)
+	wait:
+		for {
+			select {
+			case <-w.signal:
+			case <-time.After(quiet):
+				break wait
+			case <-deadline:
+				break wait
+			case <-w.done:
+				return nil
+			}
+		}
+		w.pmu.Lock()
+		paths := make([]string, 0, len(w.pending))
+		for p := range w.pending {
+			paths = append(paths, p)
+		}
+		w.pending = map[string]bool{}
+		w.pmu.Unlock()
+		if len(paths) == 0 {
+			continue
+		}
+		sort.Strings(paths)
+		// A directory that was reported may have gone; watch it again
+		// when it is next asked for.
+		w.mu.Lock()
+		for _, p := range paths {
+			if w.dirs[p] {
+				w.b.remove(p)
+				delete(w.dirs, p)
+			}
+		}
+		w.mu.Unlock()
+		return paths
+	}
+}
+
+// notify records that path changed.
+func (w *Watcher) notify(path string) {
+	w.pmu.Lock()
+	w.pending[path] = true
+	w.pmu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops watching and makes Next return nil.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.mu.Lock()
+		err = w.b.close()
+		w.mu.Unlock()
+	})
+	return err
+}